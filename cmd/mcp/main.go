@@ -1,14 +1,29 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"loopgate/internal/mcp"
+	"os"
 )
 
+// loopgate-mcp is a stdio MCP server for desktop clients. It forwards every
+// message to a running Loopgate server, which owns Telegram and storage.
 func main() {
-	server := mcp.NewServer()
-	
-	if err := server.Start(); err != nil {
-		log.Fatalf("MCP server failed: %v", err)
+	defaultURL := os.Getenv("LOOPGATE_URL")
+	if defaultURL == "" {
+		defaultURL = "http://localhost:8080"
 	}
-}
\ No newline at end of file
+
+	serverURL := flag.String("server", defaultURL, "Base URL of the Loopgate server (env LOOPGATE_URL)")
+	apiKey := flag.String("api-key", os.Getenv("LOOPGATE_API_KEY"), "API key for the Loopgate server (env LOOPGATE_API_KEY)")
+	flag.Parse()
+
+	// stdout carries the protocol, so logs must stay on stderr.
+	log.SetOutput(os.Stderr)
+
+	proxy := mcp.NewProxy(*serverURL, *apiKey, os.Stdin, os.Stdout)
+	if err := proxy.Start(); err != nil {
+		log.Fatalf("MCP proxy failed: %v", err)
+	}
+}
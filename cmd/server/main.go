@@ -4,12 +4,18 @@ import (
 	"context"
 	"log"
 	"loopgate/config"
+	"loopgate/internal/discord"
+	"loopgate/internal/email"
 	"loopgate/internal/handlers"
+	"loopgate/internal/matrix"
 	"loopgate/internal/mcp"
+	"loopgate/internal/notifier"
 	"loopgate/internal/router"
 	"loopgate/internal/session"
+	"loopgate/internal/slack"
 	"loopgate/internal/storage" // Added storage import
 	"loopgate/internal/telegram"
+	"loopgate/internal/webhook"
 	"net/http"
 	"os"
 	"os/signal"
@@ -20,13 +26,8 @@ import (
 func main() {
 	cfg := config.Load()
 
-	if cfg.TelegramBotToken == "" {
-		log.Fatal("TELEGRAM_BOT_TOKEN environment variable is required")
-	}
-
 	// Initialize storage adapter based on configuration
 	var storageAdapter storage.StorageAdapter
-	var err error
 	var closer func() // To store the Close function for database adapters
 
 	switch cfg.StorageAdapter {
@@ -66,15 +67,86 @@ func main() {
 	// Initialize session manager with the chosen adapter
 	sessionManager := session.NewManager(storageAdapter)
 
-	telegramBot, err := telegram.NewBot(cfg.TelegramBotToken, sessionManager)
-	if err != nil {
-		log.Fatalf("Failed to create Telegram bot: %v", err)
+	// Register a notifier for every channel with credentials. Sessions pick
+	// one when they register; Telegram is the default.
+	notifiers := notifier.NewRegistry(sessionManager)
+	if cfg.TelegramBotToken != "" {
+		telegramBot, err := telegram.NewBot(telegram.Config{
+			Token:         cfg.TelegramBotToken,
+			PublicURL:     cfg.PublicURL,
+			WebhookSecret: cfg.TelegramWebhookSecret,
+		}, sessionManager)
+		if err != nil {
+			log.Fatalf("Failed to create Telegram bot: %v", err)
+		}
+		notifiers.Register(telegramBot)
+	}
+	if cfg.SlackBotToken != "" {
+		notifiers.Register(slack.NewBot(cfg.SlackBotToken, cfg.SlackSigningSecret, cfg.SlackAPIURL, sessionManager))
+	}
+	if cfg.DiscordBotToken != "" {
+		discordBot, err := discord.NewBot(cfg.DiscordBotToken, cfg.DiscordPublicKey, cfg.DiscordAPIURL, sessionManager)
+		if err != nil {
+			log.Fatalf("Failed to create Discord bot: %v", err)
+		}
+		notifiers.Register(discordBot)
+	}
+	if cfg.MatrixHomeserverURL != "" {
+		matrixBot, err := matrix.NewBot(cfg.MatrixHomeserverURL, cfg.MatrixAccessToken, sessionManager)
+		if err != nil {
+			log.Fatalf("Failed to create Matrix bot: %v", err)
+		}
+		notifiers.Register(matrixBot)
+	}
+	if cfg.SMTPHost != "" {
+		emailNotifier, err := email.NewNotifier(email.Config{
+			SMTPHost:          cfg.SMTPHost,
+			SMTPPort:          cfg.SMTPPort,
+			SMTPUsername:      cfg.SMTPUsername,
+			SMTPPassword:      cfg.SMTPPassword,
+			From:              cfg.EmailFrom,
+			PublicURL:         cfg.PublicURL,
+			LinkSecret:        cfg.EmailLinkSecret,
+			InboxDir:          cfg.EmailInboxDir,
+			InboxPollInterval: time.Duration(cfg.EmailInboxInterval) * time.Second,
+		}, sessionManager)
+		if err != nil {
+			log.Fatalf("Failed to create email notifier: %v", err)
+		}
+		notifiers.Register(emailNotifier)
+	}
+	if len(notifiers.Channels()) == 0 {
+		log.Println("Warning: no notification channels are configured; requests cannot be delivered")
+	}
+	sessionManager.OnResolved(notifiers.NotifyResolved)
+	notifiers.Start()
+
+	// Drain the callback_url outbox. Entries are written when requests are
+	// answered, canceled or time out; Notify just skips the wait for the next poll.
+	webhookDispatcher := webhook.NewDispatcher(storageAdapter, cfg.WebhookSecret,
+		cfg.WebhookMaxAttempts, time.Duration(cfg.WebhookRetryBaseDelay)*time.Second)
+	sessionManager.OnResolved(webhookDispatcher.Notify)
+	go webhookDispatcher.Start()
+
+	// Time out overdue requests. The first sweep also picks up requests that
+	// were still pending when the server last stopped.
+	expirer := session.NewExpirer(sessionManager, time.Duration(cfg.ExpirySweepInterval)*time.Second)
+	go expirer.Start()
+
+	// Re-send requests nobody has answered to their escalation targets.
+	escalator := notifier.NewEscalator(sessionManager, notifiers, time.Duration(cfg.ExpirySweepInterval)*time.Second)
+	go escalator.Start()
+
+	// Remind approvers of requests they have not answered yet.
+	var nudger *notifier.Nudger
+	if cfg.ReminderInterval > 0 && cfg.ReminderMaxCount > 0 {
+		nudger = notifier.NewNudger(sessionManager, notifiers, time.Duration(cfg.ReminderInterval)*time.Second,
+			cfg.ReminderMaxCount, time.Duration(cfg.ExpirySweepInterval)*time.Second)
+		go nudger.Start()
 	}
 
-	go telegramBot.Start()
-
-	mcpServer := mcp.NewServer()
-	hitlHandler := handlers.NewHITLHandler(sessionManager, telegramBot)
+	mcpServer := mcp.NewServer(sessionManager, notifiers)
+	hitlHandler := handlers.NewHITLHandler(sessionManager, notifiers)
 	// Pass storageAdapter and cfg to NewRouter
 	appRouter := router.NewRouter(mcpServer, hitlHandler, storageAdapter, cfg)
 
@@ -99,6 +171,14 @@ func main() {
 
 	log.Println("Shutting down server...")
 
+	expirer.Stop()
+	escalator.Stop()
+	if nudger != nil {
+		nudger.Stop()
+	}
+	webhookDispatcher.Stop()
+	notifiers.Stop()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
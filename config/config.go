@@ -10,6 +10,7 @@ import (
 
 type Config struct {
 	TelegramBotToken      string
+	TelegramWebhookSecret string // Authenticates Telegram webhook updates; derived from the bot token if empty
 	ServerPort            string
 	LogLevel              string
 	RequestTimeout        int
@@ -19,6 +20,29 @@ type Config struct {
 	SQLiteDSN             string // Data Source Name for SQLite (e.g., "loopgate.db" or "file::memory:?cache=shared")
 	JWTSecretKey          string // Secret key for signing JWTs
 	APIKeyPrefix          string // Prefix for generated API keys (e.g., "lk_pub_")
+	ExpirySweepInterval   int    // Seconds between sweeps that time out and escalate overdue requests
+	ReminderInterval      int    // Seconds between reminders of a pending request; 0 disables them
+	ReminderMaxCount      int    // Reminders sent per request at most
+	WebhookSecret         string // HMAC key for signing callback_url deliveries; unsigned if empty
+	WebhookMaxAttempts    int    // Attempts per callback_url delivery before giving up
+	WebhookRetryBaseDelay int    // Seconds before the first retry; doubles on every attempt
+	SlackBotToken         string // Bot token (xoxb-...); enables the slack channel
+	SlackSigningSecret    string // Verifies Slack interaction callbacks
+	SlackAPIURL           string // Base URL of the Slack Web API
+	DiscordBotToken       string // Bot token; enables the discord channel
+	DiscordPublicKey      string // Hex application public key; verifies Discord interactions
+	DiscordAPIURL         string // Base URL of the Discord REST API
+	MatrixHomeserverURL   string // Base URL of the Matrix homeserver; enables the matrix channel
+	MatrixAccessToken     string // Access token of the bot's Matrix account
+	SMTPHost              string // Enables the email channel
+	SMTPPort              string
+	SMTPUsername          string
+	SMTPPassword          string
+	EmailFrom             string // Sender address of request emails
+	EmailLinkSecret       string // HMAC key for one-click answer links
+	EmailInboxDir         string // Mail drop directory of *.eml replies; replies are ignored if empty
+	EmailInboxInterval    int    // Seconds between mail drop scans
+	PublicURL             string // Base URL of this server as reached by browsers and Telegram, for links in messages and webhooks
 }
 
 func Load() *Config {
@@ -28,6 +52,7 @@ func Load() *Config {
 
 	cfg := &Config{
 		TelegramBotToken:      getEnv("TELEGRAM_BOT_TOKEN", ""),
+		TelegramWebhookSecret: getEnv("TELEGRAM_WEBHOOK_SECRET", ""),
 		ServerPort:            getEnv("SERVER_PORT", "8080"),
 		LogLevel:              getEnv("LOG_LEVEL", "info"),
 		RequestTimeout:        getEnvInt("REQUEST_TIMEOUT", 300),
@@ -37,12 +62,39 @@ func Load() *Config {
 		SQLiteDSN:             getEnv("SQLITE_DSN", "loopgate.db"), // Default to a local file "loopgate.db"
 		JWTSecretKey:          getEnv("JWT_SECRET_KEY", "your-super-secret-and-long-jwt-key"),       // IMPORTANT: Change this in production!
 		APIKeyPrefix:          getEnv("API_KEY_PREFIX", "lk_pub_"),    // Default API key prefix
+		ExpirySweepInterval:   getEnvInt("EXPIRY_SWEEP_INTERVAL", 5),
+		ReminderInterval:      getEnvInt("REMINDER_INTERVAL", 0),
+		ReminderMaxCount:      getEnvInt("REMINDER_MAX_COUNT", 3),
+		WebhookSecret:         getEnv("WEBHOOK_SECRET", ""),
+		WebhookMaxAttempts:    getEnvInt("WEBHOOK_MAX_ATTEMPTS", 5),
+		WebhookRetryBaseDelay: getEnvInt("WEBHOOK_RETRY_BASE_DELAY", 2),
+		SlackBotToken:         getEnv("SLACK_BOT_TOKEN", ""),
+		SlackSigningSecret:    getEnv("SLACK_SIGNING_SECRET", ""),
+		SlackAPIURL:           getEnv("SLACK_API_URL", "https://slack.com/api/"),
+		DiscordBotToken:       getEnv("DISCORD_BOT_TOKEN", ""),
+		DiscordPublicKey:      getEnv("DISCORD_PUBLIC_KEY", ""),
+		DiscordAPIURL:         getEnv("DISCORD_API_URL", "https://discord.com/api/v10"),
+		MatrixHomeserverURL:   getEnv("MATRIX_HOMESERVER_URL", ""),
+		MatrixAccessToken:     getEnv("MATRIX_ACCESS_TOKEN", ""),
+		SMTPHost:              getEnv("SMTP_HOST", ""),
+		SMTPPort:              getEnv("SMTP_PORT", "587"),
+		SMTPUsername:          getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:          getEnv("SMTP_PASSWORD", ""),
+		EmailFrom:             getEnv("EMAIL_FROM", ""),
+		EmailLinkSecret:       getEnv("EMAIL_LINK_SECRET", ""),
+		EmailInboxDir:         getEnv("EMAIL_INBOX_DIR", ""),
+		EmailInboxInterval:    getEnvInt("EMAIL_INBOX_INTERVAL", 30),
+		PublicURL:             getEnv("PUBLIC_URL", ""),
 	}
 
 	if cfg.JWTSecretKey == "your-super-secret-and-long-jwt-key" {
 		log.Println("WARNING: JWT_SECRET_KEY is set to its default value. This is insecure and should be changed for production.")
 	}
 
+	if cfg.WebhookSecret == "" {
+		log.Println("WARNING: WEBHOOK_SECRET is not set. Callback deliveries will be sent without a signature.")
+	}
+
 
 	// Validate storage adapter choice
 	switch cfg.StorageAdapter {
@@ -59,6 +111,26 @@ func Load() *Config {
 		log.Fatalf("SQLITE_DSN must be set when STORAGE_ADAPTER is 'sqlite'")
 	}
 
+	if cfg.ExpirySweepInterval <= 0 {
+		log.Fatalf("EXPIRY_SWEEP_INTERVAL must be a positive number of seconds")
+	}
+	if cfg.ReminderInterval < 0 || cfg.ReminderMaxCount < 0 {
+		log.Fatalf("REMINDER_INTERVAL and REMINDER_MAX_COUNT must not be negative")
+	}
+
+	if cfg.SlackBotToken != "" && cfg.SlackSigningSecret == "" {
+		log.Fatalf("SLACK_SIGNING_SECRET must be set when SLACK_BOT_TOKEN is set")
+	}
+	if cfg.DiscordBotToken != "" && cfg.DiscordPublicKey == "" {
+		log.Fatalf("DISCORD_PUBLIC_KEY must be set when DISCORD_BOT_TOKEN is set")
+	}
+	if cfg.MatrixHomeserverURL != "" && cfg.MatrixAccessToken == "" {
+		log.Fatalf("MATRIX_ACCESS_TOKEN must be set when MATRIX_HOMESERVER_URL is set")
+	}
+	if cfg.SMTPHost != "" && (cfg.EmailFrom == "" || cfg.EmailLinkSecret == "" || cfg.PublicURL == "") {
+		log.Fatalf("EMAIL_FROM, EMAIL_LINK_SECRET and PUBLIC_URL must be set when SMTP_HOST is set")
+	}
+
 
 	return cfg
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"time"
 )
 
@@ -25,6 +26,18 @@ type SessionRegistration struct {
 
 func main() {
 	baseURL := "http://localhost:8080"
+	apiKey := os.Getenv("LOOPGATE_API_KEY") // Create one with POST /api/user/apikeys
+
+	// Every /hitl endpoint requires an API key
+	call := func(method, url string, body []byte) (*http.Response, error) {
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", apiKey)
+		return http.DefaultClient.Do(req)
+	}
 	
 	// Register session
 	regReq := SessionRegistration{
@@ -34,7 +47,7 @@ func main() {
 	}
 	
 	regJSON, _ := json.Marshal(regReq)
-	resp, err := http.Post(baseURL+"/hitl/register", "application/json", bytes.NewBuffer(regJSON))
+	resp, err := call(http.MethodPost, baseURL+"/hitl/register", regJSON)
 	if err != nil {
 		panic(err)
 	}
@@ -56,7 +69,7 @@ func main() {
 	}
 	
 	hitlJSON, _ := json.Marshal(hitlReq)
-	resp, err = http.Post(baseURL+"/hitl/request", "application/json", bytes.NewBuffer(hitlJSON))
+	resp, err = call(http.MethodPost, baseURL+"/hitl/request", hitlJSON)
 	if err != nil {
 		panic(err)
 	}
@@ -70,7 +83,7 @@ func main() {
 	
 	// Poll for response
 	for {
-		pollResp, err := http.Get(fmt.Sprintf("%s/hitl/poll?request_id=%s", baseURL, requestID))
+		pollResp, err := call(http.MethodGet, fmt.Sprintf("%s/hitl/poll?request_id=%s", baseURL, requestID), nil)
 		if err != nil {
 			panic(err)
 		}
@@ -0,0 +1,30 @@
+// Package console serves the embedded web approval console. The page talks
+// to /api/auth/login and the JWT-protected /api/console routes.
+package console
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// Path is where the console is mounted.
+const Path = "/console/"
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the console's static files under Path.
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err) // the embedded directory always exists
+	}
+
+	fileServer := http.StripPrefix(Path, http.FileServer(http.FS(files)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		fileServer.ServeHTTP(w, r)
+	})
+}
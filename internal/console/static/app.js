@@ -0,0 +1,238 @@
+"use strict";
+
+(function () {
+  const POLL_INTERVAL_MS = 5000;
+  const TOKEN_KEY = "loopgate.token";
+  const USERNAME_KEY = "loopgate.username";
+
+  const $ = (id) => document.getElementById(id);
+  let view = "pending";
+  let pollTimer = null;
+
+  class AuthError extends Error {}
+
+  async function api(method, path, body) {
+    const headers = { Authorization: "Bearer " + sessionStorage.getItem(TOKEN_KEY) };
+    if (body !== undefined) {
+      headers["Content-Type"] = "application/json";
+    }
+    const resp = await fetch("/api/console" + path, {
+      method,
+      headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    if (resp.status === 401) {
+      throw new AuthError("Session expired");
+    }
+    if (!resp.ok) {
+      throw new Error((await resp.text()).trim() || resp.statusText);
+    }
+    return resp.status === 204 ? null : resp.json();
+  }
+
+  function showLogin() {
+    stopPolling();
+    sessionStorage.removeItem(TOKEN_KEY);
+    sessionStorage.removeItem(USERNAME_KEY);
+    $("login").hidden = false;
+    $("requests").hidden = true;
+    $("account").hidden = true;
+  }
+
+  function showRequests() {
+    $("login").hidden = true;
+    $("requests").hidden = false;
+    $("account").hidden = false;
+    $("username").textContent = sessionStorage.getItem(USERNAME_KEY) || "";
+    refresh();
+    stopPolling();
+    pollTimer = setInterval(refresh, POLL_INTERVAL_MS);
+  }
+
+  function stopPolling() {
+    if (pollTimer !== null) {
+      clearInterval(pollTimer);
+      pollTimer = null;
+    }
+  }
+
+  async function login(event) {
+    event.preventDefault();
+    const form = event.target;
+    $("login-error").textContent = "";
+    const resp = await fetch("/api/auth/login", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ username: form.username.value, password: form.password.value }),
+    });
+    if (!resp.ok) {
+      $("login-error").textContent = (await resp.text()).trim() || "Login failed";
+      return;
+    }
+    const result = await resp.json();
+    sessionStorage.setItem(TOKEN_KEY, result.token);
+    sessionStorage.setItem(USERNAME_KEY, result.username);
+    form.reset();
+    showRequests();
+  }
+
+  async function refresh() {
+    // Don't clobber an answer the user is typing.
+    if (document.activeElement && document.activeElement.tagName === "TEXTAREA") {
+      return;
+    }
+    try {
+      const query = view === "pending" ? "?status=pending" : "?limit=100";
+      const result = await api("GET", "/requests" + query);
+      render(result.requests);
+      $("status").textContent = "Updated " + new Date().toLocaleTimeString();
+    } catch (err) {
+      if (err instanceof AuthError) {
+        showLogin();
+        return;
+      }
+      $("status").textContent = err.message;
+    }
+  }
+
+  function render(requests) {
+    const list = $("request-list");
+    list.replaceChildren(...requests.map(renderRequest));
+    $("empty").hidden = requests.length > 0;
+  }
+
+  function renderRequest(request) {
+    const item = $("request-template").content.firstElementChild.cloneNode(true);
+    const badge = item.querySelector(".badge");
+    badge.textContent = request.status;
+    badge.classList.add(request.status);
+    item.querySelector("time").textContent = new Date(request.created_at).toLocaleString();
+    item.querySelector(".client").textContent = request.client_id;
+    item.querySelector(".message").textContent = request.message;
+
+    const details = item.querySelector(".details");
+    addDetail(details, "Request", request.id);
+    addDetail(details, "Type", request.request_type);
+    if (request.status !== "pending") {
+      addDetail(details, "Response", request.response || "—");
+      if (request.status === "completed") {
+        addDetail(details, "Approved", request.approved ? "yes" : "no");
+      }
+      if (request.responder) {
+        const name = request.responder.name || request.responder.user_id || "unknown";
+        addDetail(details, "Answered by", name + " via " + request.responder.channel);
+      }
+      if (request.responded_at) {
+        addDetail(details, "Responded", new Date(request.responded_at).toLocaleString());
+      }
+    } else if (request.timeout_seconds > 0) {
+      const expires = new Date(new Date(request.created_at).getTime() + request.timeout_seconds * 1000);
+      addDetail(details, "Expires", expires.toLocaleString());
+    }
+
+    if (request.escalation && request.escalation.length > 0) {
+      addDetail(details, "Escalation", "step " + (request.escalation_level || 0) + " of " + request.escalation.length);
+    }
+
+    if (request.quorum) {
+      const votes = request.votes || [];
+      const approvals = votes.filter((vote) => vote.approved).length;
+      let quorum = approvals + " of " + request.quorum.required + " approvals from " + request.quorum.approvers.join(", ");
+      if (request.quorum.veto) {
+        quorum += "; any rejection vetoes";
+      }
+      addDetail(details, "Quorum", quorum);
+      for (const vote of votes) {
+        addDetail(details, "Vote", vote.approver + ": " + vote.response);
+      }
+    }
+
+    if (request.metadata && Object.keys(request.metadata).length > 0) {
+      const metadata = item.querySelector(".metadata");
+      metadata.hidden = false;
+      metadata.querySelector("pre").textContent = JSON.stringify(request.metadata, null, 2);
+    }
+
+    if (request.status === "pending") {
+      renderAnswer(item, request);
+    }
+    return item;
+  }
+
+  function addDetail(list, label, value) {
+    const term = document.createElement("dt");
+    term.textContent = label;
+    const description = document.createElement("dd");
+    description.textContent = value;
+    list.append(term, description);
+  }
+
+  function renderAnswer(item, request) {
+    const answer = item.querySelector(".answer");
+    const error = item.querySelector(".error");
+
+    const act = async (path, body) => {
+      answer.querySelectorAll("button, textarea").forEach((el) => (el.disabled = true));
+      error.textContent = "";
+      try {
+        await api("POST", "/requests/" + encodeURIComponent(request.id) + path, body);
+        if (document.activeElement) {
+          document.activeElement.blur();
+        }
+        refresh();
+      } catch (err) {
+        if (err instanceof AuthError) {
+          showLogin();
+          return;
+        }
+        error.textContent = err.message;
+        answer.querySelectorAll("button, textarea").forEach((el) => (el.disabled = false));
+      }
+    };
+
+    if (request.options && request.options.length > 0) {
+      for (const option of request.options) {
+        answer.append(button(option, "primary", () => act("/respond", { response: option })));
+      }
+    } else {
+      const text = document.createElement("textarea");
+      text.placeholder = "Your response";
+      answer.append(text);
+      answer.append(button("Approve", "primary", () => act("/respond", { response: text.value, approved: true })));
+      answer.append(button("Reject", "", () => act("/respond", { response: text.value, approved: false })));
+    }
+    answer.append(button("Cancel request", "danger", () => {
+      if (confirm("Cancel this request? The agent will be told it was canceled.")) {
+        act("/cancel");
+      }
+    }));
+  }
+
+  function button(label, className, onClick) {
+    const el = document.createElement("button");
+    el.type = "button";
+    el.textContent = label;
+    if (className) {
+      el.className = className;
+    }
+    el.addEventListener("click", onClick);
+    return el;
+  }
+
+  document.querySelectorAll("nav button[data-view]").forEach((tab) => {
+    tab.addEventListener("click", () => {
+      document.querySelectorAll("nav button[data-view]").forEach((t) => t.classList.remove("active"));
+      tab.classList.add("active");
+      view = tab.dataset.view;
+      refresh();
+    });
+  });
+  $("login-form").addEventListener("submit", login);
+  $("logout").addEventListener("click", showLogin);
+
+  if (sessionStorage.getItem(TOKEN_KEY)) {
+    showRequests();
+  } else {
+    showLogin();
+  }
+})();
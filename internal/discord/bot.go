@@ -0,0 +1,257 @@
+package discord
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"loopgate/internal/notifier"
+	"loopgate/internal/session"
+	"loopgate/internal/types"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ChannelName is the session channel served by Bot.
+const ChannelName = "discord"
+
+// DefaultAPIURL is the base URL of the Discord REST API.
+const DefaultAPIURL = "https://discord.com/api/v10"
+
+// custom_id prefixes that route component interactions back to requests.
+const (
+	optionCustomIDPrefix  = "hitl:option:"
+	respondCustomIDPrefix = "hitl:respond:"
+	inputCustomIDPrefix   = "hitl:input:"
+	inputFieldCustomID    = "response"
+)
+
+// Discord component types and limits.
+const (
+	componentActionRow = 1
+	componentButton    = 2
+	componentTextInput = 4
+
+	buttonStylePrimary = 1
+	buttonStyleDanger  = 4
+	textInputParagraph = 2
+
+	maxButtonsPerRow = 5
+	maxRows          = 5
+	maxButtonLabel   = 80
+	maxContent       = 2000
+)
+
+// Bot delivers HITL requests as Discord channel messages with button
+// components and records answers from Discord interaction callbacks.
+// Options become buttons; input requests get a Respond button that opens a
+// modal. It implements notifier.Notifier and notifier.WebhookReceiver.
+type Bot struct {
+	token          string
+	publicKey      ed25519.PublicKey
+	apiURL         string
+	client         *http.Client
+	sessionManager *session.Manager
+}
+
+// NewBot creates a Discord notifier that posts with the bot token and
+// verifies interactions with the application's hex-encoded public key.
+// apiURL defaults to DefaultAPIURL.
+func NewBot(token, publicKey, apiURL string, sessionManager *session.Manager) (*Bot, error) {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid discord public key: must be %d hex-encoded bytes", ed25519.PublicKeySize)
+	}
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+
+	return &Bot{
+		token:          token,
+		publicKey:      ed25519.PublicKey(key),
+		apiURL:         strings.TrimRight(apiURL, "/"),
+		client:         &http.Client{Timeout: 10 * time.Second},
+		sessionManager: sessionManager,
+	}, nil
+}
+
+// Channel implements notifier.Notifier.
+func (b *Bot) Channel() string {
+	return ChannelName
+}
+
+// Start implements notifier.Notifier. Answers arrive as interaction
+// callbacks, so there is nothing to receive.
+func (b *Bot) Start() {
+	log.Println("Discord notifier ready; interactions are received at /discord/interactions")
+}
+
+// Stop implements notifier.Notifier.
+func (b *Bot) Stop() {}
+
+type message struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+}
+
+// SendRequest posts request to the session's Discord channel.
+func (b *Bot) SendRequest(request *types.HITLRequest, sess *types.Session) error {
+	if sess.Recipient == "" {
+		return fmt.Errorf("session %s has no discord channel", sess.ID)
+	}
+
+	text := fmt.Sprintf("🤖 **HITL Request**\n\n%s\n\n**Request ID:** `%s`\n**Client:** %s\n**Session:** %s",
+		request.Message, request.ID, request.ClientID, request.SessionID)
+
+	var sent message
+	err := b.call(http.MethodPost, "/channels/"+sess.Recipient+"/messages", map[string]interface{}{
+		"content":          truncate(text, maxContent),
+		"components":       requestComponents(request),
+		"allowed_mentions": noMentions(),
+	}, &sent)
+	if err != nil {
+		return err
+	}
+
+	request.ChannelMsgID = sent.ChannelID + ":" + sent.ID
+	if err := b.sessionManager.SetChannelMsgID(request.ID, request.ChannelMsgID); err != nil {
+		log.Printf("Failed to store discord message for request %s: %v", request.ID, err)
+	}
+	return nil
+}
+
+// NotifyResolved edits the request message to show the outcome and removes
+// its buttons.
+func (b *Bot) NotifyResolved(request *types.HITLRequest, sess *types.Session) error {
+	channelID, messageID, ok := strings.Cut(request.ChannelMsgID, ":")
+	if !ok {
+		return nil
+	}
+
+	var text string
+	switch request.Status {
+	case types.RequestStatusCompleted:
+		text = fmt.Sprintf("✅ **Response Recorded**\n\n%s\n\nResponse: %s\n", request.Message, request.Response)
+		if answeredBy := notifier.AnsweredBy(request); answeredBy != "" {
+			text += "Answered by: " + answeredBy + "\n"
+		}
+		text += fmt.Sprintf("Request ID: `%s`", request.ID)
+	case types.RequestStatusTimeout:
+		text = fmt.Sprintf("⌛ **Request Expired**\n\n%s\n\nNo response within %d seconds.\nRequest ID: `%s`",
+			request.Message, request.Timeout, request.ID)
+	case types.RequestStatusCanceled:
+		text = fmt.Sprintf("🚫 **Request Canceled**\n\n%s\n\nRequest ID: `%s`", request.Message, request.ID)
+	default:
+		return nil
+	}
+
+	return b.call(http.MethodPatch, "/channels/"+channelID+"/messages/"+messageID, map[string]interface{}{
+		"content":          truncate(text, maxContent),
+		"components":       []interface{}{},
+		"allowed_mentions": noMentions(),
+	}, nil)
+}
+
+// requestComponents lays out one button per option, five to a row, or a
+// single Respond button for requests without options. Discord allows at
+// most 25 buttons per message; further options are left out.
+func requestComponents(request *types.HITLRequest) []interface{} {
+	if len(request.Options) == 0 {
+		return []interface{}{actionRow(button("Respond", respondCustomIDPrefix+request.ID, buttonStylePrimary))}
+	}
+
+	options := request.Options
+	if len(options) > maxButtonsPerRow*maxRows {
+		log.Printf("Request %s has %d options; Discord shows the first %d", request.ID, len(options), maxButtonsPerRow*maxRows)
+		options = options[:maxButtonsPerRow*maxRows]
+	}
+
+	var rows []interface{}
+	var buttons []interface{}
+	for i, option := range options {
+		style := buttonStylePrimary
+		if !notifier.OptionApproves(option) {
+			style = buttonStyleDanger
+		}
+		buttons = append(buttons, button(option, fmt.Sprintf("%s%s:%d", optionCustomIDPrefix, request.ID, i), style))
+		if len(buttons) == maxButtonsPerRow {
+			rows = append(rows, actionRow(buttons...))
+			buttons = nil
+		}
+	}
+	if len(buttons) > 0 {
+		rows = append(rows, actionRow(buttons...))
+	}
+	return rows
+}
+
+func actionRow(components ...interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": componentActionRow, "components": components}
+}
+
+func button(label, customID string, style int) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      componentButton,
+		"style":     style,
+		"label":     truncate(label, maxButtonLabel),
+		"custom_id": customID,
+	}
+}
+
+// noMentions keeps request text from pinging users, roles or @everyone.
+func noMentions() map[string]interface{} {
+	return map[string]interface{}{"parse": []string{}}
+}
+
+func truncate(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-1]) + "…"
+}
+
+// call invokes a Discord REST endpoint with a JSON body and decodes the
+// response into result if it is not nil.
+func (b *Bot) call(method, path string, payload, result interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode discord request: %w", err)
+	}
+
+	req, err := http.NewRequest(method, b.apiURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bot "+b.token)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("discord %s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiError struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &apiError) != nil || apiError.Message == "" {
+			apiError.Message = resp.Status
+		}
+		return fmt.Errorf("discord %s %s failed: %s", method, path, apiError.Message)
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode discord response: %w", err)
+	}
+	return nil
+}
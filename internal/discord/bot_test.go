@@ -0,0 +1,226 @@
+package discord
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"loopgate/internal/notifier"
+	"loopgate/internal/session"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type apiCall struct {
+	Method string
+	Path   string
+	Body   map[string]interface{}
+}
+
+// fakeDiscord records REST calls and answers them successfully.
+type fakeDiscord struct {
+	mu    sync.Mutex
+	calls []apiCall
+}
+
+func (f *fakeDiscord) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bot test-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "401: Unauthorized", "code": 0})
+		return
+	}
+
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	f.mu.Lock()
+	f.calls = append(f.calls, apiCall{Method: r.Method, Path: r.URL.Path, Body: body})
+	f.mu.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": "m-1", "channel_id": "c-1"})
+}
+
+func (f *fakeDiscord) callsTo(method string) []apiCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []apiCall
+	for _, call := range f.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+type testBot struct {
+	manager  *session.Manager
+	registry *notifier.Registry
+	api      *fakeDiscord
+	server   *httptest.Server
+	key      ed25519.PrivateKey
+}
+
+func setupBot(t *testing.T) *testBot {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	api := &fakeDiscord{}
+	apiServer := httptest.NewServer(api)
+	t.Cleanup(apiServer.Close)
+
+	manager := session.NewManager(storage.NewInMemoryStorageAdapter())
+	bot, err := NewBot("test-token", hex.EncodeToString(publicKey), apiServer.URL, manager)
+	require.NoError(t, err)
+
+	registry := notifier.NewRegistry(manager)
+	registry.Register(bot)
+	manager.OnResolved(registry.NotifyResolved)
+
+	router := mux.NewRouter()
+	registry.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	require.NoError(t, manager.CreateSession(&types.Session{ID: "s1", ClientID: "agent", Channel: ChannelName, Recipient: "c-1"}))
+	return &testBot{manager: manager, registry: registry, api: api, server: server, key: privateKey}
+}
+
+func (tb *testBot) submit(t *testing.T, request *types.HITLRequest) {
+	t.Helper()
+	request.SessionID = "s1"
+	request.ClientID = "agent"
+	request.Status = types.RequestStatusPending
+	request.CreatedAt = time.Now()
+	require.NoError(t, tb.manager.StoreRequest(request))
+	require.NoError(t, tb.registry.Send(request))
+}
+
+// interact posts payload signed with key and decodes the interaction
+// response.
+func (tb *testBot) interact(t *testing.T, key ed25519.PrivateKey, payload string) (int, map[string]interface{}) {
+	t.Helper()
+	timestamp := "1700000000"
+	req, err := http.NewRequest(http.MethodPost, tb.server.URL+"/discord/interactions", strings.NewReader(payload))
+	require.NoError(t, err)
+	req.Header.Set("X-Signature-Timestamp", timestamp)
+	req.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(key, []byte(timestamp+payload))))
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var response map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&response)
+	return resp.StatusCode, response
+}
+
+func TestBot_OptionButtons(t *testing.T) {
+	tb := setupBot(t)
+	options := []string{"A", "B", "C", "D", "E", "Deny"}
+	tb.submit(t, &types.HITLRequest{ID: "req-1", Message: "Pick one @everyone", Options: options})
+
+	posts := tb.api.callsTo(http.MethodPost)
+	require.Len(t, posts, 1)
+	assert.Equal(t, "/channels/c-1/messages", posts[0].Path)
+	assert.Contains(t, posts[0].Body["content"], "**Request ID:** `req-1`")
+	assert.Equal(t, map[string]interface{}{"parse": []interface{}{}}, posts[0].Body["allowed_mentions"])
+
+	rows := posts[0].Body["components"].([]interface{})
+	require.Len(t, rows, 2, "five buttons per row")
+	lastButton := rows[1].(map[string]interface{})["components"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "hitl:option:req-1:5", lastButton["custom_id"])
+	assert.Equal(t, float64(buttonStyleDanger), lastButton["style"])
+
+	status, response := tb.interact(t, tb.key, `{"type":3,"data":{"custom_id":"hitl:option:req-1:5"},"member":{"user":{"id":"u-1"}}}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(responseDeferredUpdateMessage), response["type"])
+
+	request, err := tb.manager.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.Equal(t, "Deny", request.Response)
+	assert.False(t, request.Approved)
+
+	edits := tb.api.callsTo(http.MethodPatch)
+	require.Len(t, edits, 1)
+	assert.Equal(t, "/channels/c-1/messages/m-1", edits[0].Path)
+	assert.Contains(t, edits[0].Body["content"], "Response: Deny")
+	assert.Empty(t, edits[0].Body["components"])
+
+	// A late click gets an ephemeral notice
+	_, response = tb.interact(t, tb.key, `{"type":3,"data":{"custom_id":"hitl:option:req-1:0"},"user":{"id":"u-2"}}`)
+	assert.Equal(t, float64(responseChannelMessage), response["type"])
+	data := response["data"].(map[string]interface{})
+	assert.Equal(t, notPendingMessage, data["content"])
+	assert.Equal(t, float64(flagEphemeral), data["flags"])
+}
+
+func TestBot_InputModal(t *testing.T) {
+	tb := setupBot(t)
+	tb.submit(t, &types.HITLRequest{ID: "req-2", Message: "Why?", RequestType: types.RequestTypeInput})
+
+	_, response := tb.interact(t, tb.key, `{"type":3,"data":{"custom_id":"hitl:respond:req-2"},"user":{"id":"u-1"}}`)
+	assert.Equal(t, float64(responseModal), response["type"])
+	assert.Equal(t, "hitl:input:req-2", response["data"].(map[string]interface{})["custom_id"])
+
+	submission := `{"type":5,"data":{"custom_id":"hitl:input:req-2","components":[{"type":1,"components":[{"type":4,"custom_id":"response","value":" Because. "}]}]},"user":{"id":"u-1"}}`
+	_, response = tb.interact(t, tb.key, submission)
+	assert.Equal(t, float64(responseDeferredUpdateMessage), response["type"])
+
+	request, err := tb.manager.GetRequest("req-2")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.Equal(t, "Because.", request.Response)
+	assert.True(t, request.Approved)
+
+	_, response = tb.interact(t, tb.key, submission)
+	assert.Equal(t, notPendingMessage, response["data"].(map[string]interface{})["content"])
+}
+
+func TestBot_VerifiesSignatures(t *testing.T) {
+	tb := setupBot(t)
+	tb.submit(t, &types.HITLRequest{ID: "req-3", Message: "Ship?", Options: []string{"Yes"}})
+
+	status, response := tb.interact(t, tb.key, `{"type":1}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(responsePong), response["type"])
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	status, _ = tb.interact(t, otherKey, `{"type":3,"data":{"custom_id":"hitl:option:req-3:0"},"user":{"id":"u-1"}}`)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	request, err := tb.manager.GetRequest("req-3")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+}
+
+func TestNewBot_RejectsInvalidPublicKey(t *testing.T) {
+	_, err := NewBot("token", "not-hex", "", nil)
+	assert.Error(t, err)
+}
+
+func TestBot_SendRequestErrors(t *testing.T) {
+	tb := setupBot(t)
+	apiServer := httptest.NewServer(&fakeDiscord{})
+	defer apiServer.Close()
+
+	bot, err := NewBot("wrong-token", hex.EncodeToString(make([]byte, ed25519.PublicKeySize)), apiServer.URL, tb.manager)
+	require.NoError(t, err)
+
+	err = bot.SendRequest(&types.HITLRequest{ID: "req-4"}, &types.Session{ID: "s2"})
+	assert.EqualError(t, err, "session s2 has no discord channel")
+
+	err = bot.SendRequest(&types.HITLRequest{ID: "req-4"}, &types.Session{ID: "s1", Recipient: "c-1"})
+	assert.EqualError(t, err, "discord POST /channels/c-1/messages failed: 401: Unauthorized")
+}
@@ -0,0 +1,276 @@
+package discord
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"loopgate/internal/notifier"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const maxInteractionBytes = 1 << 20
+
+// Interaction and interaction response types.
+const (
+	interactionPing             = 1
+	interactionMessageComponent = 3
+	interactionModalSubmit      = 5
+
+	responsePong                  = 1
+	responseChannelMessage        = 4
+	responseDeferredUpdateMessage = 6
+	responseModal                 = 9
+
+	flagEphemeral = 64
+)
+
+const notPendingMessage = "This request is no longer pending; your response was not recorded."
+
+type interactionUser struct {
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	GlobalName string `json:"global_name"`
+}
+
+// interaction is the subset of a Discord interaction Bot handles.
+type interaction struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+	Type      int    `json:"type"`
+	Data struct {
+		CustomID   string `json:"custom_id"`
+		Components []struct {
+			Components []struct {
+				CustomID string `json:"custom_id"`
+				Value    string `json:"value"`
+			} `json:"components"`
+		} `json:"components"`
+	} `json:"data"`
+	// Member is set in guild channels and User in direct messages.
+	Member *struct {
+		User interactionUser `json:"user"`
+	} `json:"member"`
+	User *interactionUser `json:"user"`
+}
+
+func (i *interaction) user() interactionUser {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	if i.User != nil {
+		return *i.User
+	}
+	return interactionUser{}
+}
+
+func (i *interaction) userID() string {
+	return i.user().ID
+}
+
+// responder identifies the Discord user who interacted and the
+// interaction.
+func (i *interaction) responder() *types.Responder {
+	user := i.user()
+	name := user.GlobalName
+	if name == "" {
+		name = user.Username
+	}
+	return &types.Responder{
+		Channel:    ChannelName,
+		UserID:     user.ID,
+		Name:       name,
+		Recipient:  i.ChannelID,
+		PayloadRef: "interaction:" + i.ID,
+	}
+}
+
+// RegisterRoutes implements notifier.WebhookReceiver. Set the Discord
+// application's Interactions Endpoint URL to /discord/interactions.
+func (b *Bot) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/discord/interactions", b.HandleInteraction).Methods("POST")
+}
+
+// HandleInteraction records answers given with buttons and modals. Requests
+// without a valid Ed25519 signature are rejected, which Discord also checks
+// when the endpoint is configured.
+func (b *Bot) HandleInteraction(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxInteractionBytes))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	if !b.verifySignature(r.Header, body) {
+		http.Error(w, "Invalid request signature", http.StatusUnauthorized)
+		return
+	}
+
+	var payload interaction
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "Invalid interaction", http.StatusBadRequest)
+		return
+	}
+
+	switch payload.Type {
+	case interactionPing:
+		writeResponse(w, map[string]interface{}{"type": responsePong})
+	case interactionMessageComponent:
+		writeResponse(w, b.handleComponent(&payload))
+	case interactionModalSubmit:
+		writeResponse(w, b.handleModalSubmit(&payload))
+	default:
+		http.Error(w, "Unsupported interaction type", http.StatusBadRequest)
+	}
+}
+
+// verifySignature checks X-Signature-Ed25519, the signature of the
+// X-Signature-Timestamp header followed by the body.
+func (b *Bot) verifySignature(header http.Header, body []byte) bool {
+	signature, err := hex.DecodeString(header.Get("X-Signature-Ed25519"))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return false
+	}
+	timestamp := header.Get("X-Signature-Timestamp")
+	if timestamp == "" {
+		return false
+	}
+	return ed25519.Verify(b.publicKey, append([]byte(timestamp), body...), signature)
+}
+
+func (b *Bot) handleComponent(payload *interaction) map[string]interface{} {
+	customID := payload.Data.CustomID
+	switch {
+	case strings.HasPrefix(customID, respondCustomIDPrefix):
+		return b.inputModal(strings.TrimPrefix(customID, respondCustomIDPrefix))
+	case strings.HasPrefix(customID, optionCustomIDPrefix):
+		return b.recordOption(payload, strings.TrimPrefix(customID, optionCustomIDPrefix))
+	}
+	return ephemeral("Unknown action.")
+}
+
+// recordOption answers a request with the option whose button was pressed.
+// value is "<request ID>:<option index>".
+func (b *Bot) recordOption(payload *interaction, value string) map[string]interface{} {
+	separator := strings.LastIndex(value, ":")
+	if separator < 0 {
+		return ephemeral("Unknown action.")
+	}
+	requestID := value[:separator]
+	optionIndex, err := strconv.Atoi(value[separator+1:])
+	if err != nil {
+		return ephemeral("Unknown action.")
+	}
+
+	request, err := b.sessionManager.GetRequest(requestID)
+	if err != nil {
+		return ephemeral("Request not found.")
+	}
+	if optionIndex < 0 || optionIndex >= len(request.Options) {
+		return ephemeral("Invalid option.")
+	}
+
+	selectedOption := request.Options[optionIndex]
+	log.Printf("Discord user %s selected '%s' for request %s", payload.userID(), selectedOption, requestID)
+
+	err = b.sessionManager.UpdateRequestResponse(requestID, selectedOption, notifier.OptionApproves(selectedOption), payload.responder())
+	if errors.Is(err, storage.ErrRequestNotPending) {
+		return ephemeral(notPendingMessage)
+	}
+	if refusal := notifier.VoteRefusal(err); refusal != "" {
+		return ephemeral(refusal)
+	}
+	if err != nil {
+		log.Printf("Error updating request %s: %v", requestID, err)
+		return ephemeral("Error recording your response.")
+	}
+
+	// The message itself is edited by NotifyResolved.
+	return map[string]interface{}{"type": responseDeferredUpdateMessage}
+}
+
+// inputModal asks for a free-text answer to requestID.
+func (b *Bot) inputModal(requestID string) map[string]interface{} {
+	request, err := b.sessionManager.GetRequest(requestID)
+	if err != nil {
+		return ephemeral("Request not found.")
+	}
+	if request.Status != types.RequestStatusPending {
+		return ephemeral(notPendingMessage)
+	}
+	// Only requests without options get a modal, and quorum requests always
+	// have options, so there are no approvers to check here.
+
+	return map[string]interface{}{
+		"type": responseModal,
+		"data": map[string]interface{}{
+			"custom_id": inputCustomIDPrefix + request.ID,
+			"title":     "HITL Request",
+			"components": []interface{}{actionRow(map[string]interface{}{
+				"type":        componentTextInput,
+				"custom_id":   inputFieldCustomID,
+				"style":       textInputParagraph,
+				"label":       "Your response",
+				"placeholder": truncate(request.Message, 100),
+				"required":    true,
+			})},
+		},
+	}
+}
+
+// handleModalSubmit records the text entered in the input modal.
+func (b *Bot) handleModalSubmit(payload *interaction) map[string]interface{} {
+	if !strings.HasPrefix(payload.Data.CustomID, inputCustomIDPrefix) {
+		return ephemeral("Unknown action.")
+	}
+	requestID := strings.TrimPrefix(payload.Data.CustomID, inputCustomIDPrefix)
+
+	var response string
+	for _, row := range payload.Data.Components {
+		for _, component := range row.Components {
+			if component.CustomID == inputFieldCustomID {
+				response = strings.TrimSpace(component.Value)
+			}
+		}
+	}
+	if response == "" {
+		return ephemeral("Please enter a response.")
+	}
+
+	log.Printf("Discord user %s answered request %s", payload.userID(), requestID)
+
+	err := b.sessionManager.UpdateRequestResponse(requestID, response, true, payload.responder())
+	if errors.Is(err, storage.ErrRequestNotPending) {
+		return ephemeral(notPendingMessage)
+	}
+	if refusal := notifier.VoteRefusal(err); refusal != "" {
+		return ephemeral(refusal)
+	}
+	if err != nil {
+		log.Printf("Error updating request %s: %v", requestID, err)
+		return ephemeral("Error recording your response.")
+	}
+
+	return map[string]interface{}{"type": responseDeferredUpdateMessage}
+}
+
+// ephemeral is a reply only the interacting user sees.
+func ephemeral(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": responseChannelMessage,
+		"data": map[string]interface{}{"content": text, "flags": flagEphemeral},
+	}
+}
+
+func writeResponse(w http.ResponseWriter, response map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
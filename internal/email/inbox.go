@@ -0,0 +1,202 @@
+package email
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"loopgate/internal/notifier"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Mail drop subdirectories for handled messages.
+const (
+	processedDir = "processed"
+	rejectedDir  = "rejected"
+)
+
+const maxReplyBytes = 1 << 20
+
+// replyReference finds the request ID in our Message-ID as quoted by a
+// reply's In-Reply-To or References header.
+var replyReference = regexp.MustCompile(`<hitl-([^@>]+)@`)
+
+// processInbox records every reply in the mail drop and moves it to the
+// processed directory, or to the rejected directory if it cannot be used.
+func (n *Notifier) processInbox() {
+	paths, err := filepath.Glob(filepath.Join(n.config.InboxDir, "*.eml"))
+	if err != nil {
+		log.Printf("Error listing email inbox: %v", err)
+		return
+	}
+
+	for _, path := range paths {
+		target := processedDir
+		if err := n.processReply(path); err != nil {
+			log.Printf("Ignoring email %s: %v", filepath.Base(path), err)
+			target = rejectedDir
+		}
+
+		dir := filepath.Join(n.config.InboxDir, target)
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			log.Printf("Error creating %s: %v", dir, err)
+			continue
+		}
+		if err := os.Rename(path, filepath.Join(dir, filepath.Base(path))); err != nil {
+			log.Printf("Error moving email %s: %v", filepath.Base(path), err)
+		}
+	}
+}
+
+func (n *Notifier) processReply(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	message, err := mail.ReadMessage(bufio.NewReader(io.LimitReader(file, maxReplyBytes)))
+	if err != nil {
+		return fmt.Errorf("not an email: %w", err)
+	}
+
+	match := replyReference.FindStringSubmatch(message.Header.Get("In-Reply-To") + " " + message.Header.Get("References"))
+	if match == nil {
+		return errors.New("not a reply to a request")
+	}
+	requestID := match[1]
+
+	request, err := n.sessionManager.GetRequest(requestID)
+	if err != nil {
+		return fmt.Errorf("request %s not found", requestID)
+	}
+	if len(request.Options) > 0 {
+		return fmt.Errorf("request %s must be answered with a link", requestID)
+	}
+
+	// Only an address the request was sent to may answer it.
+	sess, err := n.sessionManager.GetSession(request.SessionID)
+	if err != nil {
+		return fmt.Errorf("session %s not found", request.SessionID)
+	}
+	from, err := mail.ParseAddress(message.Header.Get("From"))
+	if err != nil || !isRecipient(sess, request, from.Address) {
+		return fmt.Errorf("sender %q is not the recipient of request %s", message.Header.Get("From"), requestID)
+	}
+
+	body, err := plainTextBody(message.Header.Get("Content-Type"), message.Header.Get("Content-Transfer-Encoding"), message.Body)
+	if err != nil {
+		return err
+	}
+	response := stripQuotedReply(body)
+	if response == "" {
+		return errors.New("reply is empty")
+	}
+
+	log.Printf("Email reply from %s answered request %s", from.Address, requestID)
+
+	err = n.sessionManager.UpdateRequestResponse(requestID, response, true, &types.Responder{
+		Channel:    ChannelName,
+		UserID:     from.Address,
+		Name:       from.Name,
+		Recipient:  from.Address,
+		PayloadRef: "message_id:" + message.Header.Get("Message-ID"),
+	})
+	if errors.Is(err, storage.ErrRequestNotPending) {
+		return fmt.Errorf("request %s is no longer pending", requestID)
+	}
+	return err
+}
+
+// isRecipient reports whether request was emailed to address, as one of
+// sess's targets or on escalation.
+func isRecipient(sess *types.Session, request *types.HITLRequest, address string) bool {
+	targets := notifier.TargetsOf(sess)
+	for _, step := range request.Escalation[:request.EscalationLevel] {
+		targets = append(targets, step.Targets...)
+	}
+	for _, target := range targets {
+		if target.Channel != ChannelName {
+			continue
+		}
+		recipient, err := mail.ParseAddress(target.Recipient)
+		if err == nil && strings.EqualFold(recipient.Address, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// plainTextBody returns the text/plain content of a message body, decoding
+// its transfer encoding and descending into multipart bodies.
+func plainTextBody(contentType, transferEncoding string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if contentType == "" {
+		mediaType, err = "text/plain", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid content type: %w", err)
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return "", errors.New("no text/plain part")
+			}
+			if err != nil {
+				return "", err
+			}
+			// multipart.Reader already decodes quoted-printable parts.
+			text, err := plainTextBody(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err == nil {
+				return text, nil
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", fmt.Errorf("unsupported content type %s", mediaType)
+	}
+
+	switch strings.ToLower(transferEncoding) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxReplyBytes))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// stripQuotedReply keeps the text written above the quoted original: it
+// stops at the first quoted line, an "On ... wrote:" attribution or a
+// signature separator.
+func stripQuotedReply(body string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ">") || line == "-- " ||
+			(strings.HasPrefix(trimmed, "On ") && strings.HasSuffix(trimmed, "wrote:")) ||
+			strings.HasPrefix(trimmed, "-----Original Message-----") {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,201 @@
+package email
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"loopgate/internal/notifier"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var errInvalidToken = errors.New("invalid or tampered link")
+
+// answerToken is the content of a signed answer link.
+type answerToken struct {
+	RequestID   string
+	OptionIndex int
+	ExpiresAt   time.Time
+}
+
+// signToken returns "<payload>.<signature>", both base64url encoded, where
+// the payload is "<request ID>:<option index>:<expiry unix seconds>".
+func signToken(secret, requestID string, optionIndex int, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%s:%d:%d", requestID, optionIndex, expiresAt.Unix())
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(tokenMAC(secret, payload))
+}
+
+func tokenMAC(secret, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// parseToken verifies token and decodes it. Expiry is checked by the caller.
+func parseToken(secret, token string) (*answerToken, error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(signature, tokenMAC(secret, string(payload))) {
+		return nil, errInvalidToken
+	}
+
+	parts := strings.Split(string(payload), ":")
+	if len(parts) != 3 {
+		return nil, errInvalidToken
+	}
+	optionIndex, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	return &answerToken{RequestID: parts[0], OptionIndex: optionIndex, ExpiresAt: time.Unix(expiresAt, 0)}, nil
+}
+
+// RegisterRoutes implements notifier.WebhookReceiver. The links carry their
+// own signature, so no API key is needed.
+func (n *Notifier) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/email/answer", n.ShowAnswer).Methods("GET")
+	router.HandleFunc("/email/answer", n.RecordAnswer).Methods("POST")
+}
+
+// ShowAnswer asks the approver to confirm the answer a link stands for.
+// Opening a link never records anything, because mail scanners fetch links
+// before the human clicks them.
+func (n *Notifier) ShowAnswer(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	request, option, status := n.resolveToken(token)
+	if status != http.StatusOK {
+		renderPage(w, status, answerPage{Title: http.StatusText(status), Text: pageText(status, request)})
+		return
+	}
+
+	renderPage(w, http.StatusOK, answerPage{
+		Title:   "Confirm your answer",
+		Text:    request.Message,
+		Option:  option,
+		Token:   token,
+		Confirm: true,
+	})
+}
+
+// RecordAnswer records the answer of a confirmed link. A request can be
+// answered only once, so every link stops working after the first answer.
+func (n *Notifier) RecordAnswer(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	request, option, status := n.resolveToken(token)
+	if status != http.StatusOK {
+		renderPage(w, status, answerPage{Title: http.StatusText(status), Text: pageText(status, request)})
+		return
+	}
+
+	log.Printf("Email answer '%s' for request %s", option, request.ID)
+
+	// Links work for whoever holds them, so the approver is not known.
+	err := n.sessionManager.UpdateRequestResponse(request.ID, option, notifier.OptionApproves(option), &types.Responder{Channel: ChannelName})
+	if errors.Is(err, storage.ErrRequestNotPending) {
+		renderPage(w, http.StatusGone, answerPage{Title: http.StatusText(http.StatusGone), Text: pageText(http.StatusGone, request)})
+		return
+	}
+	if errors.Is(err, storage.ErrNotApprover) {
+		renderPage(w, http.StatusForbidden, answerPage{Title: http.StatusText(http.StatusForbidden),
+			Text: "This request needs votes from named approvers, and a link cannot tell who you are. Please answer it on another channel."})
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating request %s: %v", request.ID, err)
+		renderPage(w, http.StatusInternalServerError, answerPage{Title: "Error", Text: "Your answer could not be recorded. Please try again."})
+		return
+	}
+
+	renderPage(w, http.StatusOK, answerPage{Title: "Response recorded", Text: request.Message, Option: option})
+}
+
+// resolveToken returns the request and option a token answers with, or the
+// HTTP status explaining why it cannot be used.
+func (n *Notifier) resolveToken(token string) (*types.HITLRequest, string, int) {
+	parsed, err := parseToken(n.config.LinkSecret, token)
+	if err != nil {
+		return nil, "", http.StatusBadRequest
+	}
+
+	request, err := n.sessionManager.GetRequest(parsed.RequestID)
+	if err != nil {
+		return nil, "", http.StatusNotFound
+	}
+	if parsed.OptionIndex < 0 || parsed.OptionIndex >= len(request.Options) {
+		return nil, "", http.StatusBadRequest
+	}
+	if request.Status != types.RequestStatusPending || time.Now().After(parsed.ExpiresAt) {
+		return request, "", http.StatusGone
+	}
+	return request, request.Options[parsed.OptionIndex], http.StatusOK
+}
+
+func pageText(status int, request *types.HITLRequest) string {
+	switch status {
+	case http.StatusGone:
+		if request != nil && request.Status == types.RequestStatusCompleted {
+			return fmt.Sprintf("This request has already been answered: %s", request.Response)
+		}
+		return "This request is no longer pending; your answer was not recorded."
+	case http.StatusNotFound:
+		return "This request does not exist."
+	default:
+		return "This link is invalid. Please use the link from the email exactly as it was sent."
+	}
+}
+
+type answerPage struct {
+	Title   string
+	Text    string
+	Option  string
+	Token   string
+	Confirm bool
+}
+
+var answerTemplate = template.Must(template.New("answer").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Loopgate: {{.Title}}</title></head>
+<body style="font-family: sans-serif; max-width: 40em; margin: 2em auto; padding: 0 1em;">
+<h1>{{.Title}}</h1>
+<p style="white-space: pre-wrap;">{{.Text}}</p>
+{{if .Option}}<p>Answer: <strong>{{.Option}}</strong></p>{{end}}
+{{if .Confirm}}<form method="post" action="answer">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit" style="font-size: 1.2em; padding: 0.5em 1.5em;">Confirm</button>
+</form>{{end}}
+</body>
+</html>
+`))
+
+func renderPage(w http.ResponseWriter, status int, page answerPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(status)
+	if err := answerTemplate.Execute(w, page); err != nil {
+		log.Printf("Error rendering email answer page: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"loopgate/internal/session"
+	"loopgate/internal/types"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChannelName is the session channel served by Notifier.
+const ChannelName = "email"
+
+// Config configures the email channel.
+type Config struct {
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string // Optional; enables PLAIN auth
+	SMTPPassword string
+	From         string // Sender address, e.g. "Loopgate <loopgate@example.com>"
+	// PublicURL is the base URL approvers' browsers use to reach this server;
+	// answer links point at PublicURL + "/email/answer".
+	PublicURL string
+	// LinkSecret signs answer links.
+	LinkSecret string
+	// InboxDir is a mail drop: a directory an MTA or fetchmail writes replies
+	// to, one RFC 5322 message per *.eml file. Replies are not read if empty.
+	InboxDir          string
+	InboxPollInterval time.Duration
+}
+
+// maxLinkLifetime bounds answer links of requests without a timeout.
+const maxLinkLifetime = 7 * 24 * time.Hour
+
+// sendFunc matches smtp.SendMail.
+type sendFunc func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+
+// Notifier emails HITL requests with one signed answer link per option and
+// records answers from those links or, for input requests, from replies
+// found in the mail drop. It implements notifier.Notifier and
+// notifier.WebhookReceiver.
+type Notifier struct {
+	config         Config
+	from           *mail.Address
+	sessionManager *session.Manager
+	send           sendFunc
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewNotifier validates config and creates an email notifier.
+func NewNotifier(config Config, sessionManager *session.Manager) (*Notifier, error) {
+	if config.SMTPHost == "" {
+		return nil, fmt.Errorf("SMTP host is required")
+	}
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", config.From, err)
+	}
+	if _, err := url.ParseRequestURI(config.PublicURL); err != nil {
+		return nil, fmt.Errorf("invalid public URL %q: %w", config.PublicURL, err)
+	}
+	if config.LinkSecret == "" {
+		return nil, fmt.Errorf("link secret is required")
+	}
+	if config.SMTPPort == "" {
+		config.SMTPPort = "587"
+	}
+	if config.InboxPollInterval <= 0 {
+		config.InboxPollInterval = 30 * time.Second
+	}
+	config.PublicURL = strings.TrimRight(config.PublicURL, "/")
+
+	return &Notifier{
+		config:         config,
+		from:           from,
+		sessionManager: sessionManager,
+		send:           smtp.SendMail,
+		stop:           make(chan struct{}),
+	}, nil
+}
+
+// Channel implements notifier.Notifier.
+func (n *Notifier) Channel() string {
+	return ChannelName
+}
+
+// Start reads replies from the mail drop until Stop is called. It returns
+// at once if no mail drop is configured.
+func (n *Notifier) Start() {
+	if n.config.InboxDir == "" {
+		log.Println("Email notifier ready; no inbox configured, so only answer links are accepted")
+		return
+	}
+
+	log.Printf("Email notifier reading replies from %s", n.config.InboxDir)
+	ticker := time.NewTicker(n.config.InboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		n.processInbox()
+		select {
+		case <-ticker.C:
+		case <-n.stop:
+			return
+		}
+	}
+}
+
+// Stop ends Start.
+func (n *Notifier) Stop() {
+	n.stopOnce.Do(func() { close(n.stop) })
+}
+
+// SendRequest emails request to the session's address.
+func (n *Notifier) SendRequest(request *types.HITLRequest, sess *types.Session) error {
+	to, err := mail.ParseAddress(sess.Recipient)
+	if err != nil {
+		return fmt.Errorf("session %s has no valid email recipient: %w", sess.ID, err)
+	}
+
+	message, err := n.composeRequest(request, to)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(n.config.SMTPHost, n.config.SMTPPort)
+	var auth smtp.Auth
+	if n.config.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", n.config.SMTPUsername, n.config.SMTPPassword, n.config.SMTPHost)
+	}
+	if err := n.send(addr, auth, n.from.Address, []string{to.Address}, message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	request.ChannelMsgID = n.messageID(request.ID)
+	if err := n.sessionManager.SetChannelMsgID(request.ID, request.ChannelMsgID); err != nil {
+		log.Printf("Failed to store email message ID for request %s: %v", request.ID, err)
+	}
+	return nil
+}
+
+// NotifyResolved implements notifier.Notifier. A sent email cannot be
+// edited; answer links show the outcome once the request is resolved.
+func (n *Notifier) NotifyResolved(request *types.HITLRequest, sess *types.Session) error {
+	return nil
+}
+
+// messageID is the Message-ID of the email for requestID. Replies quote it
+// in In-Reply-To, which is how they are matched to the request.
+func (n *Notifier) messageID(requestID string) string {
+	domain := n.from.Address[strings.LastIndex(n.from.Address, "@")+1:]
+	return fmt.Sprintf("<hitl-%s@%s>", requestID, domain)
+}
+
+func (n *Notifier) composeRequest(request *types.HITLRequest, to *mail.Address) ([]byte, error) {
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s\n\n", request.Message)
+	fmt.Fprintf(&body, "Request ID: %s\nClient: %s\nSession: %s\n\n", request.ID, request.ClientID, request.SessionID)
+
+	expiresAt := request.CreatedAt.Add(time.Duration(request.Timeout) * time.Second)
+	if request.Timeout <= 0 {
+		expiresAt = time.Now().Add(maxLinkLifetime)
+	}
+	if len(request.Options) > 0 {
+		body.WriteString("Choose an answer:\n\n")
+		for i, option := range request.Options {
+			token := signToken(n.config.LinkSecret, request.ID, i, expiresAt)
+			fmt.Fprintf(&body, "  %s:\n  %s/email/answer?token=%s\n\n", option, n.config.PublicURL, token)
+		}
+	} else {
+		body.WriteString("Reply to this email with your response. Only the text above the quoted message is recorded.\n\n")
+	}
+	if request.Timeout > 0 {
+		fmt.Fprintf(&body, "This request expires at %s.\n", expiresAt.UTC().Format(time.RFC1123))
+	}
+
+	var encoded bytes.Buffer
+	writer := quotedprintable.NewWriter(&encoded)
+	if _, err := writer.Write([]byte(body.String())); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	subject := "HITL Request: " + strings.Join(strings.Fields(request.Message), " ")
+	if runes := []rune(subject); len(runes) > 78 {
+		subject = string(runes[:77]) + "…"
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", n.from.String())
+	fmt.Fprintf(&message, "To: %s\r\n", to.String())
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Message-ID: %s\r\n", n.messageID(request.ID))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	message.Write(encoded.Bytes())
+	return message.Bytes(), nil
+}
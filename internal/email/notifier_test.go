@@ -0,0 +1,231 @@
+package email
+
+import (
+	"io"
+	"loopgate/internal/notifier"
+	"loopgate/internal/session"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"mime/quotedprintable"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sentMail struct {
+	addr string
+	from string
+	to   []string
+	msg  []byte
+}
+
+type testNotifier struct {
+	*Notifier
+	manager  *session.Manager
+	registry *notifier.Registry
+	server   *httptest.Server
+	sent     []sentMail
+}
+
+func setupNotifier(t *testing.T) *testNotifier {
+	t.Helper()
+	manager := session.NewManager(storage.NewInMemoryStorageAdapter())
+	router := mux.NewRouter()
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	n, err := NewNotifier(Config{
+		SMTPHost:   "smtp.example.com",
+		From:       "Loopgate <loopgate@example.com>",
+		PublicURL:  server.URL + "/",
+		LinkSecret: "link-secret",
+		InboxDir:   t.TempDir(),
+	}, manager)
+	require.NoError(t, err)
+
+	tn := &testNotifier{Notifier: n, manager: manager, server: server}
+	n.send = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		tn.sent = append(tn.sent, sentMail{addr: addr, from: from, to: to, msg: msg})
+		return nil
+	}
+
+	tn.registry = notifier.NewRegistry(manager)
+	tn.registry.Register(n)
+	tn.registry.RegisterRoutes(router)
+
+	require.NoError(t, manager.CreateSession(&types.Session{ID: "s1", ClientID: "agent", Channel: ChannelName, Recipient: "Ada <ada@example.com>"}))
+	return tn
+}
+
+func (tn *testNotifier) submit(t *testing.T, request *types.HITLRequest) {
+	t.Helper()
+	request.SessionID = "s1"
+	request.ClientID = "agent"
+	request.Status = types.RequestStatusPending
+	request.CreatedAt = time.Now()
+	request.Timeout = 300
+	require.NoError(t, tn.manager.StoreRequest(request))
+	require.NoError(t, tn.registry.Send(request))
+}
+
+// lastMail returns the headers and decoded body of the last email sent.
+func (tn *testNotifier) lastMail(t *testing.T) (mail.Header, string) {
+	t.Helper()
+	require.NotEmpty(t, tn.sent)
+	message, err := mail.ReadMessage(strings.NewReader(string(tn.sent[len(tn.sent)-1].msg)))
+	require.NoError(t, err)
+	body, err := io.ReadAll(quotedprintable.NewReader(message.Body))
+	require.NoError(t, err)
+	return message.Header, string(body)
+}
+
+var answerLink = regexp.MustCompile(`http://\S+/email/answer\?token=\S+`)
+
+func TestNotifier_AnswerLinks(t *testing.T) {
+	tn := setupNotifier(t)
+	tn.submit(t, &types.HITLRequest{ID: "req-1", Message: "Deploy to production?", Options: []string{"Approve", "Reject"}})
+
+	require.Len(t, tn.sent, 1)
+	assert.Equal(t, "smtp.example.com:587", tn.sent[0].addr)
+	assert.Equal(t, []string{"ada@example.com"}, tn.sent[0].to)
+
+	header, body := tn.lastMail(t)
+	assert.Equal(t, "<hitl-req-1@example.com>", header.Get("Message-ID"))
+	assert.Contains(t, body, "Deploy to production?")
+	links := answerLink.FindAllString(body, -1)
+	require.Len(t, links, 2)
+
+	// Opening the link only asks for confirmation
+	resp, err := http.Get(links[1])
+	require.NoError(t, err)
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(page), "<strong>Reject</strong>")
+
+	request, err := tn.manager.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+
+	token := strings.TrimPrefix(links[1][strings.Index(links[1], "?"):], "?token=")
+	resp, err = http.PostForm(tn.server.URL+"/email/answer", url.Values{"token": {token}})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	request, err = tn.manager.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.Equal(t, "Reject", request.Response)
+	assert.False(t, request.Approved)
+
+	// Every link stops working after the first answer
+	for _, link := range links {
+		resp, err = http.Get(link)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusGone, resp.StatusCode)
+	}
+	resp, err = http.PostForm(tn.server.URL+"/email/answer", url.Values{"token": {token}})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+}
+
+func TestNotifier_RejectsTamperedAndExpiredTokens(t *testing.T) {
+	tn := setupNotifier(t)
+	tn.submit(t, &types.HITLRequest{ID: "req-2", Message: "Ship?", Options: []string{"Yes", "No"}})
+
+	for name, token := range map[string]string{
+		"forged":    signToken("wrong-secret", "req-2", 0, time.Now().Add(time.Hour)),
+		"garbage":   "not-a-token",
+		"bad index": signToken("link-secret", "req-2", 7, time.Now().Add(time.Hour)),
+	} {
+		resp, err := http.PostForm(tn.server.URL+"/email/answer", url.Values{"token": {token}})
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, name)
+	}
+
+	expired := signToken("link-secret", "req-2", 0, time.Now().Add(-time.Second))
+	resp, err := http.PostForm(tn.server.URL+"/email/answer", url.Values{"token": {expired}})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+	request, err := tn.manager.GetRequest("req-2")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+}
+
+func writeReply(t *testing.T, dir, name, from, inReplyTo, body string) {
+	t.Helper()
+	message := "From: " + from + "\r\n" +
+		"To: loopgate@example.com\r\n" +
+		"Subject: Re: HITL Request\r\n" +
+		"In-Reply-To: " + inReplyTo + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n" + body
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(message), 0o600))
+}
+
+func TestNotifier_InboxReplies(t *testing.T) {
+	tn := setupNotifier(t)
+	tn.submit(t, &types.HITLRequest{ID: "req-3", Message: "Which region?", RequestType: types.RequestTypeInput})
+
+	_, body := tn.lastMail(t)
+	assert.Contains(t, body, "Reply to this email")
+	assert.NotContains(t, body, "/email/answer")
+
+	inbox := tn.config.InboxDir
+	writeReply(t, inbox, "1.eml", "mallory@example.com", "<hitl-req-3@example.com>", "us-west-2")
+	writeReply(t, inbox, "2.eml", "ADA@example.com", "<hitl-req-3@example.com>",
+		"eu-central-1\r\nthanks\r\n\r\nOn Mon, Jan 1, 2024 Loopgate wrote:\r\n> Which region?\r\n")
+	writeReply(t, inbox, "3.eml", "ada@example.com", "<unrelated@example.com>", "hello")
+
+	tn.processInbox()
+
+	request, err := tn.manager.GetRequest("req-3")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.Equal(t, "eu-central-1\nthanks", request.Response)
+
+	processed, _ := filepath.Glob(filepath.Join(inbox, processedDir, "*.eml"))
+	rejected, _ := filepath.Glob(filepath.Join(inbox, rejectedDir, "*.eml"))
+	remaining, _ := filepath.Glob(filepath.Join(inbox, "*.eml"))
+	assert.Equal(t, []string{filepath.Join(inbox, processedDir, "2.eml")}, processed)
+	assert.Len(t, rejected, 2, "replies from other senders and unrelated mail are rejected")
+	assert.Empty(t, remaining)
+}
+
+func TestPlainTextBody_Multipart(t *testing.T) {
+	body := "--b1\r\n" +
+		"Content-Type: text/html\r\n\r\n<p>ignored</p>\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\n" +
+		"caf=C3=A9 ok\r\n" +
+		"--b1--\r\n"
+
+	text, err := plainTextBody(`multipart/alternative; boundary="b1"`, "", strings.NewReader(body))
+	require.NoError(t, err)
+	assert.Equal(t, "café ok", strings.TrimSpace(text))
+}
+
+func TestNewNotifier_Validation(t *testing.T) {
+	_, err := NewNotifier(Config{SMTPHost: "smtp", From: "not an address", PublicURL: "https://x", LinkSecret: "s"}, nil)
+	assert.Error(t, err)
+	_, err = NewNotifier(Config{SMTPHost: "smtp", From: "a@b.c", PublicURL: "https://x"}, nil)
+	assert.EqualError(t, err, "link secret is required")
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"loopgate/internal/auth"
+	"loopgate/internal/middleware"
 	"loopgate/internal/storage"
 	"loopgate/internal/types"
 
@@ -150,7 +151,7 @@ func (h *AuthHandlers) LoginUserHandler(w http.ResponseWriter, r *http.Request)
 // Helper to extract user ID from JWT claims in context (to be used by other handlers)
 // This would typically be set by a JWT authentication middleware.
 func GetUserClaimsFromContext(r *http.Request) (*types.Claims, error) {
-	claims, ok := r.Context().Value("userClaims").(*types.Claims)
+	claims, ok := r.Context().Value(middleware.UserClaimsContextKey).(*types.Claims)
 	if !ok || claims == nil {
 		return nil, errors.New("user claims not found in context, ensure JWTAuthMiddleware is used")
 	}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"loopgate/internal/notifier"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// ConsoleChannel names the web console as the channel of its answers.
+const ConsoleChannel = "console"
+
+// Console history page sizes.
+const (
+	defaultConsoleLimit = 50
+	maxConsoleLimit     = 200
+)
+
+// ConsoleResponse answers a request from the web console. Requests with
+// options must be answered with one of them, which decides Approved. For
+// other requests Approved defaults to true.
+type ConsoleResponse struct {
+	Response string `json:"response"`
+	Approved *bool  `json:"approved,omitempty"`
+}
+
+// RegisterConsoleRoutes adds the JSON API behind the web approval console.
+// router must authenticate users with JWTAuthMiddleware; every route is
+// scoped to the logged-in user.
+func (h *HITLHandler) RegisterConsoleRoutes(router *mux.Router) {
+	router.HandleFunc("/requests", h.ListConsoleRequests).Methods("GET")
+	router.HandleFunc("/requests/{request_id}", h.GetConsoleRequest).Methods("GET")
+	router.HandleFunc("/requests/{request_id}/respond", h.RespondToRequest).Methods("POST")
+	router.HandleFunc("/requests/{request_id}/cancel", h.CancelConsoleRequest).Methods("POST")
+}
+
+// ListConsoleRequests lists the user's requests, newest first. With
+// status=pending only pending requests are listed; otherwise up to limit
+// requests in any status.
+// GET /api/console/requests?status=pending&limit=50
+func (h *HITLHandler) ListConsoleRequests(w http.ResponseWriter, r *http.Request) {
+	var requests []*types.HITLRequest
+	var err error
+
+	if r.URL.Query().Get("status") == string(types.RequestStatusPending) {
+		requests, err = h.sessionManager.GetPendingRequestsByUser(requestUserID(r))
+	} else {
+		limit := defaultConsoleLimit
+		if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+			limit, err = strconv.Atoi(limitParam)
+			if err != nil || limit <= 0 {
+				http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+				return
+			}
+			if limit > maxConsoleLimit {
+				limit = maxConsoleLimit
+			}
+		}
+		requests, err = h.sessionManager.ListRequestsByUser(requestUserID(r), limit)
+	}
+	if err != nil {
+		log.Printf("Error listing requests: %v", err)
+		http.Error(w, "Error retrieving requests", http.StatusInternalServerError)
+		return
+	}
+	if requests == nil {
+		requests = []*types.HITLRequest{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"requests": requests,
+		"count":    len(requests),
+	})
+}
+
+// GetConsoleRequest returns one of the user's requests with its metadata.
+// GET /api/console/requests/{request_id}
+func (h *HITLHandler) GetConsoleRequest(w http.ResponseWriter, r *http.Request) {
+	request, err := h.sessionManager.GetUserRequest(requestUserID(r), mux.Vars(r)["request_id"])
+	if err != nil {
+		http.Error(w, "Request not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(request)
+}
+
+// RespondToRequest answers one of the user's pending requests.
+// POST /api/console/requests/{request_id}/respond
+func (h *HITLHandler) RespondToRequest(w http.ResponseWriter, r *http.Request) {
+	var body ConsoleResponse
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	request, err := h.sessionManager.GetUserRequest(requestUserID(r), mux.Vars(r)["request_id"])
+	if err != nil {
+		http.Error(w, "Request not found", http.StatusNotFound)
+		return
+	}
+
+	approved := true
+	if len(request.Options) > 0 {
+		valid := false
+		for _, option := range request.Options {
+			valid = valid || option == body.Response
+		}
+		if !valid {
+			http.Error(w, "Response must be one of the request's options", http.StatusBadRequest)
+			return
+		}
+		approved = notifier.OptionApproves(body.Response)
+	} else {
+		if body.Response == "" {
+			http.Error(w, "Missing response", http.StatusBadRequest)
+			return
+		}
+		if body.Approved != nil {
+			approved = *body.Approved
+		}
+	}
+
+	responder := &types.Responder{Channel: ConsoleChannel, UserID: requestUserID(r)}
+	if claims, err := GetUserClaimsFromContext(r); err == nil {
+		responder.Name = claims.Username
+	}
+
+	err = h.sessionManager.UpdateRequestResponse(request.ID, body.Response, approved, responder)
+	if errors.Is(err, storage.ErrRequestNotPending) {
+		http.Error(w, "Request is no longer pending", http.StatusConflict)
+		return
+	}
+	if refusal := notifier.VoteRefusal(err); refusal != "" {
+		http.Error(w, refusal, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating request %s: %v", request.ID, err)
+		http.Error(w, "Failed to record response", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Console user %s answered request %s", responder.Name, request.ID)
+
+	updated, err := h.sessionManager.GetRequest(request.ID)
+	if err != nil {
+		updated = request
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// CancelConsoleRequest cancels one of the user's pending requests.
+// POST /api/console/requests/{request_id}/cancel
+func (h *HITLHandler) CancelConsoleRequest(w http.ResponseWriter, r *http.Request) {
+	request, err := h.sessionManager.GetUserRequest(requestUserID(r), mux.Vars(r)["request_id"])
+	if err != nil {
+		http.Error(w, "Request not found", http.StatusNotFound)
+		return
+	}
+
+	err = h.sessionManager.CancelRequest(request.ID)
+	if errors.Is(err, storage.ErrRequestNotPending) {
+		http.Error(w, "Request is no longer pending", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error canceling request %s: %v", request.ID, err)
+		http.Error(w, "Failed to cancel request", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,29 +1,53 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"loopgate/internal/middleware"
+	"loopgate/internal/notifier"
 	"loopgate/internal/session"
-	"loopgate/internal/telegram"
+	"loopgate/internal/storage"
 	"loopgate/internal/types"
 	"net/http"
+	"strconv"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
+// maxPollWait caps the wait parameter of /hitl/poll.
+const maxPollWait = 120 * time.Second
+
+// streamKeepAlive is how often /hitl/stream sends a comment line so proxies
+// do not close an idle connection.
+const streamKeepAlive = 15 * time.Second
+
 type HITLHandler struct {
 	sessionManager *session.Manager
-	telegramBot    *telegram.Bot
+	notifiers      *notifier.Registry
 }
 
-func NewHITLHandler(sessionManager *session.Manager, telegramBot *telegram.Bot) *HITLHandler {
+func NewHITLHandler(sessionManager *session.Manager, notifiers *notifier.Registry) *HITLHandler {
 	return &HITLHandler{
 		sessionManager: sessionManager,
-		telegramBot:    telegramBot,
+		notifiers:      notifiers,
+	}
+}
+
+// requestUserID returns the owner of the API key that authenticated r, or
+// the logged-in user for console routes. Sessions and requests are only
+// visible to the user that created them.
+func requestUserID(r *http.Request) string {
+	if userID := middleware.APIKeyUserID(r.Context()); userID != "" {
+		return userID
+	}
+	if claims, err := GetUserClaimsFromContext(r); err == nil {
+		return claims.UserID.String()
 	}
+	return ""
 }
 
 func (h *HITLHandler) RegisterRoutes(router *mux.Router) {
@@ -34,6 +58,17 @@ func (h *HITLHandler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/hitl/deactivate", h.DeactivateSession).Methods("POST")
 	router.HandleFunc("/hitl/pending", h.ListPendingRequests).Methods("GET")
 	router.HandleFunc("/hitl/cancel", h.CancelRequest).Methods("POST")
+	router.HandleFunc("/hitl/deliveries", h.ListWebhookDeliveries).Methods("GET")
+	router.HandleFunc("/hitl/stream", h.StreamEvents).Methods("GET")
+}
+
+// RegisterChannelRoutes adds the callback routes of the configured
+// notification channels. They authenticate with the channel's own signature
+// rather than an API key.
+func (h *HITLHandler) RegisterChannelRoutes(router *mux.Router) {
+	if h.notifiers != nil {
+		h.notifiers.RegisterRoutes(router)
+	}
 }
 
 func (h *HITLHandler) RegisterSession(w http.ResponseWriter, r *http.Request) {
@@ -44,18 +79,45 @@ func (h *HITLHandler) RegisterSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.SessionID == "" || req.ClientID == "" || req.TelegramID == 0 {
+	if req.Channel == "" {
+		req.Channel = notifier.DefaultChannel
+	}
+
+	if req.SessionID == "" || req.ClientID == "" {
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
+	for i := range req.Targets {
+		if req.Targets[i].Channel == "" {
+			req.Targets[i].Channel = notifier.DefaultChannel
+		}
+	}
+	targets := append([]types.ChannelTarget{{Channel: req.Channel, TelegramID: req.TelegramID, Recipient: req.Recipient}}, req.Targets...)
+	for _, target := range targets {
+		if err := h.notifiers.ValidateTarget(target); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
-	err := h.sessionManager.RegisterSession(req.SessionID, req.ClientID, req.TelegramID)
+	err := h.sessionManager.CreateSession(&types.Session{
+		ID:         req.SessionID,
+		ClientID:   req.ClientID,
+		TelegramID: req.TelegramID,
+		Channel:    req.Channel,
+		Recipient:  req.Recipient,
+		Targets:    req.Targets,
+		UserID:     requestUserID(r),
+
+		TelegramAllowedUsers: req.TelegramAllowedUsers,
+		TelegramAdminsOnly:   req.TelegramAdminsOnly,
+	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to register session: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Registered session: %s for client: %s", req.SessionID, req.ClientID)
+	log.Printf("Registered session: %s for client: %s on %s", req.SessionID, req.ClientID, req.Channel)
 
 	response := map[string]interface{}{
 		"success":    true,
@@ -75,44 +137,18 @@ func (h *HITLHandler) SubmitRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.SessionID == "" || req.ClientID == "" || req.Message == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
-		return
-	}
-
-	req.ID = uuid.New().String()
-	req.Status = types.RequestStatusPending
-	req.CreatedAt = time.Now()
-	
-	if req.Timeout == 0 {
-		req.Timeout = 300
-	}
-
-	if req.RequestType == "" {
-		if len(req.Options) > 0 {
-			req.RequestType = types.RequestTypeChoice
-		} else {
-			req.RequestType = types.RequestTypeInput
+	req.UserID = requestUserID(r)
+
+	if err := h.sessionManager.Submit(&req, h.notifiers); err != nil {
+		switch {
+		case errors.Is(err, session.ErrInvalidRequest):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, session.ErrUnknownSession):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			log.Printf("Failed to submit request %s: %v", req.ID, err)
+			http.Error(w, "Failed to submit request", http.StatusInternalServerError)
 		}
-	}
-
-	session, err := h.sessionManager.GetSession(req.SessionID)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Session not found: %v", err), http.StatusNotFound)
-		return
-	}
-
-	if !session.Active {
-		http.Error(w, "Session is not active", http.StatusBadRequest)
-		return
-	}
-
-	h.sessionManager.StoreRequest(&req)
-
-	err = h.telegramBot.SendHITLRequest(&req)
-	if err != nil {
-		log.Printf("Failed to send telegram message: %v", err)
-		http.Error(w, "Failed to send request to Telegram", http.StatusInternalServerError)
 		return
 	}
 
@@ -129,6 +165,9 @@ func (h *HITLHandler) SubmitRequest(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// PollRequest returns the current state of a request. With a wait parameter
+// (seconds, capped at maxPollWait) it long-polls: a pending request is held
+// until it is answered, canceled or times out, or until the wait elapses.
 func (h *HITLHandler) PollRequest(w http.ResponseWriter, r *http.Request) {
 	requestID := r.URL.Query().Get("request_id")
 	if requestID == "" {
@@ -136,22 +175,47 @@ func (h *HITLHandler) PollRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	request, err := h.sessionManager.GetRequest(requestID)
+	var wait time.Duration
+	if waitParam := r.URL.Query().Get("wait"); waitParam != "" {
+		seconds, err := strconv.Atoi(waitParam)
+		if err != nil || seconds < 0 {
+			http.Error(w, "Invalid wait parameter: must be a non-negative number of seconds", http.StatusBadRequest)
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+		if wait > maxPollWait {
+			wait = maxPollWait
+		}
+	}
+
+	request, err := h.sessionManager.GetUserRequest(requestUserID(r), requestID)
 	if err != nil {
 		http.Error(w, "Request not found", http.StatusNotFound)
 		return
 	}
 
-	response := types.PollResponse{
-		RequestID: requestID,
-		Status:    request.Status,
-		Response:  request.Response,
-		Approved:  request.Approved,
-		Completed: request.Status == types.RequestStatusCompleted ||
-		          request.Status == types.RequestStatusTimeout ||
-		          request.Status == types.RequestStatusCanceled,
+	if wait > 0 && request.Status == types.RequestStatusPending {
+		// Outlive the server-wide write timeout for the length of the wait.
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + 10*time.Second)); err != nil {
+			log.Printf("Could not extend write deadline for long poll: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), wait)
+		defer cancel()
+
+		request, err = h.sessionManager.WaitForResolution(ctx, requestID)
+		if r.Context().Err() != nil {
+			return // client went away
+		}
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("Error waiting for request %s: %v", requestID, err)
+			http.Error(w, "Error waiting for request", http.StatusInternalServerError)
+			return
+		}
 	}
 
+	response := types.NewPollResponse(request)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
@@ -163,7 +227,7 @@ func (h *HITLHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, err := h.sessionManager.GetSession(sessionID)
+	session, err := h.sessionManager.GetUserSession(requestUserID(r), sessionID)
 	if err != nil {
 		http.Error(w, "Session not found", http.StatusNotFound)
 		return
@@ -188,6 +252,11 @@ func (h *HITLHandler) DeactivateSession(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if _, err := h.sessionManager.GetUserSession(requestUserID(r), req.SessionID); err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
 	err := h.sessionManager.DeactivateSession(req.SessionID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to deactivate session: %v", err), http.StatusInternalServerError)
@@ -206,7 +275,7 @@ func (h *HITLHandler) DeactivateSession(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *HITLHandler) ListPendingRequests(w http.ResponseWriter, r *http.Request) {
-	pending, err := h.sessionManager.GetPendingRequests()
+	pending, err := h.sessionManager.GetPendingRequestsByUser(requestUserID(r))
 	if err != nil {
 		log.Printf("Error getting pending requests: %v", err)
 		http.Error(w, "Error retrieving pending requests", http.StatusInternalServerError)
@@ -235,7 +304,16 @@ func (h *HITLHandler) CancelRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, err := h.sessionManager.GetUserRequest(requestUserID(r), req.RequestID); err != nil {
+		http.Error(w, "Request not found", http.StatusNotFound)
+		return
+	}
+
 	err := h.sessionManager.CancelRequest(req.RequestID)
+	if errors.Is(err, storage.ErrRequestNotPending) {
+		http.Error(w, "Request is no longer pending", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to cancel request: %v", err), http.StatusInternalServerError)
 		return
@@ -250,4 +328,93 @@ func (h *HITLHandler) CancelRequest(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
-}
\ No newline at end of file
+}
+
+// ListWebhookDeliveries returns every attempt to deliver a request's result to
+// its callback_url, oldest first.
+func (h *HITLHandler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	requestID := r.URL.Query().Get("request_id")
+	if requestID == "" {
+		http.Error(w, "Missing request_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.sessionManager.GetUserRequest(requestUserID(r), requestID); err != nil {
+		http.Error(w, "Request not found", http.StatusNotFound)
+		return
+	}
+
+	deliveries, err := h.sessionManager.GetWebhookDeliveries(requestID)
+	if err != nil {
+		log.Printf("Error getting webhook deliveries for request %s: %v", requestID, err)
+		http.Error(w, "Error retrieving webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"request_id": requestID,
+		"deliveries": deliveries,
+		"count":      len(deliveries),
+	})
+}
+
+// StreamEvents streams lifecycle events (created, sent, voted, answered,
+// timed_out, canceled) for the caller's requests as Server-Sent Events. The optional
+// session_id and client_id query parameters restrict the stream further.
+func (h *HITLHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	userID := requestUserID(r)
+	sessionID := r.URL.Query().Get("session_id")
+	clientID := r.URL.Query().Get("client_id")
+
+	events, unsubscribe := h.sessionManager.Hub().Subscribe(func(event session.Event) bool {
+		return event.Request.UserID == userID &&
+			(sessionID == "" || event.Request.SessionID == sessionID) &&
+			(clientID == "" || event.Request.ClientID == clientID)
+	})
+	defer unsubscribe()
+
+	// The stream is open-ended, so the server-wide write timeout must not apply.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Could not clear write deadline for event stream: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Error encoding stream event for request %s: %v", event.Request.ID, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"loopgate/internal/notifier"
+	"loopgate/internal/session"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupHITLHandler(t *testing.T) (*session.Manager, *httptest.Server) {
+	t.Helper()
+	manager := session.NewManager(storage.NewInMemoryStorageAdapter())
+	handler := NewHITLHandler(manager, nil)
+
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return manager, server
+}
+
+func TestHITLHandler_PollRequestWait(t *testing.T) {
+	manager, server := setupHITLHandler(t)
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{ID: "req-1", Status: types.RequestStatusPending, CreatedAt: time.Now()}))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		manager.UpdateRequestResponse("req-1", "Approve", true,
+			&types.Responder{Channel: "telegram", UserID: "7", Name: "ada", Recipient: "42", PayloadRef: "callback_query:1"})
+	}()
+
+	started := time.Now()
+	resp, err := http.Get(server.URL + "/hitl/poll?request_id=req-1&wait=10")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var poll types.PollResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&poll))
+	assert.True(t, poll.Completed)
+	assert.Equal(t, "Approve", poll.Response)
+	assert.Equal(t, &types.Responder{Channel: "telegram", UserID: "7", Name: "ada", Recipient: "42", PayloadRef: "callback_query:1"}, poll.Responder)
+	assert.NotNil(t, poll.RespondedAt)
+	assert.Less(t, time.Since(started), 5*time.Second, "long poll should return as soon as the request is answered")
+
+	resp, err = http.Get(server.URL + "/hitl/poll?request_id=req-1&wait=abc")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestHITLHandler_StreamEvents(t *testing.T) {
+	manager, server := setupHITLHandler(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/hitl/stream?session_id=session-a", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	// Wait for the connection comment so the subscription is in place
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(line, ": connected"))
+
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{ID: "other", SessionID: "session-b", Status: types.RequestStatusPending}))
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{ID: "mine", SessionID: "session-a", Status: types.RequestStatusPending}))
+	require.NoError(t, manager.CancelRequest("mine"))
+
+	var eventTypes []string
+	for len(eventTypes) < 2 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if strings.HasPrefix(line, "event: ") {
+			eventTypes = append(eventTypes, strings.TrimSpace(strings.TrimPrefix(line, "event: ")))
+		}
+		if strings.HasPrefix(line, "data: ") {
+			var event session.Event
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+			assert.Equal(t, "mine", event.Request.ID)
+		}
+	}
+	assert.Equal(t, []string{"created", "canceled"}, eventTypes)
+}
+
+type stubNotifier struct {
+	channel string
+	sendErr error
+}
+
+func (s stubNotifier) Channel() string                                         { return s.channel }
+func (s stubNotifier) SendRequest(*types.HITLRequest, *types.Session) error    { return s.sendErr }
+func (s stubNotifier) NotifyResolved(*types.HITLRequest, *types.Session) error { return nil }
+func (s stubNotifier) Start()                                                  {}
+func (s stubNotifier) Stop()                                                   {}
+
+func TestHITLHandler_RegisterSessionTargets(t *testing.T) {
+	manager := session.NewManager(storage.NewInMemoryStorageAdapter())
+	registry := notifier.NewRegistry(manager)
+	registry.Register(stubNotifier{channel: "telegram"})
+	registry.Register(stubNotifier{channel: "slack"})
+
+	router := mux.NewRouter()
+	NewHITLHandler(manager, registry).RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	register := func(body string) *http.Response {
+		resp, err := http.Post(server.URL+"/hitl/register", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	for _, body := range []string{
+		`{"session_id":"s1","client_id":"c","telegram_id":1,"targets":[{"channel":"slack"}]}`,
+		`{"session_id":"s1","client_id":"c","telegram_id":1,"targets":[{"telegram_id":0}]}`,
+		`{"session_id":"s1","client_id":"c","telegram_id":1,"targets":[{"channel":"email","recipient":"a@b.c"}]}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, register(body).StatusCode, body)
+	}
+
+	resp := register(`{"session_id":"s1","client_id":"c","telegram_id":1,"targets":[{"channel":"slack","recipient":"C1"},{"telegram_id":2}],` +
+		`"telegram_allowed_users":[7,8],"telegram_admins_only":true}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	sess, err := manager.GetSession("s1")
+	require.NoError(t, err)
+	assert.Equal(t, []types.ChannelTarget{
+		{Channel: "slack", Recipient: "C1"},
+		{Channel: "telegram", TelegramID: 2},
+	}, sess.Targets)
+	assert.Equal(t, []int64{7, 8}, sess.TelegramAllowedUsers)
+	assert.True(t, sess.TelegramAdminsOnly)
+}
+
+func TestHITLHandler_SubmitRequestClearsServerFields(t *testing.T) {
+	manager := session.NewManager(storage.NewInMemoryStorageAdapter())
+	registry := notifier.NewRegistry(manager)
+	registry.Register(stubNotifier{channel: "telegram"})
+	require.NoError(t, manager.CreateSession(&types.Session{ID: "s1", ClientID: "c", TelegramID: 1}))
+
+	router := mux.NewRouter()
+	NewHITLHandler(manager, registry).RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	submit := func(body string) *http.Response {
+		resp, err := http.Post(server.URL+"/hitl/request", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := submit(`{"session_id":"s1","client_id":"c","message":"Deploy?","timeout_seconds":-1}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = submit(`{"id":"mine","session_id":"s1","client_id":"c","message":"Deploy?","status":"completed",` +
+		`"response":"Yes","approved":true,"responded_at":"2024-01-01T00:00:00Z","responder":{"channel":"console"},` +
+		`"telegram_msg_id":5,"channel_msg_id":"x","votes":[{"approver":"ada"}],"escalation_level":2,"reminders_sent":3}`)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result struct {
+		RequestID string `json:"request_id"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.NotEqual(t, "mine", result.RequestID)
+
+	request, err := manager.GetRequest(result.RequestID)
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+	assert.Empty(t, request.Response)
+	assert.False(t, request.Approved)
+	assert.Nil(t, request.RespondedAt)
+	assert.Nil(t, request.Responder)
+	assert.Zero(t, request.TelegramMsgID)
+	assert.Empty(t, request.ChannelMsgID)
+	assert.Empty(t, request.Votes)
+	assert.Zero(t, request.EscalationLevel)
+	assert.Zero(t, request.RemindersSent)
+}
+
+func TestHITLHandler_SubmitRequestDeliveryFailure(t *testing.T) {
+	manager := session.NewManager(storage.NewInMemoryStorageAdapter())
+	registry := notifier.NewRegistry(manager)
+	registry.Register(stubNotifier{channel: "telegram", sendErr: errors.New("telegram is down")})
+	require.NoError(t, manager.CreateSession(&types.Session{ID: "s1", ClientID: "c", TelegramID: 1}))
+
+	router := mux.NewRouter()
+	NewHITLHandler(manager, registry).RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/hitl/request", "application/json", strings.NewReader(`{"session_id":"s1","client_id":"c","message":"Deploy?"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	// The undelivered request is not left pending
+	requests, err := manager.ListRequestsByUser("", 10)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, types.RequestStatusCanceled, requests[0].Status)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"loopgate/internal/middleware"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+
+	"github.com/gorilla/mux"
+)
+
+// WebhookHandlers holds dependencies for inspecting and re-driving the
+// callback webhook outbox.
+type WebhookHandlers struct {
+	Storage storage.StorageAdapter
+}
+
+// NewWebhookHandlers creates a new WebhookHandlers.
+func NewWebhookHandlers(storage storage.StorageAdapter) *WebhookHandlers {
+	return &WebhookHandlers{
+		Storage: storage,
+	}
+}
+
+// ListOutboxHandler lists the caller's webhook outbox entries, optionally
+// filtered by status.
+// GET /api/webhooks/outbox?status=dead
+func (h *WebhookHandlers) ListOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	status := types.OutboxStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", types.OutboxStatusPending, types.OutboxStatusDelivered, types.OutboxStatusDead:
+		// valid
+	default:
+		http.Error(w, "Invalid status. Must be one of 'pending', 'delivered', 'dead'", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.Storage.ListOutboxEntriesByUser(middleware.APIKeyUserID(r.Context()), status)
+	if err != nil {
+		http.Error(w, "Failed to retrieve outbox entries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []*types.WebhookOutboxEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
+
+// RedriveOutboxEntryHandler moves a dead outbox entry back to pending so the
+// dispatcher delivers it again with a fresh set of attempts.
+// POST /api/webhooks/outbox/{entry_id}/redrive
+func (h *WebhookHandlers) RedriveOutboxEntryHandler(w http.ResponseWriter, r *http.Request) {
+	entryID := mux.Vars(r)["entry_id"]
+	if entryID == "" {
+		http.Error(w, "Outbox entry ID not provided in path", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.Storage.GetOutboxEntry(entryID)
+	if err == nil && entry.UserID != middleware.APIKeyUserID(r.Context()) {
+		err = storage.ErrOutboxEntryNotFound
+	}
+	if err == nil {
+		err = h.Storage.RequeueOutboxEntry(entryID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrOutboxEntryNotDead):
+			http.Error(w, "Only dead outbox entries can be re-driven", http.StatusConflict)
+		case errors.Is(err, storage.ErrOutboxEntryNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to re-drive outbox entry: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Outbox entry queued for delivery", "id": entryID})
+}
@@ -0,0 +1,302 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"loopgate/internal/notifier"
+	"loopgate/internal/session"
+	"loopgate/internal/types"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChannelName is the session channel served by Bot.
+const ChannelName = "matrix"
+
+// Event types and relations of the client-server API used by Bot.
+const (
+	eventMessage  = "m.room.message"
+	eventReaction = "m.reaction"
+
+	relAnnotation = "m.annotation"
+	relReplace    = "m.replace"
+
+	msgTypeText   = "m.text"
+	msgTypeNotice = "m.notice"
+	htmlFormat    = "org.matrix.custom.html"
+)
+
+// optionKeys are the reactions Bot offers for the first ten options.
+var optionKeys = []string{"1️⃣", "2️⃣", "3️⃣", "4️⃣", "5️⃣", "6️⃣", "7️⃣", "8️⃣", "9️⃣", "🔟"}
+
+const (
+	requestTimeout = 10 * time.Second
+	syncTimeout    = 30 * time.Second
+	retryDelay     = 5 * time.Second
+)
+
+// Bot delivers HITL requests as messages in Matrix rooms and records answers
+// from the room timeline, which it follows with /sync. Sessions name their
+// room ID as the recipient, the way Session.TelegramID names a Telegram chat.
+// Options are answered by reacting with the option's number or by replying
+// with its number or text; input requests are answered by replying. It
+// implements notifier.Notifier.
+type Bot struct {
+	homeserverURL  string
+	accessToken    string
+	client         *http.Client
+	sessionManager *session.Manager
+
+	// userID is the bot's own Matrix ID, learned at Start, so it can ignore
+	// the reactions it adds itself.
+	mu     sync.RWMutex
+	userID string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewBot creates a Matrix notifier that acts as the user owning
+// accessToken on the homeserver at homeserverURL.
+func NewBot(homeserverURL, accessToken string, sessionManager *session.Manager) (*Bot, error) {
+	if _, err := url.ParseRequestURI(homeserverURL); err != nil {
+		return nil, fmt.Errorf("invalid matrix homeserver URL %q: %w", homeserverURL, err)
+	}
+	if accessToken == "" {
+		return nil, fmt.Errorf("matrix access token is required")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Bot{
+		homeserverURL:  strings.TrimRight(homeserverURL, "/"),
+		accessToken:    accessToken,
+		client:         &http.Client{},
+		sessionManager: sessionManager,
+		ctx:            ctx,
+		cancel:         cancel,
+	}, nil
+}
+
+// Channel implements notifier.Notifier.
+func (b *Bot) Channel() string {
+	return ChannelName
+}
+
+// Stop ends Start and aborts a /sync in progress.
+func (b *Bot) Stop() {
+	b.cancel()
+}
+
+// SendRequest posts request to the session's room and adds one reaction per
+// option for approvers to click.
+func (b *Bot) SendRequest(request *types.HITLRequest, sess *types.Session) error {
+	if !strings.HasPrefix(sess.Recipient, "!") {
+		return fmt.Errorf("session %s has no matrix room ID", sess.ID)
+	}
+
+	body, formatted := requestText(request)
+	eventID, err := b.sendEvent(sess.Recipient, eventMessage, messageContent(msgTypeText, body, formatted))
+	if err != nil {
+		return err
+	}
+
+	request.ChannelMsgID = eventID
+	if err := b.sessionManager.SetChannelMsgID(request.ID, eventID); err != nil {
+		log.Printf("Failed to store matrix event for request %s: %v", request.ID, err)
+	}
+
+	for i := range request.Options {
+		if i >= len(optionKeys) {
+			break
+		}
+		if _, err := b.sendEvent(sess.Recipient, eventReaction, reactionContent(eventID, optionKeys[i])); err != nil {
+			log.Printf("Failed to add matrix reaction to request %s: %v", request.ID, err)
+			break
+		}
+	}
+	return nil
+}
+
+// NotifyResolved edits the request message to show its outcome.
+func (b *Bot) NotifyResolved(request *types.HITLRequest, sess *types.Session) error {
+	if request.ChannelMsgID == "" || sess.Recipient == "" {
+		return nil
+	}
+
+	var heading, detail string
+	switch request.Status {
+	case types.RequestStatusCompleted:
+		heading, detail = "✅ Response Recorded", "Response: "+request.Response
+		if answeredBy := notifier.AnsweredBy(request); answeredBy != "" {
+			detail += "\nAnswered by: " + answeredBy
+		}
+	case types.RequestStatusTimeout:
+		heading, detail = "⏰ Request Expired", fmt.Sprintf("No response within %d seconds.", request.Timeout)
+	case types.RequestStatusCanceled:
+		heading = "🚫 Request Canceled"
+	default:
+		return nil
+	}
+
+	body := heading + "\n\n" + request.Message
+	formatted := "<strong>" + heading + "</strong><br><br>" + escape(request.Message)
+	if detail != "" {
+		body += "\n\n" + detail
+		formatted += "<br><br>" + escape(detail)
+	}
+	body += "\n\n" + footer(request)
+	formatted += "<br><br><small>" + escape(footer(request)) + "</small>"
+
+	newContent := messageContent(msgTypeText, body, formatted)
+	edit := messageContent(msgTypeText, "* "+body, "* "+formatted)
+	edit["m.new_content"] = newContent
+	edit["m.relates_to"] = map[string]interface{}{"rel_type": relReplace, "event_id": request.ChannelMsgID}
+
+	_, err := b.sendEvent(sess.Recipient, eventMessage, edit)
+	return err
+}
+
+func requestText(request *types.HITLRequest) (body, formatted string) {
+	var plain, rich strings.Builder
+	plain.WriteString("🤖 HITL Request\n\n" + request.Message + "\n\n")
+	rich.WriteString("<strong>🤖 HITL Request</strong><br><br>" + escape(request.Message) + "<br><br>")
+
+	if len(request.Options) > 0 {
+		rich.WriteString("<ol>")
+		for i, option := range request.Options {
+			key := fmt.Sprintf("%d.", i+1)
+			if i < len(optionKeys) {
+				key = optionKeys[i]
+			}
+			plain.WriteString(key + " " + option + "\n")
+			rich.WriteString("<li>" + escape(option) + "</li>")
+		}
+		rich.WriteString("</ol>")
+		plain.WriteString("\nReact with an option's number, or reply with its number or text.\n")
+		rich.WriteString("<em>React with an option's number, or reply with its number or text.</em><br>")
+	} else {
+		plain.WriteString("Reply to this message with your response.\n")
+		rich.WriteString("<em>Reply to this message with your response.</em><br>")
+	}
+
+	plain.WriteString(footer(request))
+	rich.WriteString("<small>" + escape(footer(request)) + "</small>")
+	return plain.String(), rich.String()
+}
+
+func footer(request *types.HITLRequest) string {
+	return fmt.Sprintf("Request ID: %s · Client: %s · Session: %s", request.ID, request.ClientID, request.SessionID)
+}
+
+func messageContent(msgType, body, formatted string) map[string]interface{} {
+	return map[string]interface{}{
+		"msgtype":        msgType,
+		"body":           body,
+		"format":         htmlFormat,
+		"formatted_body": formatted,
+	}
+}
+
+func reactionContent(eventID, key string) map[string]interface{} {
+	return map[string]interface{}{
+		"m.relates_to": map[string]interface{}{"rel_type": relAnnotation, "event_id": eventID, "key": key},
+	}
+}
+
+// escape escapes text for formatted_body and turns newlines into line
+// breaks.
+func escape(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+}
+
+// notice posts a bot notice replying to eventID, for answers that could not
+// be recorded.
+func (b *Bot) notice(roomID, eventID, text string) {
+	content := messageContent(msgTypeNotice, text, escape(text))
+	content["m.relates_to"] = map[string]interface{}{
+		"m.in_reply_to": map[string]interface{}{"event_id": eventID},
+	}
+	if _, err := b.sendEvent(roomID, eventMessage, content); err != nil {
+		log.Printf("Failed to send matrix notice to %s: %v", roomID, err)
+	}
+}
+
+// sendEvent sends a room event and returns its event ID.
+func (b *Bot) sendEvent(roomID, eventType string, content interface{}) (string, error) {
+	var result struct {
+		EventID string `json:"event_id"`
+	}
+	path := fmt.Sprintf("/rooms/%s/send/%s/%s", url.PathEscape(roomID), eventType, uuid.NewString())
+	if err := b.call(b.ctx, http.MethodPut, path, content, &result, requestTimeout); err != nil {
+		return "", err
+	}
+	return result.EventID, nil
+}
+
+// call invokes a client-server API endpoint below /_matrix/client/v3 and
+// decodes the response into result.
+func (b *Bot) call(ctx context.Context, method, path string, payload, result interface{}, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var body *bytes.Reader
+	if payload == nil {
+		body = bytes.NewReader(nil)
+	} else {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to encode matrix %s %s: %w", method, path, err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, b.homeserverURL+"/_matrix/client/v3"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.accessToken)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("matrix %s %s failed: %w", method, endpoint(path), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			ErrCode string `json:"errcode"`
+			Error   string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.ErrCode != "" {
+			return fmt.Errorf("matrix %s %s failed: %s: %s", method, endpoint(path), apiErr.ErrCode, apiErr.Error)
+		}
+		return fmt.Errorf("matrix %s %s failed: %s", method, endpoint(path), resp.Status)
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode matrix %s %s response: %w", method, endpoint(path), err)
+	}
+	return nil
+}
+
+// endpoint drops the query string from path for error messages, which
+// would otherwise include sync tokens.
+func endpoint(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	return path
+}
@@ -0,0 +1,269 @@
+package matrix
+
+import (
+	"encoding/json"
+	"fmt"
+	"loopgate/internal/notifier"
+	"loopgate/internal/session"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	botUserID = "@loopgate:example.org"
+	roomID    = "!ops:example.org"
+)
+
+type sentEvent struct {
+	Room    string
+	Type    string
+	Content map[string]interface{}
+}
+
+// fakeHomeserver stands in for a Matrix homeserver. It records sent events
+// and answers /sync with the queued responses, then blocks like a long poll.
+type fakeHomeserver struct {
+	mu     sync.Mutex
+	events []sentEvent
+	joined []string
+	syncs  []string
+	next   int
+}
+
+func (f *fakeHomeserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"errcode": "M_UNKNOWN_TOKEN", "error": "Invalid access token"})
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/_matrix/client/v3")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case path == "/account/whoami":
+		json.NewEncoder(w).Encode(map[string]string{"user_id": botUserID})
+	case path == "/sync":
+		if f.next >= len(f.syncs) {
+			f.mu.Unlock()
+			<-r.Context().Done()
+			f.mu.Lock()
+			return
+		}
+		fmt.Fprint(w, f.syncs[f.next])
+		f.next++
+	case strings.HasPrefix(path, "/join/"):
+		f.joined = append(f.joined, strings.TrimPrefix(path, "/join/"))
+		json.NewEncoder(w).Encode(map[string]string{"room_id": strings.TrimPrefix(path, "/join/")})
+	case strings.HasPrefix(path, "/rooms/"):
+		// /rooms/{room}/send/{type}/{txn}
+		parts := strings.Split(strings.TrimPrefix(path, "/rooms/"), "/")
+		var content map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&content)
+		f.events = append(f.events, sentEvent{Room: parts[0], Type: parts[2], Content: content})
+		json.NewEncoder(w).Encode(map[string]string{"event_id": fmt.Sprintf("$event-%d", len(f.events))})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeHomeserver) sent(eventType string) []sentEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var events []sentEvent
+	for _, ev := range f.events {
+		if ev.Type == eventType {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+type testBot struct {
+	*Bot
+	manager  *session.Manager
+	registry *notifier.Registry
+	server   *fakeHomeserver
+}
+
+func setupBot(t *testing.T) *testBot {
+	t.Helper()
+	server := &fakeHomeserver{}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	manager := session.NewManager(storage.NewInMemoryStorageAdapter())
+	bot, err := NewBot(httpServer.URL, "test-token", manager)
+	require.NoError(t, err)
+	bot.userID = botUserID
+	t.Cleanup(bot.Stop)
+
+	registry := notifier.NewRegistry(manager)
+	registry.Register(bot)
+	manager.OnResolved(registry.NotifyResolved)
+
+	require.NoError(t, manager.CreateSession(&types.Session{ID: "s1", ClientID: "agent", Channel: ChannelName, Recipient: roomID}))
+	return &testBot{Bot: bot, manager: manager, registry: registry, server: server}
+}
+
+func (tb *testBot) submit(t *testing.T, request *types.HITLRequest) {
+	t.Helper()
+	request.SessionID = "s1"
+	request.ClientID = "agent"
+	request.Status = types.RequestStatusPending
+	request.CreatedAt = time.Now()
+	require.NoError(t, tb.manager.StoreRequest(request))
+	require.NoError(t, tb.registry.Send(request))
+}
+
+// timeline builds a /sync response with events in room.
+func timeline(room string, events ...string) string {
+	return fmt.Sprintf(`{"next_batch":"b1","rooms":{"join":{%q:{"timeline":{"events":[%s]}}}}}`, room, strings.Join(events, ","))
+}
+
+func (tb *testBot) deliver(t *testing.T, sync string) {
+	t.Helper()
+	var response syncResponse
+	require.NoError(t, json.Unmarshal([]byte(sync), &response))
+	tb.handleSync(&response)
+}
+
+func reaction(sender, eventID, key string) string {
+	return fmt.Sprintf(`{"type":"m.reaction","event_id":"$r","sender":%q,"content":{"m.relates_to":{"rel_type":"m.annotation","event_id":%q,"key":%q}}}`,
+		sender, eventID, key)
+}
+
+func reply(sender, eventID, body string) string {
+	return fmt.Sprintf(`{"type":"m.room.message","event_id":"$reply","sender":%q,"content":{"msgtype":"m.text","body":%q,"m.relates_to":{"m.in_reply_to":{"event_id":%q}}}}`,
+		sender, body, eventID)
+}
+
+func TestBot_ReactionAnswersOption(t *testing.T) {
+	tb := setupBot(t)
+	tb.submit(t, &types.HITLRequest{ID: "req-1", Message: "Deploy <b>now</b>?", Options: []string{"Approve", "Reject"}})
+
+	messages := tb.server.sent(eventMessage)
+	require.Len(t, messages, 1)
+	assert.Equal(t, roomID, messages[0].Room)
+	assert.Contains(t, messages[0].Content["body"], "1️⃣ Approve")
+	assert.Contains(t, messages[0].Content["formatted_body"], "Deploy &lt;b&gt;now&lt;/b&gt;?")
+
+	// The bot offers one reaction per option and ignores its own
+	reactions := tb.server.sent(eventReaction)
+	require.Len(t, reactions, 2)
+	assert.Equal(t, "2️⃣", reactions[1].Content["m.relates_to"].(map[string]interface{})["key"])
+
+	request, err := tb.manager.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, "$event-1", request.ChannelMsgID)
+
+	tb.deliver(t, timeline(roomID, reaction(botUserID, "$event-1", "1️⃣")))
+	tb.deliver(t, timeline("!elsewhere:example.org", reaction("@mallory:example.org", "$event-1", "1️⃣")))
+	tb.deliver(t, timeline(roomID, reaction("@ada:example.org", "$event-1", "👍")))
+	request, err = tb.manager.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+
+	tb.deliver(t, timeline(roomID, reaction("@ada:example.org", "$event-1", "2️⃣")))
+	request, err = tb.manager.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.Equal(t, "Reject", request.Response)
+	assert.False(t, request.Approved)
+	assert.Equal(t, &types.Responder{Channel: ChannelName, UserID: "@ada:example.org", Name: "@ada:example.org",
+		Recipient: roomID, PayloadRef: "event:$r"}, request.Responder)
+
+	// The request message is edited to show the outcome
+	messages = tb.server.sent(eventMessage)
+	require.Len(t, messages, 2)
+	relatesTo := messages[1].Content["m.relates_to"].(map[string]interface{})
+	assert.Equal(t, relReplace, relatesTo["rel_type"])
+	assert.Equal(t, "$event-1", relatesTo["event_id"])
+	assert.Contains(t, messages[1].Content["m.new_content"].(map[string]interface{})["body"], "Response: Reject")
+}
+
+func TestBot_ReplyAnswers(t *testing.T) {
+	tb := setupBot(t)
+	tb.submit(t, &types.HITLRequest{ID: "req-2", Message: "Which region?", RequestType: types.RequestTypeInput})
+	tb.submit(t, &types.HITLRequest{ID: "req-3", Message: "Ship?", Options: []string{"Yes", "No"}})
+
+	tb.deliver(t, timeline(roomID,
+		reply("@ada:example.org", "$event-1", "> <@loopgate:example.org> Which region?\n\neu-west-1"),
+		reply("@ada:example.org", "$event-2", "maybe"),
+	))
+
+	request, err := tb.manager.GetRequest("req-2")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.Equal(t, "eu-west-1", request.Response)
+	assert.True(t, request.Approved)
+
+	// An answer that is not an option gets a notice
+	request, err = tb.manager.GetRequest("req-3")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+	notices := tb.server.sent(eventMessage)
+	assert.Equal(t, "Please answer with one of: Yes, No", notices[len(notices)-1].Content["body"])
+
+	tb.deliver(t, timeline(roomID, reply("@ada:example.org", "$event-2", "YES")))
+	request, err = tb.manager.GetRequest("req-3")
+	require.NoError(t, err)
+	assert.Equal(t, "Yes", request.Response)
+	assert.True(t, request.Approved)
+}
+
+func TestBot_StartSyncsAndJoinsInvites(t *testing.T) {
+	tb := setupBot(t)
+	tb.submit(t, &types.HITLRequest{ID: "req-5", Message: "Ship?", Options: []string{"Yes", "No"}})
+
+	tb.server.mu.Lock()
+	tb.server.syncs = []string{
+		`{"next_batch":"b0","rooms":{"invite":{"!new:example.org":{}}}}`,
+		timeline(roomID, reaction("@ada:example.org", "$event-1", "1️⃣")),
+	}
+	tb.server.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		tb.Start()
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		request, err := tb.manager.GetRequest("req-5")
+		return err == nil && request.Status == types.RequestStatusCompleted
+	}, 2*time.Second, 10*time.Millisecond)
+
+	tb.server.mu.Lock()
+	assert.Equal(t, []string{"!new:example.org"}, tb.server.joined)
+	tb.server.mu.Unlock()
+
+	tb.Stop()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Start did not return after Stop")
+	}
+}
+
+func TestBot_SendRequestErrors(t *testing.T) {
+	tb := setupBot(t)
+
+	err := tb.SendRequest(&types.HITLRequest{ID: "req-6"}, &types.Session{ID: "s2", Recipient: "#ops:example.org"})
+	assert.EqualError(t, err, "session s2 has no matrix room ID")
+
+	bot, err := NewBot(tb.homeserverURL, "wrong-token", tb.manager)
+	require.NoError(t, err)
+	err = bot.SendRequest(&types.HITLRequest{ID: "req-6"}, &types.Session{ID: "s1", Recipient: roomID})
+	assert.ErrorContains(t, err, "failed: M_UNKNOWN_TOKEN: Invalid access token")
+}
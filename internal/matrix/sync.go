@@ -0,0 +1,231 @@
+package matrix
+
+import (
+	"errors"
+	"log"
+	"loopgate/internal/notifier"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syncFilter limits /sync to the timeline events Bot handles.
+const syncFilter = `{"presence":{"types":[]},"account_data":{"types":[]},` +
+	`"room":{"timeline":{"types":["m.room.message","m.reaction"]},"state":{"types":[]},` +
+	`"ephemeral":{"types":[]},"account_data":{"types":[]}}}`
+
+type event struct {
+	Type    string `json:"type"`
+	EventID string `json:"event_id"`
+	Sender  string `json:"sender"`
+	Content struct {
+		Body      string `json:"body"`
+		RelatesTo *struct {
+			RelType   string `json:"rel_type"`
+			EventID   string `json:"event_id"`
+			Key       string `json:"key"`
+			InReplyTo *struct {
+				EventID string `json:"event_id"`
+			} `json:"m.in_reply_to"`
+		} `json:"m.relates_to"`
+	} `json:"content"`
+}
+
+type syncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []event `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]struct{} `json:"invite"`
+	} `json:"rooms"`
+}
+
+// Start follows the timeline of every room the bot has joined until Stop is
+// called, joining rooms it is invited to. The first sync also replays recent
+// history, so answers given while the server was down are still recorded.
+func (b *Bot) Start() {
+	for b.ctx.Err() == nil {
+		var whoami struct {
+			UserID string `json:"user_id"`
+		}
+		err := b.call(b.ctx, http.MethodGet, "/account/whoami", nil, &whoami, requestTimeout)
+		if err == nil {
+			b.mu.Lock()
+			b.userID = whoami.UserID
+			b.mu.Unlock()
+			log.Printf("Matrix notifier syncing as %s", whoami.UserID)
+			break
+		}
+		log.Printf("Matrix login check failed: %v", err)
+		b.wait(retryDelay)
+	}
+
+	since := ""
+	for b.ctx.Err() == nil {
+		response, err := b.sync(since)
+		if err != nil {
+			if b.ctx.Err() == nil {
+				log.Printf("Matrix sync failed: %v", err)
+				b.wait(retryDelay)
+			}
+			continue
+		}
+		b.handleSync(response)
+		since = response.NextBatch
+	}
+}
+
+// wait sleeps for d or until Stop is called.
+func (b *Bot) wait(d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-b.ctx.Done():
+	}
+}
+
+func (b *Bot) sync(since string) (*syncResponse, error) {
+	query := url.Values{"filter": {syncFilter}}
+	if since != "" {
+		query.Set("since", since)
+		query.Set("timeout", strconv.Itoa(int(syncTimeout/time.Millisecond)))
+	}
+
+	var response syncResponse
+	if err := b.call(b.ctx, http.MethodGet, "/sync?"+query.Encode(), nil, &response, syncTimeout+requestTimeout); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (b *Bot) handleSync(response *syncResponse) {
+	for roomID := range response.Rooms.Invite {
+		log.Printf("Joining matrix room %s", roomID)
+		if err := b.call(b.ctx, http.MethodPost, "/join/"+url.PathEscape(roomID), struct{}{}, nil, requestTimeout); err != nil {
+			log.Printf("Failed to join matrix room %s: %v", roomID, err)
+		}
+	}
+
+	b.mu.RLock()
+	self := b.userID
+	b.mu.RUnlock()
+
+	for roomID, room := range response.Rooms.Join {
+		for i := range room.Timeline.Events {
+			ev := &room.Timeline.Events[i]
+			if ev.Sender == self || ev.Content.RelatesTo == nil {
+				continue
+			}
+			switch {
+			case ev.Type == eventReaction && ev.Content.RelatesTo.RelType == relAnnotation:
+				b.handleReaction(roomID, ev)
+			case ev.Type == eventMessage && ev.Content.RelatesTo.InReplyTo != nil && ev.Content.RelatesTo.RelType != relReplace:
+				b.handleReply(roomID, ev)
+			}
+		}
+	}
+}
+
+// handleReaction answers a request with the option whose number the sender
+// reacted with. Other reactions are ignored.
+func (b *Bot) handleReaction(roomID string, ev *event) {
+	request := b.findRequest(roomID, ev.Content.RelatesTo.EventID)
+	if request == nil {
+		return
+	}
+
+	for i, key := range optionKeys {
+		if key == ev.Content.RelatesTo.Key && i < len(request.Options) {
+			b.record(roomID, ev, request, request.Options[i], notifier.OptionApproves(request.Options[i]))
+			return
+		}
+	}
+}
+
+// handleReply answers a request with the text of a reply to its message.
+// Requests with options need an option's number or text.
+func (b *Bot) handleReply(roomID string, ev *event) {
+	request := b.findRequest(roomID, ev.Content.RelatesTo.InReplyTo.EventID)
+	if request == nil {
+		return
+	}
+
+	text := stripReplyFallback(ev.Content.Body)
+	if text == "" {
+		return
+	}
+
+	if len(request.Options) == 0 {
+		b.record(roomID, ev, request, text, true)
+		return
+	}
+
+	option, ok := notifier.MatchOption(request.Options, text)
+	if !ok {
+		b.notice(roomID, ev.EventID, "Please answer with one of: "+strings.Join(request.Options, ", "))
+		return
+	}
+	b.record(roomID, ev, request, option, notifier.OptionApproves(option))
+}
+
+func (b *Bot) record(roomID string, ev *event, request *types.HITLRequest, response string, approved bool) {
+	log.Printf("Matrix user %s answered request %s with '%s'", ev.Sender, request.ID, response)
+
+	err := b.sessionManager.UpdateRequestResponse(request.ID, response, approved, &types.Responder{
+		Channel:    ChannelName,
+		UserID:     ev.Sender,
+		Name:       ev.Sender,
+		Recipient:  roomID,
+		PayloadRef: "event:" + ev.EventID,
+	})
+	if errors.Is(err, storage.ErrRequestNotPending) {
+		b.notice(roomID, ev.EventID, "This request is no longer pending; your response was not recorded.")
+		return
+	}
+	if refusal := notifier.VoteRefusal(err); refusal != "" {
+		b.notice(roomID, ev.EventID, refusal)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating request %s: %v", request.ID, err)
+		b.notice(roomID, ev.EventID, "Error recording your response.")
+	}
+	// The request message itself is edited by NotifyResolved.
+}
+
+// findRequest returns the pending request delivered as eventID in roomID,
+// or nil.
+func (b *Bot) findRequest(roomID, eventID string) *types.HITLRequest {
+	if eventID == "" {
+		return nil
+	}
+	message, err := b.sessionManager.FindChannelMessage(ChannelName, roomID, eventID)
+	if err != nil {
+		return nil
+	}
+	request, err := b.sessionManager.GetRequest(message.RequestID)
+	if err != nil || request.Status != types.RequestStatusPending {
+		return nil
+	}
+	return request
+}
+
+// stripReplyFallback removes the quote of the original message that older
+// clients put at the top of a reply's body.
+func stripReplyFallback(body string) string {
+	lines := strings.Split(body, "\n")
+	i := 0
+	for i < len(lines) && strings.HasPrefix(lines[i], ">") {
+		i++
+	}
+	if i > 0 && i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+	return strings.TrimSpace(strings.Join(lines[i:], "\n"))
+}
@@ -0,0 +1,433 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"loopgate/internal/middleware"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// SessionIDHeader carries the session assigned on initialize. Clients
+	// must send it on every later request.
+	SessionIDHeader = "Mcp-Session-Id"
+
+	// sessionIdleTimeout is how long a session without an open stream is
+	// kept after its last request.
+	sessionIdleTimeout = time.Hour
+
+	streamKeepAlive  = 15 * time.Second
+	maxHTTPBodyBytes = 4 << 20
+)
+
+// httpSession is a client that has completed initialize over HTTP.
+type httpSession struct {
+	id string
+	// userID owns the session; requests from other API key users get 404.
+	userID   string
+	lastSeen time.Time
+	// stream receives server-initiated messages while the client has a
+	// GET stream open, and is nil otherwise.
+	stream chan []byte
+	closed chan struct{}
+}
+
+// StreamableHTTPHandler serves the MCP Streamable HTTP transport on a single
+// endpoint:
+//
+//   - POST sends one JSON-RPC message or a batch. Requests are answered with
+//     application/json, or with a text/event-stream that carries progress
+//     notifications followed by the response when the client accepts it.
+//   - GET opens a text/event-stream for server-initiated messages that are
+//     not tied to a streamed POST.
+//   - DELETE ends the session.
+type StreamableHTTPHandler struct {
+	protocol *Protocol
+
+	mu       sync.Mutex
+	sessions map[string]*httpSession
+	now      func() time.Time
+}
+
+// NewStreamableHTTPHandler serves the tools of server over HTTP.
+func NewStreamableHTTPHandler(server *Server) *StreamableHTTPHandler {
+	return &StreamableHTTPHandler{
+		protocol: server.protocol,
+		sessions: make(map[string]*httpSession),
+		now:      time.Now,
+	}
+}
+
+func (h *StreamableHTTPHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		h.handlePost(w, req)
+	case http.MethodGet:
+		h.handleGet(w, req)
+	case http.MethodDelete:
+		h.handleDelete(w, req)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// rpcEnvelope holds the fields needed to route a message without fully
+// decoding it.
+type rpcEnvelope struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+}
+
+func (e rpcEnvelope) isRequest() bool {
+	return e.Method != "" && len(e.ID) > 0 && string(e.ID) != "null"
+}
+
+func (h *StreamableHTTPHandler) handlePost(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxHTTPBodyBytes))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	messages, batch, err := splitMessages(body)
+	if err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, -32700, "Parse error")
+		return
+	}
+
+	hasRequests := false
+	initialize := false
+	for _, message := range messages {
+		var envelope rpcEnvelope
+		if err := json.Unmarshal(message, &envelope); err != nil {
+			h.writeJSONError(w, http.StatusBadRequest, -32700, "Parse error")
+			return
+		}
+		if envelope.isRequest() {
+			hasRequests = true
+		}
+		if envelope.Method == "initialize" {
+			initialize = true
+		}
+	}
+
+	var sess *httpSession
+	if initialize {
+		if len(messages) != 1 {
+			h.writeJSONError(w, http.StatusBadRequest, -32600, "initialize must not be part of a batch")
+			return
+		}
+		sess = h.createSession(middleware.APIKeyUserID(req.Context()))
+		w.Header().Set(SessionIDHeader, sess.id)
+	} else {
+		var status int
+		sess, status = h.lookupSession(req)
+		if sess == nil {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+	}
+
+	// tools/call may block while waiting for a human, so lift the
+	// server-wide write deadline. The tool enforces the request's own timeout.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Could not clear write deadline for MCP request: %v", err)
+	}
+
+	if !hasRequests {
+		// Only notifications or responses: nothing to answer.
+		for _, message := range messages {
+			h.protocol.HandleRequestContext(req.Context(), message)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if acceptsEventStream(req) {
+		h.respondWithStream(w, req, messages)
+		return
+	}
+
+	// Without a stream for this POST, notifications go to the session's GET
+	// stream if the client has one open.
+	ctx := WithNotifier(req.Context(), func(message []byte) error {
+		return h.sendToSession(sess, message)
+	})
+	responses := h.handleAll(ctx, messages, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	if batch {
+		w.Write(joinBatch(responses))
+		return
+	}
+	if len(responses) > 0 {
+		w.Write(responses[0])
+	}
+}
+
+// respondWithStream answers a POST as a text/event-stream. Notifications
+// raised while handling the requests, such as progress while waiting for a
+// human, are sent ahead of the responses. The stream ends once every request
+// has been answered.
+func (h *StreamableHTTPHandler) respondWithStream(w http.ResponseWriter, req *http.Request, messages []json.RawMessage) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var mu sync.Mutex
+	send := func(message []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := writeSSEMessage(w, message); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	h.handleAll(WithNotifier(req.Context(), send), messages, send)
+}
+
+// handleAll runs every message concurrently and returns the responses in
+// order. If send is set, each response is also passed to it as soon as it is
+// ready.
+func (h *StreamableHTTPHandler) handleAll(ctx context.Context, messages []json.RawMessage, send NotifyFunc) [][]byte {
+	responses := make([][]byte, len(messages))
+	var wg sync.WaitGroup
+	for i, message := range messages {
+		wg.Add(1)
+		go func(i int, message []byte) {
+			defer wg.Done()
+			response, err := h.protocol.HandleRequestContext(ctx, message)
+			if err != nil {
+				log.Printf("Error handling MCP request: %v", err)
+				return
+			}
+			if response != nil && send != nil {
+				send(response)
+			}
+			responses[i] = response
+		}(i, message)
+	}
+	wg.Wait()
+
+	answered := responses[:0]
+	for _, response := range responses {
+		if response != nil {
+			answered = append(answered, response)
+		}
+	}
+	return answered
+}
+
+// handleGet opens the session's stream for server-initiated messages. A
+// session has at most one such stream at a time.
+func (h *StreamableHTTPHandler) handleGet(w http.ResponseWriter, req *http.Request) {
+	if !acceptsEventStream(req) {
+		http.Error(w, "Accept must include text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+
+	sess, status := h.lookupSession(req)
+	if sess == nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	stream := make(chan []byte, 32)
+	h.mu.Lock()
+	if sess.stream != nil {
+		h.mu.Unlock()
+		http.Error(w, "A stream is already open for this session", http.StatusConflict)
+		return
+	}
+	sess.stream = stream
+	h.mu.Unlock()
+
+	defer func() {
+		h.mu.Lock()
+		if sess.stream == stream {
+			sess.stream = nil
+		}
+		sess.lastSeen = h.now()
+		h.mu.Unlock()
+	}()
+
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Could not clear write deadline for MCP stream: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-sess.closed:
+			return
+		case message := <-stream:
+			if err := writeSSEMessage(w, message); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// handleDelete ends a session. Later requests with its ID get 404, which
+// tells the client to initialize again.
+func (h *StreamableHTTPHandler) handleDelete(w http.ResponseWriter, req *http.Request) {
+	sess, status := h.lookupSession(req)
+	if sess == nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	h.mu.Lock()
+	if _, ok := h.sessions[sess.id]; ok {
+		delete(h.sessions, sess.id)
+		close(sess.closed)
+	}
+	h.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *StreamableHTTPHandler) createSession(userID string) *httpSession {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Clients that vanish without DELETE would otherwise accumulate.
+	now := h.now()
+	for id, sess := range h.sessions {
+		if sess.stream == nil && now.Sub(sess.lastSeen) > sessionIdleTimeout {
+			delete(h.sessions, id)
+			close(sess.closed)
+		}
+	}
+
+	sess := &httpSession{
+		id:       uuid.New().String(),
+		userID:   userID,
+		lastSeen: now,
+		closed:   make(chan struct{}),
+	}
+	h.sessions[sess.id] = sess
+	return sess
+}
+
+// lookupSession returns the session named in the request header, or the
+// status to reply with: 400 if the header is missing, 404 if the session is
+// unknown, has ended or belongs to another user.
+func (h *StreamableHTTPHandler) lookupSession(req *http.Request) (*httpSession, int) {
+	id := req.Header.Get(SessionIDHeader)
+	if id == "" {
+		return nil, http.StatusBadRequest
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sess, ok := h.sessions[id]
+	if !ok || sess.userID != middleware.APIKeyUserID(req.Context()) {
+		return nil, http.StatusNotFound
+	}
+	sess.lastSeen = h.now()
+	return sess, 0
+}
+
+// sendToSession queues a message on the session's GET stream. Messages are
+// dropped if no stream is open or the client is not keeping up.
+func (h *StreamableHTTPHandler) sendToSession(sess *httpSession, message []byte) error {
+	h.mu.Lock()
+	stream := sess.stream
+	h.mu.Unlock()
+
+	if stream == nil {
+		return nil
+	}
+	select {
+	case stream <- message:
+	default:
+	}
+	return nil
+}
+
+func (h *StreamableHTTPHandler) writeJSONError(w http.ResponseWriter, status int, code int, message string) {
+	response, _ := h.protocol.createErrorResponse(nil, code, message, nil)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// splitMessages decodes a POST body into its JSON-RPC messages and reports
+// whether it was a batch.
+func splitMessages(body []byte) ([]json.RawMessage, bool, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil, false, fmt.Errorf("empty body")
+	}
+
+	if trimmed[0] != '[' {
+		return []json.RawMessage{trimmed}, false, nil
+	}
+
+	var messages []json.RawMessage
+	if err := json.Unmarshal(trimmed, &messages); err != nil {
+		return nil, true, err
+	}
+	if len(messages) == 0 {
+		return nil, true, fmt.Errorf("empty batch")
+	}
+	return messages, true, nil
+}
+
+func joinBatch(responses [][]byte) []byte {
+	return append(append([]byte("["), bytes.Join(responses, []byte(","))...), ']')
+}
+
+func acceptsEventStream(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "text/event-stream")
+}
+
+func writeSSEMessage(w io.Writer, message []byte) error {
+	_, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", message)
+	return err
+}
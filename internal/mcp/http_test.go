@@ -0,0 +1,145 @@
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"loopgate/internal/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postMCP(t *testing.T, url, sessionID, accept, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+	if sessionID != "" {
+		req.Header.Set(SessionIDHeader, sessionID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func initializeSession(t *testing.T, url string) string {
+	t.Helper()
+	resp := postMCP(t, url, "", "application/json, text/event-stream",
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	sessionID := resp.Header.Get(SessionIDHeader)
+	require.NotEmpty(t, sessionID)
+	return sessionID
+}
+
+func TestStreamableHTTP_SessionLifecycle(t *testing.T) {
+	server := httptest.NewServer(NewStreamableHTTPHandler(NewServer(nil, nil)))
+	defer server.Close()
+
+	// Requests other than initialize need a session
+	resp := postMCP(t, server.URL, "", "application/json", `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = postMCP(t, server.URL, "unknown", "application/json", `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	sessionID := initializeSession(t, server.URL)
+
+	resp = postMCP(t, server.URL, sessionID, "application/json", `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	resp = postMCP(t, server.URL, sessionID, "application/json",
+		`[{"jsonrpc":"2.0","id":"a","method":"ping"},{"jsonrpc":"2.0","id":"b","method":"tools/list"}]`)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var batch []types.MCPResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&batch))
+	require.Len(t, batch, 2)
+	assert.Equal(t, "2.0", batch[0].JSONRPC)
+	assert.Equal(t, "a", batch[0].ID)
+	assert.Equal(t, "b", batch[1].ID)
+
+	req, err := http.NewRequest(http.MethodDelete, server.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set(SessionIDHeader, sessionID)
+	deleteResp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	deleteResp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, deleteResp.StatusCode)
+
+	resp = postMCP(t, server.URL, sessionID, "application/json", `{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "ended sessions are not accepted")
+}
+
+func TestStreamableHTTP_NegotiatesProtocolVersion(t *testing.T) {
+	server := httptest.NewServer(NewStreamableHTTPHandler(NewServer(nil, nil)))
+	defer server.Close()
+
+	resp := postMCP(t, server.URL, "", "application/json",
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`)
+	defer resp.Body.Close()
+
+	var response struct {
+		Result types.MCPInitializeResult `json:"result"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+	assert.Equal(t, "2024-11-05", response.Result.ProtocolVersion)
+}
+
+func TestStreamableHTTP_StreamedResponse(t *testing.T) {
+	server := httptest.NewServer(NewStreamableHTTPHandler(NewServer(nil, nil)))
+	defer server.Close()
+
+	sessionID := initializeSession(t, server.URL)
+
+	resp := postMCP(t, server.URL, sessionID, "application/json, text/event-stream",
+		`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"request_human_input_and_wait","arguments":{},"_meta":{"progressToken":"p1"}}}`)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var data string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data: ") {
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+
+	var response types.MCPResponse
+	require.NoError(t, json.Unmarshal([]byte(data), &response))
+	assert.Equal(t, float64(7), response.ID)
+	result := response.Result.(map[string]interface{})
+	assert.Equal(t, true, result["isError"], "the HITL engine is not configured in this test")
+}
+
+func TestStreamableHTTP_GetStreamRequiresEventStream(t *testing.T) {
+	server := httptest.NewServer(NewStreamableHTTPHandler(NewServer(nil, nil)))
+	defer server.Close()
+
+	sessionID := initializeSession(t, server.URL)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set(SessionIDHeader, sessionID)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+}
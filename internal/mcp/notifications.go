@@ -0,0 +1,48 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"loopgate/internal/types"
+)
+
+// NotifyFunc delivers a server-initiated JSON-RPC message to the client that
+// made the current request. Transports install one with WithNotifier.
+type NotifyFunc func(message []byte) error
+
+type notifierKey struct{}
+
+// WithNotifier returns a context whose tool calls send notifications, such as
+// notifications/progress, through fn.
+func WithNotifier(ctx context.Context, fn NotifyFunc) context.Context {
+	return context.WithValue(ctx, notifierKey{}, fn)
+}
+
+// notify sends a notification to the client if the transport supports it. It
+// is a no-op otherwise, since notifications are best effort.
+func notify(ctx context.Context, method string, params interface{}) {
+	fn, ok := ctx.Value(notifierKey{}).(NotifyFunc)
+	if !ok || fn == nil {
+		return
+	}
+
+	message, err := json.Marshal(types.MCPNotification{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return
+	}
+	fn(message)
+}
+
+// progressTokenFrom returns the progressToken from a request's _meta, or nil
+// if the client did not ask for progress notifications.
+func progressTokenFrom(params map[string]interface{}) interface{} {
+	meta, ok := params["_meta"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return meta["progressToken"]
+}
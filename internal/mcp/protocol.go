@@ -1,35 +1,80 @@
 package mcp
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"loopgate/internal/middleware"
+	"loopgate/internal/notifier"
+	"loopgate/internal/session"
+	"loopgate/internal/storage"
 	"loopgate/internal/types"
+	"time"
 )
 
 const (
-	ProtocolVersion = "2024-11-05"
+	ProtocolVersion = "2025-03-26"
 	ServerName      = "loopgate"
 	ServerVersion   = "1.0.0"
+
+	// defaultProgressInterval is how often request_human_input_and_wait
+	// reports progress while the human has not answered yet.
+	defaultProgressInterval = 10 * time.Second
 )
 
-type Protocol struct{}
+// supportedProtocolVersions lists the MCP revisions this server can speak.
+// The first entry is used when a client asks for one we do not know.
+var supportedProtocolVersions = []string{ProtocolVersion, "2024-11-05"}
+
+type Protocol struct {
+	sessionManager   *session.Manager
+	notifiers        *notifier.Registry
+	progressInterval time.Duration
+}
 
-func NewProtocol() *Protocol {
-	return &Protocol{}
+// NewProtocol creates a Protocol backed by the given HITL engine. Either
+// dependency may be nil, in which case the HITL tools report an error
+// instead of doing any work.
+func NewProtocol(sessionManager *session.Manager, notifiers *notifier.Registry) *Protocol {
+	return &Protocol{
+		sessionManager:   sessionManager,
+		notifiers:        notifiers,
+		progressInterval: defaultProgressInterval,
+	}
 }
 
 func (p *Protocol) HandleRequest(requestData []byte) ([]byte, error) {
+	return p.HandleRequestContext(context.Background(), requestData)
+}
+
+// HandleRequestContext is like HandleRequest but aborts long-running tool
+// calls, such as request_human_input_and_wait, when ctx is done. Progress
+// notifications go to the NotifyFunc installed with WithNotifier, if any.
+//
+// Notifications from the client (messages without an id) get no response;
+// the returned slice is nil.
+func (p *Protocol) HandleRequestContext(ctx context.Context, requestData []byte) ([]byte, error) {
 	var req types.MCPRequest
 	if err := json.Unmarshal(requestData, &req); err != nil {
 		return p.createErrorResponse(nil, -32700, "Parse error", nil)
 	}
 
+	if req.ID == nil {
+		// notifications/initialized, notifications/cancelled and friends.
+		// Nothing here needs to act on them.
+		return nil, nil
+	}
+
 	switch req.Method {
 	case "initialize":
 		return p.handleInitialize(req)
+	case "ping":
+		return p.createSuccessResponse(req.ID, map[string]interface{}{})
 	case "tools/list":
 		return p.handleToolsList(req)
 	case "tools/call":
-		return p.handleToolsCall(req)
+		return p.handleToolsCall(ctx, req)
 	default:
 		return p.createErrorResponse(req.ID, -32601, "Method not found", nil)
 	}
@@ -37,7 +82,7 @@ func (p *Protocol) HandleRequest(requestData []byte) ([]byte, error) {
 
 func (p *Protocol) handleInitialize(req types.MCPRequest) ([]byte, error) {
 	result := types.MCPInitializeResult{
-		ProtocolVersion: ProtocolVersion,
+		ProtocolVersion: negotiateProtocolVersion(req.Params),
 		Capabilities: types.MCPCapabilities{
 			Tools: map[string]interface{}{
 				"listChanged": true,
@@ -52,48 +97,32 @@ func (p *Protocol) handleInitialize(req types.MCPRequest) ([]byte, error) {
 	return p.createSuccessResponse(req.ID, result)
 }
 
+// negotiateProtocolVersion echoes the client's requested version when we
+// support it, and otherwise offers our latest one.
+func negotiateProtocolVersion(params interface{}) string {
+	if paramsMap, ok := params.(map[string]interface{}); ok {
+		if requested, ok := paramsMap["protocolVersion"].(string); ok {
+			for _, version := range supportedProtocolVersions {
+				if version == requested {
+					return version
+				}
+			}
+		}
+	}
+	return supportedProtocolVersions[0]
+}
+
 func (p *Protocol) handleToolsList(req types.MCPRequest) ([]byte, error) {
 	tools := []types.MCPTool{
 		{
 			Name:        "request_human_input",
 			Description: "Request human input for decision making or approval",
-			InputSchema: map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"client_id": map[string]interface{}{
-						"type":        "string",
-						"description": "Unique identifier for the AI client",
-					},
-					"session_id": map[string]interface{}{
-						"type":        "string",
-						"description": "Session identifier for routing",
-					},
-					"message": map[string]interface{}{
-						"type":        "string",
-						"description": "Message to display to the human",
-					},
-					"request_type": map[string]interface{}{
-						"type":        "string",
-						"enum":        []string{"confirmation", "input", "choice"},
-						"description": "Type of human input requested",
-					},
-					"options": map[string]interface{}{
-						"type":        "array",
-						"items":       map[string]string{"type": "string"},
-						"description": "Available choices for choice type requests",
-					},
-					"timeout_seconds": map[string]interface{}{
-						"type":        "number",
-						"description": "Request timeout in seconds",
-						"default":     300,
-					},
-					"metadata": map[string]interface{}{
-						"type":        "object",
-						"description": "Additional metadata for the request",
-					},
-				},
-				"required": []string{"client_id", "session_id", "message"},
-			},
+			InputSchema: requestHumanInputSchema(),
+		},
+		{
+			Name:        "request_human_input_and_wait",
+			Description: "Request human input and wait until the human answers, the request is canceled, or timeout_seconds elapses",
+			InputSchema: requestHumanInputSchema(),
 		},
 		{
 			Name:        "check_request_status",
@@ -140,7 +169,94 @@ func (p *Protocol) handleToolsList(req types.MCPRequest) ([]byte, error) {
 	return p.createSuccessResponse(req.ID, result)
 }
 
-func (p *Protocol) handleToolsCall(req types.MCPRequest) ([]byte, error) {
+// requestHumanInputSchema is shared by request_human_input and
+// request_human_input_and_wait, which accept the same arguments.
+func requestHumanInputSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"client_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Unique identifier for the AI client",
+			},
+			"session_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Session identifier for routing",
+			},
+			"message": map[string]interface{}{
+				"type":        "string",
+				"description": "Message to display to the human",
+			},
+			"format": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"plain", "markdown", "html"},
+				"description": "Markup of the message: plain text, Telegram MarkdownV2 or Telegram HTML",
+				"default":     "plain",
+			},
+			"request_type": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"confirmation", "input", "choice"},
+				"description": "Type of human input requested",
+			},
+			"options": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]string{"type": "string"},
+				"description": "Available choices for choice type requests",
+			},
+			"timeout_seconds": map[string]interface{}{
+				"type":        "number",
+				"description": "Request timeout in seconds",
+				"default":     300,
+			},
+			"metadata": map[string]interface{}{
+				"type":        "object",
+				"description": "Additional metadata for the request",
+			},
+			"quorum": map[string]interface{}{
+				"type":        "object",
+				"description": "Require several named approvers to approve, e.g. 2 of 3 for production deploys",
+				"properties": map[string]interface{}{
+					"approvers": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]string{"type": "string"},
+						"description": "User IDs of the approvers, each prefixed with its channel, e.g. \"slack:U0123\" or \"telegram:123456789\"",
+					},
+					"required": map[string]interface{}{
+						"type":        "number",
+						"description": "Number of approvals needed",
+					},
+					"veto": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Reject the request as soon as any approver rejects it",
+					},
+				},
+				"required": []string{"approvers", "required"},
+			},
+			"escalation": map[string]interface{}{
+				"type":        "array",
+				"description": "Steps that re-send the request to further targets while nobody answers, before it finally times out",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"after_seconds": map[string]interface{}{
+							"type":        "number",
+							"description": "Seconds after the request was created to escalate if it is still pending",
+						},
+						"targets": map[string]interface{}{
+							"type":        "array",
+							"description": "Where to send the request, e.g. {\"channel\": \"telegram\", \"telegram_id\": 123} or {\"channel\": \"slack\", \"recipient\": \"U0123\"}",
+							"items":       map[string]string{"type": "object"},
+						},
+					},
+					"required": []string{"after_seconds", "targets"},
+				},
+			},
+		},
+		"required": []string{"client_id", "session_id", "message"},
+	}
+}
+
+func (p *Protocol) handleToolsCall(ctx context.Context, req types.MCPRequest) ([]byte, error) {
 	paramsMap, ok := req.Params.(map[string]interface{})
 	if !ok {
 		return p.createErrorResponse(req.ID, -32602, "Invalid params", nil)
@@ -158,78 +274,287 @@ func (p *Protocol) handleToolsCall(req types.MCPRequest) ([]byte, error) {
 
 	switch toolName {
 	case "request_human_input":
-		return p.handleRequestHumanInput(req.ID, arguments)
+		return p.handleRequestHumanInput(ctx, req.ID, arguments)
+	case "request_human_input_and_wait":
+		return p.handleRequestHumanInputAndWait(ctx, req.ID, progressTokenFrom(paramsMap), arguments)
 	case "check_request_status":
-		return p.handleCheckRequestStatus(req.ID, arguments)
+		return p.handleCheckRequestStatus(ctx, req.ID, arguments)
 	case "list_pending_requests":
-		return p.handleListPendingRequests(req.ID, arguments)
+		return p.handleListPendingRequests(ctx, req.ID, arguments)
 	case "cancel_request":
-		return p.handleCancelRequest(req.ID, arguments)
+		return p.handleCancelRequest(ctx, req.ID, arguments)
 	default:
 		return p.createErrorResponse(req.ID, -32601, "Tool not found", nil)
 	}
 }
 
-func (p *Protocol) handleRequestHumanInput(requestID interface{}, args map[string]interface{}) ([]byte, error) {
-	result := map[string]interface{}{
-		"content": []map[string]interface{}{
-			{
-				"type": "text",
-				"text": "MCP tool call received. Use HTTP API endpoint /hitl/request to submit the actual request.",
-			},
-		},
-		"isError": false,
+func (p *Protocol) handleRequestHumanInput(ctx context.Context, requestID interface{}, args map[string]interface{}) ([]byte, error) {
+	req, err := p.submitRequest(ctx, args)
+	if err != nil {
+		return p.createToolError(requestID, err.Error())
 	}
 
-	return p.createSuccessResponse(requestID, result)
+	return p.createToolResult(requestID, map[string]interface{}{
+		"request_id": req.ID,
+		"status":     req.Status,
+		"created_at": req.CreatedAt,
+	})
 }
 
-func (p *Protocol) handleCheckRequestStatus(requestID interface{}, args map[string]interface{}) ([]byte, error) {
-	result := map[string]interface{}{
-		"content": []map[string]interface{}{
-			{
-				"type": "text",
-				"text": "Use HTTP API endpoint /hitl/poll?request_id=<id> to check request status.",
-			},
-		},
-		"isError": false,
+// handleRequestHumanInputAndWait submits a request and holds the tools/call
+// open until the request is completed, canceled or times out, so agents do
+// not need their own polling loop around check_request_status. If the client
+// sent a progressToken, it gets notifications/progress while it waits.
+func (p *Protocol) handleRequestHumanInputAndWait(ctx context.Context, requestID interface{}, progressToken interface{}, args map[string]interface{}) ([]byte, error) {
+	req, err := p.submitRequest(ctx, args)
+	if err != nil {
+		return p.createToolError(requestID, err.Error())
+	}
+
+	deadline := req.CreatedAt.Add(time.Duration(req.Timeout) * time.Second)
+	waitCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	type waitResult struct {
+		request *types.HITLRequest
+		err     error
+	}
+	done := make(chan waitResult, 1)
+	go func() {
+		current, err := p.sessionManager.WaitForResolution(waitCtx, req.ID)
+		done <- waitResult{current, err}
+	}()
+
+	var ticks <-chan time.Time
+	if progressToken != nil {
+		p.sendProgress(ctx, progressToken, req, deadline)
+		ticker := time.NewTicker(p.progressInterval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	var result waitResult
+wait:
+	for {
+		select {
+		case result = <-done:
+			break wait
+		case <-ticks:
+			p.sendProgress(ctx, progressToken, req, deadline)
+		}
+	}
+
+	current, err := result.request, result.err
+	if ctx.Err() != nil {
+		return p.createToolError(requestID, fmt.Sprintf("Stopped waiting for request %s: %v", req.ID, ctx.Err()))
+	}
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return p.createToolError(requestID, fmt.Sprintf("Error waiting for request %s: %v", req.ID, err))
+	}
+
+	if current.Status == types.RequestStatusPending {
+		// The expirer may not have swept the request yet, but its time is up.
+		// Expire it now so that everyone sees the status the agent is told.
+		if err := p.sessionManager.ExpireRequest(req.ID); err != nil && !errors.Is(err, storage.ErrRequestNotPending) {
+			return p.createToolError(requestID, fmt.Sprintf("Failed to expire request %s: %v", req.ID, err))
+		}
+		if current, err = p.sessionManager.GetRequest(req.ID); err != nil {
+			return p.createToolError(requestID, fmt.Sprintf("Failed to load request %s: %v", req.ID, err))
+		}
+	}
+	return p.createToolResult(requestID, types.NewPollResponse(current))
+}
+
+// sendProgress reports how long the request has been waiting, measured in
+// seconds against its timeout.
+func (p *Protocol) sendProgress(ctx context.Context, token interface{}, req *types.HITLRequest, deadline time.Time) {
+	elapsed := time.Since(req.CreatedAt)
+	remaining := time.Until(deadline).Round(time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	notify(ctx, "notifications/progress", map[string]interface{}{
+		"progressToken": token,
+		"progress":      elapsed.Seconds(),
+		"total":         float64(req.Timeout),
+		"message":       fmt.Sprintf("Waiting for a human to answer request %s (%s left)", req.ID, remaining),
+	})
+}
+
+// submitRequest builds a HITLRequest from tool arguments, stores it and sends
+// it over the session's notification channel. It applies the same defaults as the /hitl/request endpoint,
+// and the request is owned by the API key user in ctx.
+func (p *Protocol) submitRequest(ctx context.Context, args map[string]interface{}) (*types.HITLRequest, error) {
+	if p.sessionManager == nil || p.notifiers == nil {
+		return nil, fmt.Errorf("HITL engine is not configured on this server")
+	}
+
+	req := &types.HITLRequest{UserID: middleware.APIKeyUserID(ctx)}
+	req.SessionID, _ = args["session_id"].(string)
+	req.ClientID, _ = args["client_id"].(string)
+	req.Message, _ = args["message"].(string)
+
+	if requestType, ok := args["request_type"].(string); ok {
+		req.RequestType = types.RequestType(requestType)
+	}
+	if options, ok := args["options"].([]interface{}); ok {
+		for _, option := range options {
+			if str, ok := option.(string); ok {
+				req.Options = append(req.Options, str)
+			}
+		}
+	}
+	if timeout, ok := args["timeout_seconds"].(float64); ok {
+		req.Timeout = int(timeout)
+	}
+	if format, ok := args["format"].(string); ok {
+		req.Format = types.MessageFormat(format)
+	}
+	if metadata, ok := args["metadata"].(map[string]interface{}); ok {
+		req.Metadata = metadata
+	}
+	if quorum, ok := args["quorum"].(map[string]interface{}); ok {
+		req.Quorum = &types.Quorum{}
+		if approvers, ok := quorum["approvers"].([]interface{}); ok {
+			for _, approver := range approvers {
+				if str, ok := approver.(string); ok {
+					req.Quorum.Approvers = append(req.Quorum.Approvers, str)
+				}
+			}
+		}
+		if required, ok := quorum["required"].(float64); ok {
+			req.Quorum.Required = int(required)
+		}
+		req.Quorum.Veto, _ = quorum["veto"].(bool)
+	}
+	if escalation, ok := args["escalation"].([]interface{}); ok {
+		for _, item := range escalation {
+			step, _ := item.(map[string]interface{})
+			var parsed types.EscalationStep
+			if after, ok := step["after_seconds"].(float64); ok {
+				parsed.After = int(after)
+			}
+			targets, _ := step["targets"].([]interface{})
+			for _, t := range targets {
+				target, _ := t.(map[string]interface{})
+				channel, _ := target["channel"].(string)
+				telegramID, _ := target["telegram_id"].(float64)
+				recipient, _ := target["recipient"].(string)
+				parsed.Targets = append(parsed.Targets, types.ChannelTarget{Channel: channel, TelegramID: int64(telegramID), Recipient: recipient})
+			}
+			req.Escalation = append(req.Escalation, parsed)
+		}
+	}
+
+	if err := p.sessionManager.Submit(req, p.notifiers); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (p *Protocol) handleCheckRequestStatus(ctx context.Context, requestID interface{}, args map[string]interface{}) ([]byte, error) {
+	if p.sessionManager == nil {
+		return p.createToolError(requestID, "HITL engine is not configured on this server")
+	}
+
+	id, _ := args["request_id"].(string)
+	if id == "" {
+		return p.createToolError(requestID, "Missing request_id")
+	}
+
+	request, err := p.sessionManager.GetUserRequest(middleware.APIKeyUserID(ctx), id)
+	if err != nil {
+		return p.createToolError(requestID, fmt.Sprintf("Request not found: %v", err))
+	}
+
+	return p.createToolResult(requestID, types.NewPollResponse(request))
+}
+
+func (p *Protocol) handleListPendingRequests(ctx context.Context, requestID interface{}, args map[string]interface{}) ([]byte, error) {
+	if p.sessionManager == nil {
+		return p.createToolError(requestID, "HITL engine is not configured on this server")
+	}
+
+	pending, err := p.sessionManager.GetPendingRequestsByUser(middleware.APIKeyUserID(ctx))
+	if err != nil {
+		return p.createToolError(requestID, fmt.Sprintf("Error retrieving pending requests: %v", err))
+	}
+
+	return p.createToolResult(requestID, map[string]interface{}{
+		"pending_requests": pending,
+		"count":            len(pending),
+	})
+}
+
+func (p *Protocol) handleCancelRequest(ctx context.Context, requestID interface{}, args map[string]interface{}) ([]byte, error) {
+	if p.sessionManager == nil {
+		return p.createToolError(requestID, "HITL engine is not configured on this server")
+	}
+
+	id, _ := args["request_id"].(string)
+	if id == "" {
+		return p.createToolError(requestID, "Missing request_id")
+	}
+
+	if _, err := p.sessionManager.GetUserRequest(middleware.APIKeyUserID(ctx), id); err != nil {
+		return p.createToolError(requestID, fmt.Sprintf("Request not found: %v", err))
+	}
+
+	if err := p.sessionManager.CancelRequest(id); err != nil {
+		return p.createToolError(requestID, fmt.Sprintf("Failed to cancel request: %v", err))
 	}
 
-	return p.createSuccessResponse(requestID, result)
+	return p.createToolResult(requestID, map[string]interface{}{
+		"success":    true,
+		"request_id": id,
+		"status":     types.RequestStatusCanceled,
+	})
 }
 
-func (p *Protocol) handleListPendingRequests(requestID interface{}, args map[string]interface{}) ([]byte, error) {
+// createToolResult wraps payload as the JSON text content of a successful
+// tools/call result.
+func (p *Protocol) createToolResult(id interface{}, payload interface{}) ([]byte, error) {
+	text, err := json.Marshal(payload)
+	if err != nil {
+		return p.createErrorResponse(id, -32603, "Internal error", err.Error())
+	}
+
 	result := map[string]interface{}{
 		"content": []map[string]interface{}{
 			{
 				"type": "text",
-				"text": "Use HTTP API endpoint /hitl/pending to list pending requests.",
+				"text": string(text),
 			},
 		},
 		"isError": false,
 	}
 
-	return p.createSuccessResponse(requestID, result)
+	return p.createSuccessResponse(id, result)
 }
 
-func (p *Protocol) handleCancelRequest(requestID interface{}, args map[string]interface{}) ([]byte, error) {
+// createToolError reports a tool-level failure. Per the MCP spec these are
+// returned as a successful JSON-RPC response with isError set, so the agent
+// can see and react to the message.
+func (p *Protocol) createToolError(id interface{}, message string) ([]byte, error) {
 	result := map[string]interface{}{
 		"content": []map[string]interface{}{
 			{
 				"type": "text",
-				"text": "Use HTTP API endpoint /hitl/cancel to cancel a request.",
+				"text": message,
 			},
 		},
-		"isError": false,
+		"isError": true,
 	}
 
-	return p.createSuccessResponse(requestID, result)
+	return p.createSuccessResponse(id, result)
 }
 
 func (p *Protocol) createSuccessResponse(id interface{}, result interface{}) ([]byte, error) {
 	response := types.MCPResponse{
-		Result: result,
-		ID:     id,
+		JSONRPC: "2.0",
+		Result:  result,
+		ID:      id,
 	}
 
 	return json.Marshal(response)
@@ -237,6 +562,7 @@ func (p *Protocol) createSuccessResponse(id interface{}, result interface{}) ([]
 
 func (p *Protocol) createErrorResponse(id interface{}, code int, message string, data interface{}) ([]byte, error) {
 	response := types.MCPResponse{
+		JSONRPC: "2.0",
 		Error: &types.MCPError{
 			Code:    code,
 			Message: message,
@@ -254,6 +580,10 @@ func (p *Protocol) GetAvailableTools() []types.MCPTool {
 			Name:        "request_human_input",
 			Description: "Request human input for decision making or approval",
 		},
+		{
+			Name:        "request_human_input_and_wait",
+			Description: "Request human input and wait for the answer",
+		},
 		{
 			Name:        "check_request_status",
 			Description: "Check the status of a human input request",
@@ -0,0 +1,320 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"loopgate/internal/notifier"
+	"loopgate/internal/session"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtocol_SendProgress(t *testing.T) {
+	var sent [][]byte
+	ctx := WithNotifier(context.Background(), func(message []byte) error {
+		sent = append(sent, message)
+		return nil
+	})
+
+	p := NewProtocol(nil, nil)
+	req := &types.HITLRequest{ID: "req-1", Timeout: 60, CreatedAt: time.Now().Add(-15 * time.Second)}
+	p.sendProgress(ctx, "token-1", req, req.CreatedAt.Add(time.Minute))
+
+	require.Len(t, sent, 1)
+	var notification struct {
+		JSONRPC string                 `json:"jsonrpc"`
+		Method  string                 `json:"method"`
+		ID      interface{}            `json:"id"`
+		Params  map[string]interface{} `json:"params"`
+	}
+	require.NoError(t, json.Unmarshal(sent[0], &notification))
+	assert.Equal(t, "2.0", notification.JSONRPC)
+	assert.Equal(t, "notifications/progress", notification.Method)
+	assert.Nil(t, notification.ID)
+	assert.Equal(t, "token-1", notification.Params["progressToken"])
+	assert.InDelta(t, 15, notification.Params["progress"], 1)
+	assert.Equal(t, float64(60), notification.Params["total"])
+	assert.Contains(t, notification.Params["message"], "req-1")
+}
+
+func TestProtocol_NotificationsGetNoResponse(t *testing.T) {
+	p := NewProtocol(nil, nil)
+
+	response, err := p.HandleRequest([]byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+	require.NoError(t, err)
+	assert.Nil(t, response)
+
+	response, err = p.HandleRequest([]byte(`{"jsonrpc":"2.0","id":3,"method":"ping"}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":3,"result":{}}`, string(response))
+}
+
+// fakeNotifier delivers requests nowhere and records their IDs. With sendErr
+// set every delivery fails.
+type fakeNotifier struct {
+	mu      sync.Mutex
+	sent    []string
+	sendErr error
+}
+
+func (f *fakeNotifier) Channel() string { return notifier.DefaultChannel }
+
+func (f *fakeNotifier) SendRequest(request *types.HITLRequest, sess *types.Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, request.ID)
+	return f.sendErr
+}
+
+func (f *fakeNotifier) NotifyResolved(request *types.HITLRequest, sess *types.Session) error {
+	return nil
+}
+
+func (f *fakeNotifier) Start() {}
+func (f *fakeNotifier) Stop()  {}
+
+func setupProtocol(t *testing.T) (*Protocol, *session.Manager, *fakeNotifier) {
+	t.Helper()
+	manager := session.NewManager(storage.NewInMemoryStorageAdapter())
+	registry := notifier.NewRegistry(manager)
+	fake := &fakeNotifier{}
+	registry.Register(fake)
+	require.NoError(t, manager.CreateSession(&types.Session{ID: "s1", ClientID: "agent", TelegramID: 1}))
+	return NewProtocol(manager, registry), manager, fake
+}
+
+// callTool calls a tool and returns the text of its result and whether it
+// is an error.
+func callTool(t *testing.T, p *Protocol, name string, args map[string]interface{}) (string, bool) {
+	t.Helper()
+	request, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params":  map[string]interface{}{"name": name, "arguments": args},
+	})
+	require.NoError(t, err)
+
+	data, err := p.HandleRequest(request)
+	require.NoError(t, err)
+	var response struct {
+		Result struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+			IsError bool `json:"isError"`
+		} `json:"result"`
+		Error *types.MCPError `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(data, &response))
+	require.Nil(t, response.Error, fmt.Sprintf("tools/call %s failed: %s", name, data))
+	require.Len(t, response.Result.Content, 1)
+	return response.Result.Content[0].Text, response.Result.IsError
+}
+
+func TestProtocol_WaitExpiresTheRequest(t *testing.T) {
+	p, manager, _ := setupProtocol(t)
+
+	text, isError := callTool(t, p, "request_human_input_and_wait", map[string]interface{}{
+		"session_id": "s1", "client_id": "agent", "message": "Deploy?", "timeout_seconds": 1,
+	})
+	require.False(t, isError, text)
+
+	var result types.PollResponse
+	require.NoError(t, json.Unmarshal([]byte(text), &result))
+	assert.Equal(t, types.RequestStatusTimeout, result.Status)
+	assert.True(t, result.Completed)
+
+	request, err := manager.GetRequest(result.RequestID)
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusTimeout, request.Status, "the stored request agrees with the agent")
+}
+
+func TestProtocol_RejectsNegativeTimeout(t *testing.T) {
+	p, _, fake := setupProtocol(t)
+
+	text, isError := callTool(t, p, "request_human_input", map[string]interface{}{
+		"session_id": "s1", "client_id": "agent", "message": "Deploy?", "timeout_seconds": -5,
+	})
+	assert.True(t, isError)
+	assert.Contains(t, text, "timeout_seconds must not be negative")
+	assert.Empty(t, fake.sent)
+}
+
+func TestProtocol_RequestHumanInput(t *testing.T) {
+	p, manager, fake := setupProtocol(t)
+
+	text, isError := callTool(t, p, "request_human_input", map[string]interface{}{
+		"session_id": "s1", "client_id": "agent", "message": "Deploy?",
+		"options": []string{"Approve", "Reject"}, "metadata": map[string]interface{}{"env": "prod"},
+	})
+	require.False(t, isError, text)
+
+	var result struct {
+		RequestID string              `json:"request_id"`
+		Status    types.RequestStatus `json:"status"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(text), &result))
+	assert.Equal(t, types.RequestStatusPending, result.Status)
+	assert.Equal(t, []string{result.RequestID}, fake.sent)
+
+	request, err := manager.GetRequest(result.RequestID)
+	require.NoError(t, err)
+	assert.Equal(t, "Deploy?", request.Message)
+	assert.Equal(t, []string{"Approve", "Reject"}, request.Options)
+	assert.Equal(t, types.RequestTypeChoice, request.RequestType)
+	assert.Equal(t, 300, request.Timeout)
+	assert.Equal(t, map[string]interface{}{"env": "prod"}, request.Metadata)
+}
+
+func TestProtocol_RequestHumanInputErrors(t *testing.T) {
+	p, _, fake := setupProtocol(t)
+	require.NoError(t, p.sessionManager.CreateSession(&types.Session{ID: "other", ClientID: "agent", TelegramID: 2, UserID: "someone-else"}))
+	require.NoError(t, p.sessionManager.CreateSession(&types.Session{ID: "closed", ClientID: "agent", TelegramID: 3}))
+	require.NoError(t, p.sessionManager.DeactivateSession("closed"))
+
+	for _, tt := range []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"missing message", map[string]interface{}{"session_id": "s1", "client_id": "agent"}, "Missing required fields"},
+		{"missing session", map[string]interface{}{"client_id": "agent", "message": "Deploy?"}, "Missing required fields"},
+		{"unknown session", map[string]interface{}{"session_id": "nope", "client_id": "agent", "message": "Deploy?"}, "Session not found"},
+		{"another user's session", map[string]interface{}{"session_id": "other", "client_id": "agent", "message": "Deploy?"}, "Session not found"},
+		{"inactive session", map[string]interface{}{"session_id": "closed", "client_id": "agent", "message": "Deploy?"}, "Session is not active"},
+		{"invalid format", map[string]interface{}{"session_id": "s1", "client_id": "agent", "message": "Deploy?", "format": "rst"}, "Invalid format"},
+		{"quorum without options", map[string]interface{}{"session_id": "s1", "client_id": "agent", "message": "Deploy?",
+			"quorum": map[string]interface{}{"approvers": []string{"ada"}, "required": 1}}, "quorum requires a request with options"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			text, isError := callTool(t, p, "request_human_input", tt.args)
+			assert.True(t, isError)
+			assert.Contains(t, text, tt.want)
+		})
+	}
+	assert.Empty(t, fake.sent)
+}
+
+func TestProtocol_RequestHumanInputDeliveryFailure(t *testing.T) {
+	p, manager, fake := setupProtocol(t)
+	fake.sendErr = errors.New("telegram is down")
+
+	text, isError := callTool(t, p, "request_human_input", map[string]interface{}{
+		"session_id": "s1", "client_id": "agent", "message": "Deploy?",
+	})
+	assert.True(t, isError)
+	assert.Contains(t, text, "Failed to deliver request")
+
+	// The undelivered request is not left pending
+	require.Len(t, fake.sent, 1)
+	request, err := manager.GetRequest(fake.sent[0])
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCanceled, request.Status)
+}
+
+func TestProtocol_CheckListAndCancel(t *testing.T) {
+	p, manager, _ := setupProtocol(t)
+
+	var ids []string
+	for _, message := range []string{"Deploy?", "Roll back?"} {
+		text, isError := callTool(t, p, "request_human_input", map[string]interface{}{
+			"session_id": "s1", "client_id": "agent", "message": message,
+		})
+		require.False(t, isError, text)
+		var result struct {
+			RequestID string `json:"request_id"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(text), &result))
+		ids = append(ids, result.RequestID)
+	}
+
+	text, isError := callTool(t, p, "list_pending_requests", nil)
+	require.False(t, isError, text)
+	var pending struct {
+		Count int `json:"count"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(text), &pending))
+	assert.Equal(t, 2, pending.Count)
+
+	responder := &types.Responder{Channel: "telegram", UserID: "7", Name: "ada"}
+	require.NoError(t, manager.UpdateRequestResponse(ids[0], "Yes", true, responder))
+	text, isError = callTool(t, p, "check_request_status", map[string]interface{}{"request_id": ids[0]})
+	require.False(t, isError, text)
+	var status types.PollResponse
+	require.NoError(t, json.Unmarshal([]byte(text), &status))
+	assert.Equal(t, types.RequestStatusCompleted, status.Status)
+	assert.True(t, status.Completed)
+	assert.Equal(t, "Yes", status.Response)
+	assert.Equal(t, responder, status.Responder)
+
+	text, isError = callTool(t, p, "cancel_request", map[string]interface{}{"request_id": ids[1]})
+	require.False(t, isError, text)
+	assert.Contains(t, text, `"status":"canceled"`)
+	request, err := manager.GetRequest(ids[1])
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCanceled, request.Status)
+
+	for _, tt := range []struct {
+		tool string
+		args map[string]interface{}
+		want string
+	}{
+		{"check_request_status", nil, "Missing request_id"},
+		{"check_request_status", map[string]interface{}{"request_id": "nope"}, "Request not found"},
+		{"cancel_request", nil, "Missing request_id"},
+		{"cancel_request", map[string]interface{}{"request_id": "nope"}, "Request not found"},
+		{"cancel_request", map[string]interface{}{"request_id": ids[0]}, "Failed to cancel request"},
+	} {
+		text, isError := callTool(t, p, tt.tool, tt.args)
+		assert.True(t, isError, "%s %v", tt.tool, tt.args)
+		assert.Contains(t, text, tt.want)
+	}
+}
+
+func TestProtocol_ToolsCallErrors(t *testing.T) {
+	p, _, _ := setupProtocol(t)
+
+	response, err := p.HandleRequest([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"no_such_tool"}}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"Tool not found"}}`, string(response))
+
+	response, err = p.HandleRequest([]byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{}}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":2,"error":{"code":-32602,"message":"Missing tool name"}}`, string(response))
+
+	// Without a HITL engine every tool reports an error instead of failing
+	unconfigured := NewProtocol(nil, nil)
+	for _, tool := range []string{"request_human_input", "check_request_status", "list_pending_requests", "cancel_request"} {
+		text, isError := callTool(t, unconfigured, tool, map[string]interface{}{"request_id": "req-1"})
+		assert.True(t, isError, tool)
+		assert.Contains(t, text, "not configured", tool)
+	}
+}
+
+func TestProtocol_ToolsList(t *testing.T) {
+	response, err := NewProtocol(nil, nil).HandleRequest([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	require.NoError(t, err)
+
+	var result struct {
+		Result struct {
+			Tools []types.MCPTool `json:"tools"`
+		} `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(response, &result))
+	var names []string
+	for _, tool := range result.Result.Tools {
+		names = append(names, tool.Name)
+		assert.NotNil(t, tool.InputSchema, tool.Name)
+	}
+	assert.Equal(t, []string{"request_human_input", "request_human_input_and_wait", "check_request_status",
+		"list_pending_requests", "cancel_request"}, names)
+}
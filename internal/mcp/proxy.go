@@ -0,0 +1,281 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"loopgate/internal/types"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Proxy speaks MCP over stdio and forwards every message to the /mcp
+// endpoint of a running Loopgate server, so desktop MCP clients can launch a
+// local command while the shared server owns Telegram and storage.
+// Responses and notifications, including progress while waiting for a
+// human, are written back to the output as they arrive.
+type Proxy struct {
+	endpoint string
+	apiKey   string
+	client   *http.Client
+	input    io.Reader
+	output   io.Writer
+	writeMu  sync.Mutex
+
+	mu        sync.Mutex
+	sessionID string
+	// initialize is the client's initialize request. It is replayed to get a
+	// new session if the server forgets ours, for example after a restart.
+	initialize []byte
+}
+
+// NewProxy forwards MCP messages from input to the server at serverURL,
+// authenticating with apiKey if it is set.
+func NewProxy(serverURL, apiKey string, input io.Reader, output io.Writer) *Proxy {
+	return &Proxy{
+		endpoint: strings.TrimRight(serverURL, "/") + "/mcp",
+		apiKey:   apiKey,
+		// No client timeout: request_human_input_and_wait holds the call open
+		// until the human answers, and the server enforces that timeout.
+		client: &http.Client{},
+		input:  input,
+		output: output,
+	}
+}
+
+// Start forwards messages until the input is closed, then ends the server
+// session. Messages are forwarded concurrently, so a call waiting for a
+// human does not hold up the rest, except initialize, which is answered
+// before anything after it is sent.
+func (p *Proxy) Start() error {
+	log.Printf("Proxying MCP over stdio to %s", p.endpoint)
+
+	scanner := bufio.NewScanner(p.input)
+	scanner.Buffer(make([]byte, 64*1024), maxHTTPBodyBytes)
+	var wg sync.WaitGroup
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		message := []byte(line)
+		var envelope rpcEnvelope
+		if err := json.Unmarshal(message, &envelope); err != nil {
+			p.writeError(nil, -32700, "Parse error")
+			continue
+		}
+
+		if envelope.Method == "initialize" {
+			// Every later message needs the session initialize creates, so
+			// nothing else is forwarded until the server has answered it.
+			wg.Wait()
+			p.forward(message, envelope)
+			continue
+		}
+
+		wg.Add(1)
+		go func(message []byte, envelope rpcEnvelope) {
+			defer wg.Done()
+			p.forward(message, envelope)
+		}(message, envelope)
+	}
+
+	wg.Wait()
+	p.endSession()
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading input: %w", err)
+	}
+	return nil
+}
+
+func (p *Proxy) forward(message []byte, envelope rpcEnvelope) {
+	if envelope.Method == "initialize" {
+		p.mu.Lock()
+		p.initialize = message
+		p.sessionID = ""
+		p.mu.Unlock()
+	}
+
+	if err := p.post(message, envelope.Method == "initialize", true); err != nil {
+		log.Printf("Error forwarding %s: %v", envelope.Method, err)
+		if envelope.isRequest() {
+			p.writeError(envelope.ID, -32603, fmt.Sprintf("Loopgate server error: %v", err))
+		}
+	}
+}
+
+// post sends one message and copies whatever the server answers to the
+// output. If the server no longer knows our session it starts a new one and
+// retries once.
+func (p *Proxy) post(message []byte, initialize bool, retry bool) error {
+	p.mu.Lock()
+	sessionID := p.sessionID
+	p.mu.Unlock()
+
+	resp, err := p.do(message, sessionID)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound && sessionID != "" && !initialize && retry {
+		io.Copy(io.Discard, resp.Body)
+		if err := p.reinitialize(sessionID); err != nil {
+			return fmt.Errorf("session expired and could not be renewed: %w", err)
+		}
+		return p.post(message, false, false)
+	}
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if initialize {
+		p.mu.Lock()
+		p.sessionID = resp.Header.Get(SessionIDHeader)
+		p.mu.Unlock()
+	}
+
+	if resp.StatusCode == http.StatusAccepted {
+		return nil
+	}
+	return p.copyMessages(resp)
+}
+
+func (p *Proxy) do(message []byte, sessionID string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, p.endpoint, bytes.NewReader(message))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	p.setHeaders(req, sessionID)
+
+	return p.client.Do(req)
+}
+
+// reinitialize replays the client's initialize request to get a new
+// session. Concurrent callers that saw the same stale session only renew it
+// once.
+func (p *Proxy) reinitialize(staleSessionID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sessionID != staleSessionID {
+		return nil
+	}
+	if p.initialize == nil {
+		return fmt.Errorf("no initialize request to replay")
+	}
+
+	resp, err := p.do(p.initialize, "")
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("initialize returned %s", resp.Status)
+	}
+	p.sessionID = resp.Header.Get(SessionIDHeader)
+
+	notification, _ := json.Marshal(types.MCPNotification{JSONRPC: "2.0", Method: "notifications/initialized"})
+	resp, err = p.do(notification, p.sessionID)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// copyMessages writes each JSON-RPC message in the response to the output,
+// one per line. The response is either plain JSON or an SSE stream.
+func (p *Proxy) copyMessages(resp *http.Response) error {
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if body = bytes.TrimSpace(body); len(body) > 0 {
+			return p.writeMessage(body)
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxHTTPBodyBytes)
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		case line == "" && len(data) > 0:
+			if err := p.writeMessage([]byte(strings.Join(data, "\n"))); err != nil {
+				return err
+			}
+			data = nil
+		}
+	}
+	return scanner.Err()
+}
+
+// endSession tells the server we are done so it can drop the session early.
+func (p *Proxy) endSession() {
+	p.mu.Lock()
+	sessionID := p.sessionID
+	p.mu.Unlock()
+	if sessionID == "" {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, p.endpoint, nil)
+	if err != nil {
+		return
+	}
+	p.setHeaders(req, sessionID)
+	if resp, err := p.client.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+func (p *Proxy) setHeaders(req *http.Request, sessionID string) {
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	if sessionID != "" {
+		req.Header.Set(SessionIDHeader, sessionID)
+	}
+}
+
+func (p *Proxy) writeError(id json.RawMessage, code int, message string) {
+	response := types.MCPResponse{
+		JSONRPC: "2.0",
+		Error:   &types.MCPError{Code: code, Message: message},
+	}
+	if id != nil {
+		response.ID = id
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+	p.writeMessage(data)
+}
+
+func (p *Proxy) writeMessage(message []byte) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	_, err := p.output.Write(append(message, '\n'))
+	return err
+}
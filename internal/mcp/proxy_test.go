@@ -0,0 +1,137 @@
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"loopgate/internal/types"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func proxySession(p *Proxy) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sessionID
+}
+
+func TestProxy_ForwardsToServer(t *testing.T) {
+	handler := NewStreamableHTTPHandler(NewServer(nil, nil))
+	var authHeader atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader.Store(r.Header.Get("Authorization"))
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	proxy := NewProxy(server.URL+"/", "lk_test", inReader, outWriter)
+
+	done := make(chan error, 1)
+	go func() { done <- proxy.Start() }()
+
+	output := bufio.NewReader(outReader)
+	call := func(message string) types.MCPResponse {
+		t.Helper()
+		_, err := io.WriteString(inWriter, message+"\n")
+		require.NoError(t, err)
+		line, err := output.ReadBytes('\n')
+		require.NoError(t, err)
+		var response types.MCPResponse
+		require.NoError(t, json.Unmarshal(line, &response))
+		return response
+	}
+
+	response := call(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`)
+	require.Nil(t, response.Error)
+	assert.Equal(t, "Bearer lk_test", authHeader.Load())
+	firstSession := proxySession(proxy)
+	require.NotEmpty(t, firstSession)
+
+	_, err := io.WriteString(inWriter, `{"jsonrpc":"2.0","method":"notifications/initialized"}`+"\n")
+	require.NoError(t, err)
+
+	response = call(`{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+	assert.Nil(t, response.Error)
+	assert.Equal(t, float64(2), response.ID)
+
+	// The server forgets the session, as after a restart. The proxy replays
+	// initialize and retries.
+	handler.mu.Lock()
+	delete(handler.sessions, firstSession)
+	handler.mu.Unlock()
+
+	response = call(`{"jsonrpc":"2.0","id":3,"method":"tools/list"}`)
+	require.Nil(t, response.Error)
+	assert.Contains(t, response.Result.(map[string]interface{}), "tools")
+	assert.NotEqual(t, firstSession, proxySession(proxy))
+
+	inWriter.Close()
+	require.NoError(t, <-done)
+
+	handler.mu.Lock()
+	assert.Empty(t, handler.sessions, "the session is ended when stdin closes")
+	handler.mu.Unlock()
+}
+
+func TestProxy_PipelinedInitialize(t *testing.T) {
+	server := httptest.NewServer(NewStreamableHTTPHandler(NewServer(nil, nil)))
+	defer server.Close()
+
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	proxy := NewProxy(server.URL, "", inReader, outWriter)
+	done := make(chan error, 1)
+	go func() { done <- proxy.Start() }()
+
+	// Clients may send the handshake and their first call without waiting
+	// for the initialize response.
+	go io.WriteString(inWriter, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`+"\n"+
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`+"\n"+
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`+"\n")
+
+	output := bufio.NewReader(outReader)
+	responses := map[float64]types.MCPResponse{}
+	for i := 0; i < 2; i++ {
+		line, err := output.ReadBytes('\n')
+		require.NoError(t, err)
+		var response types.MCPResponse
+		require.NoError(t, json.Unmarshal(line, &response))
+		require.Nil(t, response.Error, string(line))
+		responses[response.ID.(float64)] = response
+	}
+	assert.Contains(t, responses, float64(1))
+	require.Contains(t, responses, float64(2))
+	assert.Contains(t, responses[2].Result.(map[string]interface{}), "tools")
+
+	inWriter.Close()
+	require.NoError(t, <-done)
+}
+
+func TestProxy_ReportsUnreachableServer(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	proxy := NewProxy(server.URL, "", inReader, outWriter)
+	go proxy.Start()
+	defer inWriter.Close()
+
+	_, err := io.WriteString(inWriter, `{"jsonrpc":"2.0","id":"x","method":"initialize"}`+"\n")
+	require.NoError(t, err)
+
+	line, err := bufio.NewReader(outReader).ReadBytes('\n')
+	require.NoError(t, err)
+	var response types.MCPResponse
+	require.NoError(t, json.Unmarshal(line, &response))
+	require.NotNil(t, response.Error)
+	assert.Equal(t, -32603, response.Error.Code)
+	assert.Equal(t, "x", response.ID)
+}
@@ -2,59 +2,78 @@ package mcp
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"loopgate/internal/notifier"
+	"loopgate/internal/session"
 	"os"
+	"sync"
 )
 
 type Server struct {
 	protocol *Protocol
 	input    io.Reader
 	output   io.Writer
+	writeMu  sync.Mutex
 }
 
-func NewServer() *Server {
+func NewServer(sessionManager *session.Manager, notifiers *notifier.Registry) *Server {
 	return &Server{
-		protocol: NewProtocol(),
+		protocol: NewProtocol(sessionManager, notifiers),
 		input:    os.Stdin,
 		output:   os.Stdout,
 	}
 }
 
-func NewServerWithStreams(input io.Reader, output io.Writer) *Server {
+func NewServerWithStreams(input io.Reader, output io.Writer, sessionManager *session.Manager, notifiers *notifier.Registry) *Server {
 	return &Server{
-		protocol: NewProtocol(),
+		protocol: NewProtocol(sessionManager, notifiers),
 		input:    input,
 		output:   output,
 	}
 }
 
+// Start reads newline-delimited JSON-RPC messages from the input until EOF.
+// Each request is handled on its own goroutine so a tool call that waits for
+// a human does not hold up pings or other calls; responses and progress
+// notifications are written to the output as they become ready.
 func (s *Server) Start() error {
 	log.Println("Starting MCP server...")
-	
+
+	ctx := WithNotifier(context.Background(), s.writeMessage)
 	scanner := bufio.NewScanner(s.input)
-	
+	var wg sync.WaitGroup
+
 	for scanner.Scan() {
 		line := scanner.Text()
 		if line == "" {
 			continue
 		}
 
-		response, err := s.protocol.HandleRequest([]byte(line))
-		if err != nil {
-			log.Printf("Error handling request: %v", err)
-			continue
-		}
+		wg.Add(1)
+		go func(data []byte) {
+			defer wg.Done()
 
-		_, err = s.output.Write(append(response, '\n'))
-		if err != nil {
-			log.Printf("Error writing response: %v", err)
-			return err
-		}
+			response, err := s.protocol.HandleRequestContext(ctx, data)
+			if err != nil {
+				log.Printf("Error handling request: %v", err)
+				return
+			}
+			if response == nil {
+				return
+			}
+
+			if err := s.writeMessage(response); err != nil {
+				log.Printf("Error writing response: %v", err)
+			}
+		}([]byte(line))
 	}
 
+	wg.Wait()
+
 	if err := scanner.Err(); err != nil {
 		return fmt.Errorf("error reading input: %w", err)
 	}
@@ -62,8 +81,18 @@ func (s *Server) Start() error {
 	return nil
 }
 
-func (s *Server) HandleHTTPRequest(requestData []byte) ([]byte, error) {
-	return s.protocol.HandleRequest(requestData)
+func (s *Server) writeMessage(message []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	_, err := s.output.Write(append(message, '\n'))
+	return err
+}
+
+// HandleHTTPRequest processes a single MCP request. ctx should be the HTTP
+// request's context so blocking tools stop waiting when the client goes away.
+func (s *Server) HandleHTTPRequest(ctx context.Context, requestData []byte) ([]byte, error) {
+	return s.protocol.HandleRequestContext(ctx, requestData)
 }
 
 func (s *Server) GetCapabilities() map[string]interface{} {
@@ -9,6 +9,8 @@ import (
 
 	"loopgate/internal/auth"
 	"loopgate/internal/storage"
+
+	"github.com/google/uuid"
 )
 
 type contextKey string
@@ -103,3 +105,14 @@ func APIKeyAuthMiddleware(storageAdapter storage.StorageAdapter) func(http.Handl
 		})
 	}
 }
+
+// APIKeyUserID returns the ID of the user whose API key authenticated the
+// request, as set by APIKeyAuthMiddleware, or "" if there is none. HITL
+// sessions and requests are owned by this ID.
+func APIKeyUserID(ctx context.Context) string {
+	userID, ok := ctx.Value(APIKeyUserContextKey).(uuid.UUID)
+	if !ok {
+		return ""
+	}
+	return userID.String()
+}
@@ -0,0 +1,104 @@
+package notifier
+
+import (
+	"log"
+	"loopgate/internal/session"
+	"sync"
+	"time"
+)
+
+// Escalator periodically scans pending requests and sends the ones that have
+// waited past an escalation step to that step's targets, so a secondary
+// approver hears about a request the primary one has not answered. Each step
+// is taken once: the level is raised in storage before sending, so replicas
+// sharing a database do not send it twice.
+type Escalator struct {
+	manager  *session.Manager
+	registry *Registry
+	interval time.Duration
+	now      func() time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewEscalator creates an Escalator that sweeps every interval and delivers
+// through registry.
+func NewEscalator(manager *session.Manager, registry *Registry, interval time.Duration) *Escalator {
+	return &Escalator{
+		manager:  manager,
+		registry: registry,
+		interval: interval,
+		now:      time.Now,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs an initial sweep and then one per interval until Stop is called.
+// It blocks, so callers usually run it in its own goroutine.
+func (e *Escalator) Start() {
+	log.Printf("Starting request escalator (interval %s)...", e.interval)
+
+	e.Sweep()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.Sweep()
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// Stop ends the sweep loop started by Start.
+func (e *Escalator) Stop() {
+	e.stopOnce.Do(func() { close(e.stop) })
+}
+
+// Sweep escalates every pending request that is due for its next step and
+// returns how many it escalated. Steps missed while the server was down are
+// sent together.
+func (e *Escalator) Sweep() int {
+	pending, err := e.manager.GetPendingRequests()
+	if err != nil {
+		log.Printf("Escalator: error getting pending requests: %v", err)
+		return 0
+	}
+
+	now := e.now()
+	escalated := 0
+	for _, request := range pending {
+		from := request.EscalationLevel
+		level := from
+		for level < len(request.Escalation) &&
+			!now.Before(request.CreatedAt.Add(time.Duration(request.Escalation[level].After)*time.Second)) {
+			level++
+		}
+		if level == from {
+			continue
+		}
+
+		advanced, err := e.manager.AdvanceEscalation(request.ID, level)
+		if err != nil {
+			log.Printf("Escalator: error escalating request %s: %v", request.ID, err)
+			continue
+		}
+		if !advanced {
+			// Answered, or escalated by another replica, since the scan.
+			continue
+		}
+
+		escalation := *request
+		escalation.EscalationLevel = level
+		if err := e.registry.Escalate(&escalation, from, now.Sub(request.CreatedAt)); err != nil {
+			log.Printf("Escalator: error sending request %s to escalation step %d: %v", request.ID, level, err)
+			continue
+		}
+		escalated++
+		log.Printf("Request %s escalated to step %d", request.ID, level)
+	}
+	return escalated
+}
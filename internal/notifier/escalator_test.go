@@ -0,0 +1,58 @@
+package notifier
+
+import (
+	"loopgate/internal/types"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscalator_Sweep(t *testing.T) {
+	manager, registry, telegram, slack := setupRegistry(t)
+	escalator := NewEscalator(manager, registry, time.Minute)
+
+	created := time.Now()
+	now := created
+	escalator.now = func() time.Time { return now }
+
+	escalation := []types.EscalationStep{
+		{After: 60, Targets: []types.ChannelTarget{{Channel: "slack", Recipient: "C2"}}},
+		{After: 120, Targets: []types.ChannelTarget{{TelegramID: 3}}},
+	}
+	for _, id := range []string{"req-1", "req-2"} {
+		request := &types.HITLRequest{ID: id, SessionID: "tg", Message: "Deploy?", Status: types.RequestStatusPending,
+			Timeout: 600, Escalation: escalation, CreatedAt: created}
+		require.NoError(t, manager.StoreRequest(request))
+		require.NoError(t, registry.Send(request))
+	}
+
+	now = created.Add(30 * time.Second)
+	assert.Equal(t, 0, escalator.Sweep())
+
+	// req-1 is answered after the first step; req-2 is not
+	now = created.Add(61 * time.Second)
+	assert.Equal(t, 2, escalator.Sweep())
+	assert.Equal(t, 0, escalator.Sweep())
+	assert.ElementsMatch(t, []string{"req-1", "req-2"}, slack.sent)
+	assert.Equal(t, "⏫ Escalated: no answer after 1m1s.\n\nDeploy?", slack.messages[0])
+
+	request, err := manager.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, request.EscalationLevel)
+	assert.Equal(t, 101, request.TelegramMsgID, "the request keeps its first message")
+
+	require.NoError(t, manager.UpdateRequestResponse("req-1", "Yes", true, nil))
+	// Both the first message and the escalated one show the outcome
+	assert.Equal(t, []string{"101@1"}, telegram.resolvedIDs)
+	assert.Equal(t, []string{"C2:req-1"}, slack.resolvedIDs)
+
+	now = created.Add(10 * time.Minute)
+	assert.Equal(t, 1, escalator.Sweep())
+	assert.Equal(t, []string{"req-1", "req-2", "req-2"}, telegram.sent)
+
+	request, err = manager.GetRequest("req-2")
+	require.NoError(t, err)
+	assert.Equal(t, 2, request.EscalationLevel)
+}
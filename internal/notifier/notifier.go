@@ -0,0 +1,483 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"loopgate/internal/session"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// DefaultChannel delivers requests for sessions registered without a
+// channel, which includes every session created before channels existed.
+const DefaultChannel = "telegram"
+
+// ErrChannelNotConfigured is returned when a session asks for a channel that
+// has no notifier on this server.
+var ErrChannelNotConfigured = errors.New("notification channel is not configured")
+
+// Notifier delivers HITL requests to humans over one channel, such as
+// Telegram, and records their answers through the session manager.
+type Notifier interface {
+	// Channel is the name sessions use to select this notifier.
+	Channel() string
+	// SendRequest delivers a new pending request to the session's human.
+	SendRequest(request *types.HITLRequest, sess *types.Session) error
+	// NotifyResolved updates the delivered message after the request has been
+	// answered, canceled or timed out.
+	NotifyResolved(request *types.HITLRequest, sess *types.Session) error
+	// Start receives responses from the channel until Stop is called. It
+	// blocks, so callers usually run it in its own goroutine.
+	Start()
+	Stop()
+}
+
+// WebhookReceiver is implemented by notifiers whose channel delivers answers
+// as HTTP callbacks, such as Slack interactions. The routes are served
+// without an API key, so the notifier must authenticate callbacks itself.
+type WebhookReceiver interface {
+	RegisterRoutes(router *mux.Router)
+}
+
+// Reminder is implemented by notifiers that can remind the human of a
+// request that is still pending, e.g. by replying to the request message.
+type Reminder interface {
+	// SendReminder reminds sess's human of the delivered request. remaining
+	// is the time left before it times out, or zero if it never does.
+	SendReminder(request *types.HITLRequest, sess *types.Session, remaining time.Duration) error
+}
+
+// OptionApproves reports whether choosing option counts as an approval.
+// Every option approves except cancel, reject and deny.
+func OptionApproves(option string) bool {
+	switch strings.ToLower(option) {
+	case "cancel", "reject", "deny":
+		return false
+	}
+	return true
+}
+
+// MatchOption maps a typed answer to one of options: it accepts an option's
+// 1-based number or, ignoring case, its text.
+func MatchOption(options []string, text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if n, err := strconv.Atoi(text); err == nil {
+		if n >= 1 && n <= len(options) {
+			return options[n-1], true
+		}
+		return "", false
+	}
+	for _, option := range options {
+		if strings.EqualFold(option, text) {
+			return option, true
+		}
+	}
+	return "", false
+}
+
+// VoteRefusal explains to a human why their answer to a quorum request was
+// not counted. It returns "" if err is not a refused vote.
+func VoteRefusal(err error) string {
+	switch {
+	case errors.Is(err, storage.ErrNotApprover):
+		return "You are not one of the approvers of this request."
+	case errors.Is(err, storage.ErrAlreadyVoted):
+		return "You have already voted on this request."
+	}
+	return ""
+}
+
+// ChannelOf returns the channel that delivers sess's requests.
+func ChannelOf(sess *types.Session) string {
+	if sess.Channel == "" {
+		return DefaultChannel
+	}
+	return sess.Channel
+}
+
+// Registry routes requests to the notifier of their session's channel.
+type Registry struct {
+	manager *session.Manager
+
+	mu        sync.RWMutex
+	notifiers map[string]Notifier
+}
+
+// NewRegistry creates an empty Registry. Register a notifier for every
+// channel this server supports.
+func NewRegistry(manager *session.Manager) *Registry {
+	return &Registry{
+		manager:   manager,
+		notifiers: make(map[string]Notifier),
+	}
+}
+
+// Register adds n, replacing any notifier for the same channel.
+func (r *Registry) Register(n Notifier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifiers[n.Channel()] = n
+}
+
+// Get returns the notifier for channel; "" means DefaultChannel.
+func (r *Registry) Get(channel string) (Notifier, bool) {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n, ok := r.notifiers[channel]
+	return n, ok
+}
+
+// Channels lists the configured channels in name order.
+func (r *Registry) Channels() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	channels := make([]string, 0, len(r.notifiers))
+	for channel := range r.notifiers {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// ValidateTarget checks that target's channel is configured and that it
+// names a chat on it. An empty channel means DefaultChannel.
+func (r *Registry) ValidateTarget(target types.ChannelTarget) error {
+	if target.Channel == "" {
+		target.Channel = DefaultChannel
+	}
+	if target.Channel == DefaultChannel && target.TelegramID == 0 {
+		return errors.New("Missing required field: telegram_id")
+	}
+	if target.Channel != DefaultChannel && target.Recipient == "" {
+		return errors.New("Missing required field: recipient")
+	}
+	if _, ok := r.Get(target.Channel); !ok {
+		return fmt.Errorf("Channel %q is not configured; available channels: %v", target.Channel, r.Channels())
+	}
+	return nil
+}
+
+// TargetsOf lists every place sess's requests are delivered to: its own
+// channel first, then its extra targets.
+func TargetsOf(sess *types.Session) []types.ChannelTarget {
+	targets := []types.ChannelTarget{{Channel: ChannelOf(sess), TelegramID: sess.TelegramID, Recipient: sess.Recipient}}
+	for _, target := range sess.Targets {
+		if target.Channel == "" {
+			target.Channel = DefaultChannel
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// targetSession is sess as seen by the notifier of target: a copy addressed
+// to target alone.
+func targetSession(sess *types.Session, target types.ChannelTarget) *types.Session {
+	view := *sess
+	view.Channel = target.Channel
+	view.TelegramID = target.TelegramID
+	view.Recipient = target.Recipient
+	view.Targets = nil
+	return &view
+}
+
+// recipientKey is the chat a target addresses, as stored in ChannelMessage.
+func recipientKey(target types.ChannelTarget) string {
+	if target.Channel == DefaultChannel {
+		return strconv.FormatInt(target.TelegramID, 10)
+	}
+	return target.Recipient
+}
+
+// Send delivers a stored request to every target of its session and
+// publishes the sent event. It fails only if no target could be reached;
+// each delivered message is recorded so NotifyResolved can update it. The
+// message IDs of the first delivery are stored with the request; request
+// itself is left unchanged.
+func (r *Registry) Send(request *types.HITLRequest) error {
+	sess, err := r.manager.GetSession(request.SessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session %s: %w", request.SessionID, err)
+	}
+
+	targets := TargetsOf(sess)
+	first, err := r.deliver(request, sess, targets)
+	if err != nil {
+		return err
+	}
+
+	// Every delivery may store its message ID on the request; keep the first.
+	r.restoreMessageIDs(request.ID, first)
+	sent := *request
+	sent.TelegramMsgID = first.TelegramMsgID
+	sent.ChannelMsgID = first.ChannelMsgID
+	r.manager.MarkRequestSent(&sent)
+	return nil
+}
+
+// Escalate sends a pending request to the targets of its escalation steps
+// from (0-based) up to EscalationLevel, announcing how long it has waited.
+// The request keeps the message IDs of its first delivery. It fails only if
+// no target could be reached.
+func (r *Registry) Escalate(request *types.HITLRequest, from int, waited time.Duration) error {
+	sess, err := r.manager.GetSession(request.SessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session %s: %w", request.SessionID, err)
+	}
+
+	var targets []types.ChannelTarget
+	for _, step := range request.Escalation[from:request.EscalationLevel] {
+		for _, target := range step.Targets {
+			if target.Channel == "" {
+				target.Channel = DefaultChannel
+			}
+			targets = append(targets, target)
+		}
+	}
+
+	escalated := *request
+	escalated.Message = fmt.Sprintf("⏫ Escalated: no answer after %s.\n\n%s", waited.Round(time.Second), request.Message)
+	if _, err := r.deliver(&escalated, sess, targets); err != nil {
+		return err
+	}
+
+	r.restoreMessageIDs(request.ID, request)
+	r.manager.MarkRequestEscalated(request)
+	return nil
+}
+
+// deliver sends request to every target and returns the first delivered
+// copy. It fails only if no target could be reached; other failures are
+// logged.
+func (r *Registry) deliver(request *types.HITLRequest, sess *types.Session, targets []types.ChannelTarget) (*types.HITLRequest, error) {
+	var errs []error
+	var first *types.HITLRequest
+	for _, target := range targets {
+		delivered, err := r.sendTo(request, sess, target)
+		if err != nil && len(targets) > 1 {
+			err = fmt.Errorf("%s: %w", target.Channel, err)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if first == nil {
+			first = delivered
+		}
+	}
+	if first == nil {
+		return nil, errors.Join(errs...)
+	}
+	for _, err := range errs {
+		log.Printf("Notifier: request %s was not delivered everywhere: %v", request.ID, err)
+	}
+	return first, nil
+}
+
+// sendTo delivers a copy of request to target and records the message.
+func (r *Registry) sendTo(request *types.HITLRequest, sess *types.Session, target types.ChannelTarget) (*types.HITLRequest, error) {
+	n, ok := r.Get(target.Channel)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrChannelNotConfigured, target.Channel)
+	}
+
+	delivered := *request
+	delivered.TelegramMsgID = 0
+	delivered.ChannelMsgID = ""
+	if err := n.SendRequest(&delivered, targetSession(sess, target)); err != nil {
+		return nil, err
+	}
+
+	messageID := delivered.ChannelMsgID
+	if messageID == "" && delivered.TelegramMsgID != 0 {
+		messageID = strconv.Itoa(delivered.TelegramMsgID)
+	}
+	if messageID != "" {
+		if err := r.manager.RecordChannelMessage(request.ID, target.Channel, recipientKey(target), messageID); err != nil {
+			log.Printf("Notifier: error recording %s message for request %s: %v", target.Channel, request.ID, err)
+		}
+	}
+	return &delivered, nil
+}
+
+func (r *Registry) restoreMessageIDs(requestID string, first *types.HITLRequest) {
+	if err := r.manager.SetTelegramMsgID(requestID, first.TelegramMsgID); err != nil {
+		log.Printf("Notifier: error storing message ID of request %s: %v", requestID, err)
+	}
+	if err := r.manager.SetChannelMsgID(requestID, first.ChannelMsgID); err != nil {
+		log.Printf("Notifier: error storing message ID of request %s: %v", requestID, err)
+	}
+}
+
+// NotifyResolved updates every message a resolved request was delivered as,
+// so all of them show the outcome and who answered. It is a
+// session.ResolutionListener; errors are logged.
+func (r *Registry) NotifyResolved(request *types.HITLRequest) {
+	sess, err := r.manager.GetSession(request.SessionID)
+	if err != nil {
+		log.Printf("Notifier: error getting session %s for request %s: %v", request.SessionID, request.ID, err)
+		return
+	}
+
+	deliveries, err := r.deliveries(request, sess)
+	if err != nil {
+		log.Printf("Notifier: error getting messages of request %s: %v", request.ID, err)
+		return
+	}
+	for _, d := range deliveries {
+		r.notifyResolved(d.request, sess, d.target)
+	}
+}
+
+// Remind sends a reminder of a pending request to every message it was
+// delivered as on a channel whose notifier is a Reminder, and returns how
+// many were sent. remaining is the time left before the request times out.
+func (r *Registry) Remind(request *types.HITLRequest, remaining time.Duration) (int, error) {
+	sess, err := r.manager.GetSession(request.SessionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get session %s: %w", request.SessionID, err)
+	}
+	deliveries, err := r.deliveries(request, sess)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, d := range deliveries {
+		n, ok := r.Get(d.target.Channel)
+		if !ok {
+			continue
+		}
+		reminder, ok := n.(Reminder)
+		if !ok {
+			continue
+		}
+		if err := reminder.SendReminder(d.request, targetSession(sess, d.target), remaining); err != nil {
+			log.Printf("Notifier: error reminding %s of request %s: %v", d.target.Channel, request.ID, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// delivery is one message a request was delivered as: a copy of the request
+// carrying that message's ID, and the target it went to.
+type delivery struct {
+	request *types.HITLRequest
+	target  types.ChannelTarget
+}
+
+// deliveries lists the messages request was delivered as, oldest first.
+func (r *Registry) deliveries(request *types.HITLRequest, sess *types.Session) ([]delivery, error) {
+	messages, err := r.manager.GetChannelMessages(request.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]delivery, 0, len(messages))
+	for _, message := range messages {
+		if message.Reminder {
+			continue
+		}
+		target := types.ChannelTarget{Channel: message.Channel, Recipient: message.Recipient}
+		delivered := *request
+		delivered.TelegramMsgID = 0
+		delivered.ChannelMsgID = message.MessageID
+		if message.Channel == DefaultChannel {
+			target.Recipient = ""
+			target.TelegramID, _ = strconv.ParseInt(message.Recipient, 10, 64)
+			delivered.ChannelMsgID = ""
+			delivered.TelegramMsgID, _ = strconv.Atoi(message.MessageID)
+		}
+		deliveries = append(deliveries, delivery{request: &delivered, target: target})
+	}
+	if len(deliveries) == 0 {
+		// Delivered before messages were recorded
+		return []delivery{{request: request, target: TargetsOf(sess)[0]}}, nil
+	}
+	return deliveries, nil
+}
+
+// notifyResolved updates the message request was delivered as at target.
+func (r *Registry) notifyResolved(request *types.HITLRequest, sess *types.Session, target types.ChannelTarget) {
+	n, ok := r.Get(target.Channel)
+	if !ok {
+		return
+	}
+	if err := n.NotifyResolved(request, targetSession(sess, target)); err != nil {
+		log.Printf("Notifier: error updating %s message for request %s: %v", n.Channel(), request.ID, err)
+	}
+}
+
+// AnsweredBy describes who answered a completed request for resolved
+// messages, e.g. "Ada via slack". For quorum requests it lists every vote,
+// e.g. "Ada via slack: Approve, bob via telegram: Approve". It is empty if
+// unknown.
+func AnsweredBy(request *types.HITLRequest) string {
+	if len(request.Votes) > 0 {
+		votes := make([]string, len(request.Votes))
+		for i, vote := range request.Votes {
+			votes[i] = describeResponder(vote.Responder) + ": " + vote.Response
+		}
+		return strings.Join(votes, ", ")
+	}
+	return describeResponder(request.Responder)
+}
+
+func describeResponder(responder *types.Responder) string {
+	if responder == nil {
+		return ""
+	}
+	name := responder.Name
+	if name == "" {
+		name = responder.UserID
+	}
+	if name == "" {
+		return "via " + responder.Channel
+	}
+	return name + " via " + responder.Channel
+}
+
+// RegisterRoutes adds the callback routes of every notifier that is a
+// WebhookReceiver.
+func (r *Registry) RegisterRoutes(router *mux.Router) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, n := range r.notifiers {
+		if receiver, ok := n.(WebhookReceiver); ok {
+			receiver.RegisterRoutes(router)
+		}
+	}
+}
+
+// Start starts every registered notifier in its own goroutine.
+func (r *Registry) Start() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, n := range r.notifiers {
+		go n.Start()
+	}
+}
+
+// Stop stops every registered notifier.
+func (r *Registry) Stop() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, n := range r.notifiers {
+		n.Stop()
+	}
+}
@@ -0,0 +1,209 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"loopgate/internal/session"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeNotifier struct {
+	channel string
+	sendErr error
+
+	mu          sync.Mutex
+	sent        []string
+	messages    []string // Texts of the sent requests
+	resolved    []types.RequestStatus
+	resolvedIDs []string // Message IDs of resolved requests
+	reminders   []time.Duration
+}
+
+func (f *fakeNotifier) Channel() string { return f.channel }
+
+func (f *fakeNotifier) SendRequest(request *types.HITLRequest, sess *types.Session) error {
+	if f.sendErr != nil {
+		return f.sendErr
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, request.ID)
+	f.messages = append(f.messages, request.Message)
+	if f.channel == DefaultChannel {
+		request.TelegramMsgID = 100 + len(f.sent)
+	} else {
+		request.ChannelMsgID = sess.Recipient + ":" + request.ID
+	}
+	return nil
+}
+
+func (f *fakeNotifier) NotifyResolved(request *types.HITLRequest, sess *types.Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resolved = append(f.resolved, request.Status)
+	if f.channel == DefaultChannel {
+		f.resolvedIDs = append(f.resolvedIDs, fmt.Sprintf("%d@%d", request.TelegramMsgID, sess.TelegramID))
+	} else {
+		f.resolvedIDs = append(f.resolvedIDs, request.ChannelMsgID)
+	}
+	return nil
+}
+
+func (f *fakeNotifier) SendReminder(request *types.HITLRequest, sess *types.Session, remaining time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reminders = append(f.reminders, remaining)
+	return nil
+}
+
+func (f *fakeNotifier) Start() {}
+func (f *fakeNotifier) Stop()  {}
+
+func setupRegistry(t *testing.T) (*session.Manager, *Registry, *fakeNotifier, *fakeNotifier) {
+	t.Helper()
+	manager := session.NewManager(storage.NewInMemoryStorageAdapter())
+	registry := NewRegistry(manager)
+	manager.OnResolved(registry.NotifyResolved)
+
+	telegram := &fakeNotifier{channel: DefaultChannel}
+	slack := &fakeNotifier{channel: "slack"}
+	registry.Register(telegram)
+	registry.Register(slack)
+
+	require.NoError(t, manager.CreateSession(&types.Session{ID: "tg", ClientID: "agent", TelegramID: 1}))
+	require.NoError(t, manager.CreateSession(&types.Session{ID: "sl", ClientID: "agent", Channel: "slack"}))
+	return manager, registry, telegram, slack
+}
+
+func TestRegistry_SendRoutesBySessionChannel(t *testing.T) {
+	manager, registry, telegram, slack := setupRegistry(t)
+	assert.Equal(t, []string{"slack", "telegram"}, registry.Channels())
+
+	events, unsubscribe := manager.Hub().Subscribe(nil)
+	defer unsubscribe()
+
+	for _, req := range []*types.HITLRequest{
+		{ID: "req-tg", SessionID: "tg", Status: types.RequestStatusPending, CreatedAt: time.Now()},
+		{ID: "req-sl", SessionID: "sl", Status: types.RequestStatusPending, CreatedAt: time.Now()},
+	} {
+		require.NoError(t, manager.StoreRequest(req))
+		require.NoError(t, registry.Send(req))
+	}
+
+	assert.Equal(t, []string{"req-tg"}, telegram.sent, "sessions without a channel use the default")
+	assert.Equal(t, []string{"req-sl"}, slack.sent)
+
+	var sent []string
+	for len(events) > 0 {
+		if event := <-events; event.Type == session.EventRequestSent {
+			sent = append(sent, event.Request.ID)
+			if event.Request.ID == "req-tg" {
+				assert.Equal(t, 101, event.Request.TelegramMsgID)
+			}
+		}
+	}
+	assert.Equal(t, []string{"req-tg", "req-sl"}, sent)
+
+	// The message IDs of the delivery are stored with the request
+	request, err := manager.GetRequest("req-sl")
+	require.NoError(t, err)
+	assert.Equal(t, ":req-sl", request.ChannelMsgID)
+}
+
+func TestRegistry_SendErrors(t *testing.T) {
+	manager, registry, telegram, _ := setupRegistry(t)
+	require.NoError(t, manager.CreateSession(&types.Session{ID: "email", ClientID: "agent", Channel: "email"}))
+
+	req := &types.HITLRequest{ID: "req-email", SessionID: "email", Status: types.RequestStatusPending, CreatedAt: time.Now()}
+	require.NoError(t, manager.StoreRequest(req))
+	assert.ErrorIs(t, registry.Send(req), ErrChannelNotConfigured)
+
+	events, unsubscribe := manager.Hub().Subscribe(nil)
+	defer unsubscribe()
+
+	telegram.sendErr = errors.New("chat not found")
+	req = &types.HITLRequest{ID: "req-tg", SessionID: "tg", Status: types.RequestStatusPending, CreatedAt: time.Now()}
+	require.NoError(t, manager.StoreRequest(req))
+	assert.EqualError(t, registry.Send(req), "chat not found")
+
+	for len(events) > 0 {
+		assert.NotEqual(t, session.EventRequestSent, (<-events).Type, "a failed delivery is not published as sent")
+	}
+}
+
+func TestRegistry_NotifyResolved(t *testing.T) {
+	manager, _, telegram, slack := setupRegistry(t)
+
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{ID: "req-1", SessionID: "sl", Status: types.RequestStatusPending, CreatedAt: time.Now()}))
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{ID: "req-2", SessionID: "sl", Status: types.RequestStatusPending, CreatedAt: time.Now()}))
+
+	require.NoError(t, manager.UpdateRequestResponse("req-1", "yes", true, nil))
+	require.NoError(t, manager.CancelRequest("req-2"))
+
+	assert.Equal(t, []types.RequestStatus{types.RequestStatusCompleted, types.RequestStatusCanceled}, slack.resolved)
+	assert.Empty(t, telegram.resolved)
+}
+
+func TestRegistry_FanOutFirstAnswerWins(t *testing.T) {
+	manager, registry, telegram, slack := setupRegistry(t)
+	require.NoError(t, manager.CreateSession(&types.Session{
+		ID: "fan", ClientID: "agent", Channel: "slack", Recipient: "C1",
+		Targets: []types.ChannelTarget{
+			{Channel: DefaultChannel, TelegramID: 42},
+			{Channel: "slack", Recipient: "C2"},
+			{Channel: "email", Recipient: "ada@example.com"}, // Not configured
+		},
+	}))
+
+	req := &types.HITLRequest{ID: "req-fan", SessionID: "fan", Status: types.RequestStatusPending, CreatedAt: time.Now()}
+	require.NoError(t, manager.StoreRequest(req))
+	require.NoError(t, registry.Send(req), "delivery succeeds if any target is reached")
+
+	assert.Equal(t, []string{"req-fan", "req-fan"}, slack.sent)
+	assert.Equal(t, []string{"req-fan"}, telegram.sent)
+	stored, err := manager.GetRequest("req-fan")
+	require.NoError(t, err)
+	assert.Equal(t, "C1:req-fan", stored.ChannelMsgID, "the session's own channel is the primary message")
+
+	messages, err := manager.GetChannelMessages("req-fan")
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	assert.Equal(t, DefaultChannel, messages[1].Channel)
+	assert.Equal(t, "42", messages[1].Recipient)
+	assert.Equal(t, "101", messages[1].MessageID)
+
+	responder := &types.Responder{Channel: DefaultChannel, UserID: "7", Name: "ada"}
+	require.NoError(t, manager.UpdateRequestResponse("req-fan", "yes", true, responder))
+	assert.ErrorIs(t, manager.UpdateRequestResponse("req-fan", "no", false, nil), storage.ErrRequestNotPending)
+
+	// Every delivered message is updated, each at its own chat
+	assert.Equal(t, []string{"C1:req-fan", "C2:req-fan"}, slack.resolvedIDs)
+	assert.Equal(t, []string{"101@42"}, telegram.resolvedIDs)
+
+	request, err := manager.GetRequest("req-fan")
+	require.NoError(t, err)
+	assert.Equal(t, "yes", request.Response)
+	assert.Equal(t, "ada via telegram", AnsweredBy(request))
+}
+
+func TestRegistry_FanOutFailsWhenNoTargetIsReached(t *testing.T) {
+	manager, registry, telegram, _ := setupRegistry(t)
+	require.NoError(t, manager.CreateSession(&types.Session{
+		ID: "fan", ClientID: "agent", TelegramID: 1,
+		Targets: []types.ChannelTarget{{Channel: "email", Recipient: "ada@example.com"}},
+	}))
+	telegram.sendErr = errors.New("chat not found")
+
+	req := &types.HITLRequest{ID: "req-fan", SessionID: "fan", Status: types.RequestStatusPending, CreatedAt: time.Now()}
+	require.NoError(t, manager.StoreRequest(req))
+	err := registry.Send(req)
+	assert.ErrorIs(t, err, ErrChannelNotConfigured)
+	assert.ErrorContains(t, err, "telegram: chat not found")
+}
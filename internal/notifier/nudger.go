@@ -0,0 +1,114 @@
+package notifier
+
+import (
+	"log"
+	"loopgate/internal/session"
+	"sync"
+	"time"
+)
+
+// Nudger periodically reminds humans of requests that are still pending, so
+// they do not get buried in busy chats and silently expire. A request gets
+// its nth reminder n intervals after it was created, up to maxCount
+// reminders, and none once it is due to time out.
+type Nudger struct {
+	manager  *session.Manager
+	registry *Registry
+	interval time.Duration
+	maxCount int
+	sweep    time.Duration
+	now      func() time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewNudger creates a Nudger that sends up to maxCount reminders per
+// request, one every interval, checking for due reminders every sweep.
+func NewNudger(manager *session.Manager, registry *Registry, interval time.Duration, maxCount int, sweep time.Duration) *Nudger {
+	return &Nudger{
+		manager:  manager,
+		registry: registry,
+		interval: interval,
+		maxCount: maxCount,
+		sweep:    sweep,
+		now:      time.Now,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs an initial sweep and then one per sweep interval until Stop is
+// called. It blocks, so callers usually run it in its own goroutine.
+func (n *Nudger) Start() {
+	log.Printf("Starting request reminders (every %s, at most %d per request)...", n.interval, n.maxCount)
+
+	n.Sweep()
+
+	ticker := time.NewTicker(n.sweep)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			n.Sweep()
+		case <-n.stop:
+			return
+		}
+	}
+}
+
+// Stop ends the sweep loop started by Start.
+func (n *Nudger) Stop() {
+	n.stopOnce.Do(func() { close(n.stop) })
+}
+
+// Sweep reminds the humans of every pending request that is due for a
+// reminder and returns how many requests it reminded them of. Reminders
+// missed while the server was down are not made up for; the request just
+// gets the latest one.
+func (n *Nudger) Sweep() int {
+	pending, err := n.manager.GetPendingRequests()
+	if err != nil {
+		log.Printf("Nudger: error getting pending requests: %v", err)
+		return 0
+	}
+
+	now := n.now()
+	reminded := 0
+	for _, request := range pending {
+		count := int(now.Sub(request.CreatedAt) / n.interval)
+		if count > n.maxCount {
+			count = n.maxCount
+		}
+		if count <= request.RemindersSent {
+			continue
+		}
+
+		var remaining time.Duration
+		if request.Timeout > 0 {
+			remaining = request.CreatedAt.Add(time.Duration(request.Timeout) * time.Second).Sub(now)
+			if remaining <= 0 {
+				continue // The expirer is about to time it out.
+			}
+		}
+
+		advanced, err := n.manager.AdvanceReminders(request.ID, count)
+		if err != nil {
+			log.Printf("Nudger: error recording reminder of request %s: %v", request.ID, err)
+			continue
+		}
+		if !advanced {
+			// Answered, or reminded by another replica, since the scan.
+			continue
+		}
+
+		sent, err := n.registry.Remind(request, remaining)
+		if err != nil {
+			log.Printf("Nudger: error reminding of request %s: %v", request.ID, err)
+			continue
+		}
+		if sent > 0 {
+			reminded++
+		}
+	}
+	return reminded
+}
@@ -0,0 +1,53 @@
+package notifier
+
+import (
+	"loopgate/internal/types"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNudger_Sweep(t *testing.T) {
+	manager, registry, telegram, slack := setupRegistry(t)
+	nudger := NewNudger(manager, registry, time.Minute, 2, time.Second)
+
+	created := time.Now()
+	now := created
+	nudger.now = func() time.Time { return now }
+
+	require.NoError(t, manager.CreateSession(&types.Session{ID: "both", ClientID: "agent", TelegramID: 1,
+		Targets: []types.ChannelTarget{{Channel: "slack", Recipient: "C1"}}}))
+	for _, request := range []*types.HITLRequest{
+		{ID: "req-1", SessionID: "both", Timeout: 600},
+		{ID: "short", SessionID: "tg", Timeout: 90},
+	} {
+		request.Status = types.RequestStatusPending
+		request.CreatedAt = created
+		require.NoError(t, manager.StoreRequest(request))
+		require.NoError(t, registry.Send(request))
+	}
+
+	now = created.Add(30 * time.Second)
+	assert.Equal(t, 0, nudger.Sweep())
+
+	// Every message of the request is reminded, with the time left
+	now = created.Add(61 * time.Second)
+	assert.Equal(t, 2, nudger.Sweep())
+	assert.Equal(t, 0, nudger.Sweep())
+	assert.ElementsMatch(t, []time.Duration{539 * time.Second, 29 * time.Second}, telegram.reminders)
+	assert.Equal(t, []time.Duration{539 * time.Second}, slack.reminders)
+
+	// The short request is due to time out and gets no second reminder;
+	// req-1 gets its last one
+	now = created.Add(5 * time.Minute)
+	assert.Equal(t, 1, nudger.Sweep())
+	now = created.Add(8 * time.Minute)
+	assert.Equal(t, 0, nudger.Sweep())
+
+	request, err := manager.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, request.RemindersSent)
+	assert.Len(t, slack.reminders, 2)
+}
@@ -2,9 +2,9 @@ package router
 
 import (
 	"encoding/json"
-	"io"
 	"log"
 	"loopgate/config"
+	"loopgate/internal/console"
 	"loopgate/internal/handlers"
 	"loopgate/internal/mcp"
 	"loopgate/internal/middleware"
@@ -15,13 +15,15 @@ import (
 )
 
 type Router struct {
-	mux            *mux.Router
-	mcpServer      *mcp.Server
-	hitlHandler    *handlers.HITLHandler
-	authHandlers   *handlers.AuthHandlers
-	userHandlers   *handlers.UserHandlers
-	storageAdapter storage.StorageAdapter // Keep if needed for direct use, or pass to specific middleware/handlers
-	cfg            *config.Config
+	mux             *mux.Router
+	mcpServer       *mcp.Server
+	mcpHTTP         *mcp.StreamableHTTPHandler
+	hitlHandler     *handlers.HITLHandler
+	authHandlers    *handlers.AuthHandlers
+	userHandlers    *handlers.UserHandlers
+	webhookHandlers *handlers.WebhookHandlers
+	storageAdapter  storage.StorageAdapter // Keep if needed for direct use, or pass to specific middleware/handlers
+	cfg             *config.Config
 }
 
 func NewRouter(
@@ -32,15 +34,18 @@ func NewRouter(
 ) *Router {
 	authHandlers := handlers.NewAuthHandlers(storageAdapter, cfg.JWTSecretKey)
 	userHandlers := handlers.NewUserHandlers(storageAdapter, cfg.APIKeyPrefix)
+	webhookHandlers := handlers.NewWebhookHandlers(storageAdapter)
 
 	router := &Router{
-		mux:            mux.NewRouter(),
-		mcpServer:      mcpServer,
-		hitlHandler:    hitlHandler,
-		authHandlers:   authHandlers,
-		userHandlers:   userHandlers,
-		storageAdapter: storageAdapter,
-		cfg:            cfg,
+		mux:             mux.NewRouter(),
+		mcpServer:       mcpServer,
+		mcpHTTP:         mcp.NewStreamableHTTPHandler(mcpServer),
+		hitlHandler:     hitlHandler,
+		authHandlers:    authHandlers,
+		userHandlers:    userHandlers,
+		webhookHandlers: webhookHandlers,
+		storageAdapter:  storageAdapter,
+		cfg:             cfg,
 	}
 
 	router.setupRoutes()
@@ -70,22 +75,42 @@ func (r *Router) setupRoutes() {
 	userRouter.HandleFunc("/apikeys", r.userHandlers.ListAPIKeysHandler).Methods("GET")
 	userRouter.HandleFunc("/apikeys/{key_id}", r.userHandlers.RevokeAPIKeyHandler).Methods("DELETE")
 
-	// Existing MCP and HITL routes
-	// QUESTION for user: Should these be protected by APIKeyAuthMiddleware?
-	// For now, leaving them as they were (public or protected by their own internal logic if any).
-	// If they need protection:
-	// mcpHitlProtectedRouter := r.mux.PathPrefix("").Subrouter() // Or specific prefix
-	// mcpHitlProtectedRouter.Use(middleware.APIKeyAuthMiddleware(r.storageAdapter))
-	// mcpHitlProtectedRouter.HandleFunc("/mcp", r.handleMCP).Methods("POST")
-	// ... and so on for other routes
+	// Web approval console: static UI plus a JSON API scoped to the
+	// logged-in user (protected by JWT)
+	if r.hitlHandler != nil {
+		consoleRouter := apiRouter.PathPrefix("/console").Subrouter()
+		consoleRouter.Use(middleware.JWTAuthMiddleware(r.cfg.JWTSecretKey))
+		r.hitlHandler.RegisterConsoleRoutes(consoleRouter)
 
-	r.mux.HandleFunc("/mcp", r.handleMCP).Methods("POST") // Example: Unprotected
-	r.mux.HandleFunc("/mcp/tools", r.handleMCPTools).Methods("GET")
-	r.mux.HandleFunc("/mcp/capabilities", r.handleMCPCapabilities).Methods("GET")
+		r.mux.Handle("/console", http.RedirectHandler(console.Path, http.StatusMovedPermanently)).Methods("GET")
+		r.mux.PathPrefix(console.Path).Handler(console.Handler()).Methods("GET", "HEAD")
+	}
+
+	// Webhook outbox inspection and re-drive (protected by API key)
+	webhookRouter := apiRouter.PathPrefix("/webhooks").Subrouter()
+	webhookRouter.Use(middleware.APIKeyAuthMiddleware(r.storageAdapter))
+	webhookRouter.HandleFunc("/outbox", r.webhookHandlers.ListOutboxHandler).Methods("GET")
+	webhookRouter.HandleFunc("/outbox/{entry_id}/redrive", r.webhookHandlers.RedriveOutboxEntryHandler).Methods("POST")
+
+	// MCP and HITL routes require an API key. Sessions and requests are
+	// scoped to the key's owner, so one customer cannot see another's.
+	hitlRouter := r.mux.NewRoute().Subrouter()
+	hitlRouter.Use(middleware.APIKeyAuthMiddleware(r.storageAdapter))
+	hitlRouter.Handle("/mcp", r.mcpHTTP).Methods("GET", "POST", "DELETE") // Streamable HTTP transport
 	if r.hitlHandler != nil { // hitlHandler might be nil if not configured/needed
-		r.hitlHandler.RegisterRoutes(r.mux) // Assuming RegisterRoutes adds its own paths
+		r.hitlHandler.RegisterRoutes(hitlRouter)
+	}
+
+	// Notification channel callbacks, such as Slack interactions, are
+	// verified by the notifier that owns them.
+	if r.hitlHandler != nil {
+		r.hitlHandler.RegisterChannelRoutes(r.mux)
 	}
 
+	// Static tool and capability listings carry no customer data.
+	r.mux.HandleFunc("/mcp/tools", r.handleMCPTools).Methods("GET")
+	r.mux.HandleFunc("/mcp/capabilities", r.handleMCPCapabilities).Methods("GET")
+
 	// Example of a new route protected by API Key Authentication
 	// saasProtectedRouter := apiRouter.PathPrefix("/saas").Subrouter()
 	// saasProtectedRouter.Use(middleware.APIKeyAuthMiddleware(r.storageAdapter))
@@ -103,7 +128,6 @@ func (r *Router) setupRoutes() {
 // 	 w.Write([]byte("SaaS Data for user: " + userID.String()))
 // }
 
-
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	r.mux.ServeHTTP(w, req)
 }
@@ -119,23 +143,6 @@ func (r *Router) healthCheck(w http.ResponseWriter, req *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func (r *Router) handleMCP(w http.ResponseWriter, req *http.Request) {
-	body, err := io.ReadAll(req.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
-
-	response, err := r.mcpServer.HandleHTTPRequest(body)
-	if err != nil {
-		http.Error(w, "Failed to process MCP request", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(response)
-}
-
 func (r *Router) handleMCPTools(w http.ResponseWriter, req *http.Request) {
 	response, err := r.mcpServer.CreateToolsListResponse()
 	if err != nil {
@@ -171,7 +178,8 @@ func (r *Router) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Accept, "+mcp.SessionIDHeader)
+		w.Header().Set("Access-Control-Expose-Headers", mcp.SessionIDHeader)
 
 		if req.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -180,4 +188,4 @@ func (r *Router) corsMiddleware(next http.Handler) http.Handler {
 
 		next.ServeHTTP(w, req)
 	})
-}
\ No newline at end of file
+}
@@ -0,0 +1,227 @@
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"loopgate/config"
+	"loopgate/internal/auth"
+	"loopgate/internal/handlers"
+	"loopgate/internal/mcp"
+	"loopgate/internal/session"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createAPIKey stores an active API key for rawKey, owned by a new user, and
+// returns the user ID.
+func createAPIKey(t *testing.T, adapter storage.StorageAdapter, rawKey string) uuid.UUID {
+	t.Helper()
+	userID := uuid.New()
+	hash := sha256.Sum256([]byte(rawKey))
+	require.NoError(t, adapter.CreateAPIKey(&types.APIKey{
+		ID:        uuid.New(),
+		KeyHash:   hex.EncodeToString(hash[:]),
+		UserID:    userID,
+		Prefix:    "lk_pub_",
+		CreatedAt: time.Now(),
+		IsActive:  true,
+	}))
+	return userID
+}
+
+func do(t *testing.T, method, url, apiKey, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestRouter_HITLRoutesAreScopedToAPIKeyOwner(t *testing.T) {
+	adapter := storage.NewInMemoryStorageAdapter()
+	manager := session.NewManager(adapter)
+	r := NewRouter(mcp.NewServer(manager, nil), handlers.NewHITLHandler(manager, nil), adapter, &config.Config{JWTSecretKey: "secret"})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	alice := createAPIKey(t, adapter, "lk_pub_alice")
+	createAPIKey(t, adapter, "lk_pub_bob")
+
+	require.NoError(t, manager.CreateSession(&types.Session{ID: "alice-session", ClientID: "alice-agent", TelegramID: 1, UserID: alice.String()}))
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{
+		ID: "alice-req", SessionID: "alice-session", Status: types.RequestStatusPending, CreatedAt: time.Now(), UserID: alice.String(),
+	}))
+
+	for _, path := range []string{"/hitl/pending", "/hitl/poll?request_id=alice-req", "/mcp"} {
+		resp := do(t, http.MethodGet, server.URL+path, "", "")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, path)
+	}
+
+	resp := do(t, http.MethodGet, server.URL+"/mcp/tools", "", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "tool listing stays public")
+
+	// Alice sees her request
+	resp = do(t, http.MethodGet, server.URL+"/hitl/pending", "lk_pub_alice", "")
+	var pending struct {
+		Count int `json:"count"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&pending))
+	resp.Body.Close()
+	assert.Equal(t, 1, pending.Count)
+
+	resp = do(t, http.MethodGet, server.URL+"/hitl/poll?request_id=alice-req", "lk_pub_alice", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Bob can neither see nor cancel it
+	resp = do(t, http.MethodGet, server.URL+"/hitl/pending", "lk_pub_bob", "")
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&pending))
+	resp.Body.Close()
+	assert.Equal(t, 0, pending.Count)
+
+	resp = do(t, http.MethodGet, server.URL+"/hitl/poll?request_id=alice-req", "lk_pub_bob", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = do(t, http.MethodPost, server.URL+"/hitl/cancel", "lk_pub_bob", `{"request_id":"alice-req"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = do(t, http.MethodGet, server.URL+"/hitl/status?session_id=alice-session", "lk_pub_bob", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	request, err := manager.GetRequest("alice-req")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+
+	// MCP sessions are bound to the user that initialized them
+	resp = do(t, http.MethodPost, server.URL+"/mcp", "lk_pub_alice", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+	resp.Body.Close()
+	mcpSession := resp.Header.Get(mcp.SessionIDHeader)
+	require.NotEmpty(t, mcpSession)
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":2,"method":"ping"}`))
+	require.NoError(t, err)
+	req.Header.Set("X-API-Key", "lk_pub_bob")
+	req.Header.Set(mcp.SessionIDHeader, mcpSession)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func doJWT(t *testing.T, method, url, token, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestRouter_ConsoleIsScopedToLoggedInUser(t *testing.T) {
+	adapter := storage.NewInMemoryStorageAdapter()
+	manager := session.NewManager(adapter)
+	r := NewRouter(mcp.NewServer(manager, nil), handlers.NewHITLHandler(manager, nil), adapter, &config.Config{JWTSecretKey: "secret"})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	alice, bob := uuid.New(), uuid.New()
+	aliceToken, err := auth.GenerateJWT(alice, "alice", "secret")
+	require.NoError(t, err)
+	bobToken, err := auth.GenerateJWT(bob, "bob", "secret")
+	require.NoError(t, err)
+
+	require.NoError(t, manager.CreateSession(&types.Session{ID: "alice-session", ClientID: "alice-agent", TelegramID: 1, UserID: alice.String()}))
+	for i, id := range []string{"old-req", "new-req"} {
+		require.NoError(t, manager.StoreRequest(&types.HITLRequest{
+			ID: id, SessionID: "alice-session", Message: "Deploy?", Options: []string{"Approve", "Reject"},
+			Status: types.RequestStatusPending, CreatedAt: time.Now().Add(time.Duration(i) * time.Second), UserID: alice.String(),
+		}))
+	}
+
+	// The UI itself is public; its API is not
+	resp := do(t, http.MethodGet, server.URL+"/console/", "", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+
+	resp = do(t, http.MethodGet, server.URL+"/api/console/requests", "", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	var list struct {
+		Requests []types.HITLRequest `json:"requests"`
+		Count    int                 `json:"count"`
+	}
+	resp = doJWT(t, http.MethodGet, server.URL+"/api/console/requests?status=pending", aliceToken, "")
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	resp.Body.Close()
+	assert.Equal(t, 2, list.Count)
+
+	resp = doJWT(t, http.MethodGet, server.URL+"/api/console/requests", bobToken, "")
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	resp.Body.Close()
+	assert.Equal(t, 0, list.Count)
+
+	// Bob cannot read, answer or cancel Alice's requests
+	for _, call := range []struct{ method, path, body string }{
+		{http.MethodGet, "/api/console/requests/new-req", ""},
+		{http.MethodPost, "/api/console/requests/new-req/respond", `{"response":"Approve"}`},
+		{http.MethodPost, "/api/console/requests/new-req/cancel", ""},
+	} {
+		resp = doJWT(t, call.method, server.URL+call.path, bobToken, call.body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, call.path)
+	}
+
+	// Alice must pick one of the options
+	resp = doJWT(t, http.MethodPost, server.URL+"/api/console/requests/new-req/respond", aliceToken, `{"response":"Maybe"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = doJWT(t, http.MethodPost, server.URL+"/api/console/requests/new-req/respond", aliceToken, `{"response":"Reject"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	request, err := manager.GetRequest("new-req")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.Equal(t, "Reject", request.Response)
+	assert.False(t, request.Approved)
+	assert.Equal(t, &types.Responder{Channel: handlers.ConsoleChannel, UserID: alice.String(), Name: "alice"}, request.Responder)
+
+	resp = doJWT(t, http.MethodPost, server.URL+"/api/console/requests/new-req/respond", aliceToken, `{"response":"Approve"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp = doJWT(t, http.MethodPost, server.URL+"/api/console/requests/old-req/cancel", aliceToken, "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// History lists both, newest first
+	resp = doJWT(t, http.MethodGet, server.URL+"/api/console/requests", aliceToken, "")
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	resp.Body.Close()
+	require.Equal(t, 2, list.Count)
+	assert.Equal(t, "new-req", list.Requests[0].ID)
+	assert.Equal(t, types.RequestStatusCanceled, list.Requests[1].Status)
+}
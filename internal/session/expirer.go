@@ -0,0 +1,90 @@
+package session
+
+import (
+	"errors"
+	"log"
+	"loopgate/internal/storage"
+	"sync"
+	"time"
+)
+
+// Expirer periodically scans pending requests and moves the ones whose
+// Timeout has elapsed to RequestStatusTimeout. Because every sweep reads the
+// pending set from storage, requests left over from before a restart are
+// picked up by the first sweep. Resolution listeners registered with
+// Manager.OnResolved see every request it times out.
+type Expirer struct {
+	manager  *Manager
+	interval time.Duration
+	now      func() time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewExpirer creates an Expirer that sweeps every interval.
+func NewExpirer(manager *Manager, interval time.Duration) *Expirer {
+	return &Expirer{
+		manager:  manager,
+		interval: interval,
+		now:      time.Now,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs an initial sweep and then one per interval until Stop is called.
+// It blocks, so callers usually run it in its own goroutine.
+func (e *Expirer) Start() {
+	log.Printf("Starting request expirer (interval %s)...", e.interval)
+
+	e.Sweep()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.Sweep()
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// Stop ends the sweep loop started by Start.
+func (e *Expirer) Stop() {
+	e.stopOnce.Do(func() { close(e.stop) })
+}
+
+// Sweep times out every overdue pending request and returns how many it
+// transitioned. Requests with a non-positive Timeout never expire.
+func (e *Expirer) Sweep() int {
+	pending, err := e.manager.GetPendingRequests()
+	if err != nil {
+		log.Printf("Expirer: error getting pending requests: %v", err)
+		return 0
+	}
+
+	now := e.now()
+	expired := 0
+	for _, request := range pending {
+		if request.Timeout <= 0 {
+			continue
+		}
+		deadline := request.CreatedAt.Add(time.Duration(request.Timeout) * time.Second)
+		if now.Before(deadline) {
+			continue
+		}
+
+		if err := e.manager.ExpireRequest(request.ID); err != nil {
+			// Answered or canceled between the scan and the update.
+			if !errors.Is(err, storage.ErrRequestNotPending) {
+				log.Printf("Expirer: error timing out request %s: %v", request.ID, err)
+			}
+			continue
+		}
+		expired++
+		log.Printf("Request %s timed out after %ds", request.ID, request.Timeout)
+	}
+	return expired
+}
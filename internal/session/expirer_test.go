@@ -0,0 +1,50 @@
+package session
+
+import (
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpirer_Sweep(t *testing.T) {
+	manager := NewManager(storage.NewInMemoryStorageAdapter())
+	var expired []string
+	manager.OnResolved(func(request *types.HITLRequest) {
+		assert.Equal(t, types.RequestStatusTimeout, request.Status)
+		expired = append(expired, request.ID)
+	})
+	expirer := NewExpirer(manager, time.Minute)
+
+	now := time.Now()
+	expirer.now = func() time.Time { return now }
+
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{
+		ID: "overdue", Status: types.RequestStatusPending, Timeout: 60, CreatedAt: now.Add(-2 * time.Minute),
+	}))
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{
+		ID: "fresh", Status: types.RequestStatusPending, Timeout: 60, CreatedAt: now.Add(-30 * time.Second),
+	}))
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{
+		ID: "no-timeout", Status: types.RequestStatusPending, CreatedAt: now.Add(-time.Hour),
+	}))
+
+	assert.Equal(t, 1, expirer.Sweep())
+	assert.Equal(t, []string{"overdue"}, expired)
+
+	overdue, err := manager.GetRequest("overdue")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusTimeout, overdue.Status)
+
+	fresh, err := manager.GetRequest("fresh")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, fresh.Status)
+
+	// Once the clock passes its deadline the fresh request expires too
+	now = now.Add(time.Minute)
+	assert.Equal(t, 1, expirer.Sweep())
+	assert.Equal(t, []string{"overdue", "fresh"}, expired)
+}
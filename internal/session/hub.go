@@ -0,0 +1,92 @@
+package session
+
+import (
+	"loopgate/internal/types"
+	"sync"
+	"time"
+)
+
+// EventType describes a request lifecycle transition published on the Hub.
+type EventType string
+
+const (
+	EventRequestCreated   EventType = "created"
+	EventRequestSent      EventType = "sent"
+	EventRequestVoted     EventType = "voted"     // A vote that did not yet decide a quorum request
+	EventRequestEscalated EventType = "escalated" // Sent to the targets of the next escalation step
+	EventRequestAnswered  EventType = "answered"
+	EventRequestTimedOut  EventType = "timed_out"
+	EventRequestCanceled  EventType = "canceled"
+)
+
+// Event is a request lifecycle transition. Request is a snapshot of the
+// request as stored right after the transition, shared by all subscribers,
+// which must not change it.
+type Event struct {
+	Type      EventType          `json:"type"`
+	Request   *types.HITLRequest `json:"request"`
+	Timestamp time.Time          `json:"timestamp"`
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// further events to it are dropped.
+const subscriberBuffer = 32
+
+type subscription struct {
+	events chan Event
+	filter func(Event) bool
+}
+
+// Hub fans request lifecycle events out to in-process subscribers such as
+// long-polling HTTP handlers. Publishing never blocks: a subscriber whose
+// buffer is full misses the event.
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[*subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[*subscription]struct{}),
+	}
+}
+
+// Subscribe returns a channel of events accepted by filter (all events if
+// filter is nil) and a function that ends the subscription. The channel is
+// never closed; callers stop reading once they have unsubscribed.
+func (h *Hub) Subscribe(filter func(Event) bool) (<-chan Event, func()) {
+	sub := &subscription{
+		events: make(chan Event, subscriberBuffer),
+		filter: filter,
+	}
+
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+
+	return sub.events, func() {
+		h.mu.Lock()
+		delete(h.subscribers, sub)
+		h.mu.Unlock()
+	}
+}
+
+// Publish delivers event to every matching subscriber.
+func (h *Hub) Publish(event Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subscribers {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+}
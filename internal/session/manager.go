@@ -1,26 +1,76 @@
 package session
 
 import (
-	// "errors" // Removed unused import
+	"context"
+	"errors"
+	"fmt"
+	"log"
 	"loopgate/internal/storage"
 	"loopgate/internal/types"
-	// "time" // Removed unused import
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// resolutionRecheckInterval bounds how long WaitForResolution can miss a
+// transition that was not published on this process's Hub, e.g. one made by
+// another replica sharing the same database.
+const resolutionRecheckInterval = 5 * time.Second
+
+// ResolutionListener is called after a request leaves the pending state, i.e.
+// once it has been completed, canceled or timed out. It receives the request
+// as stored after the transition.
+type ResolutionListener func(request *types.HITLRequest)
+
+// Returned by the user-scoped getters when the resource exists but belongs to
+// someone else, so callers cannot tell another tenant's IDs from unknown ones.
+var (
+	errSessionNotFound = errors.New("session not found")
+	errRequestNotFound = errors.New("request not found")
+)
+
+// Returned, wrapped, by Submit when the submission itself is at fault rather
+// than the server, so transports can answer with the right status.
+var (
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrUnknownSession = errors.New("unknown session")
 )
 
 type Manager struct {
-	adapter storage.StorageAdapter
+	adapter   storage.StorageAdapter
+	hub       *Hub
+	listeners []ResolutionListener
+	mu        sync.RWMutex
 }
 
 func NewManager(adapter storage.StorageAdapter) *Manager {
 	return &Manager{
 		adapter: adapter,
+		hub:     NewHub(),
 	}
 }
 
+// Hub returns the hub on which the manager publishes request lifecycle events.
+func (m *Manager) Hub() *Hub {
+	return m.hub
+}
+
 func (m *Manager) RegisterSession(sessionID, clientID string, telegramID int64) error {
 	return m.adapter.RegisterSession(sessionID, clientID, telegramID)
 }
 
+// CreateSession registers a fully populated session, such as one owned by an
+// API key user or bound to a specific channel. It is marked active.
+func (m *Manager) CreateSession(session *types.Session) error {
+	session.Active = true
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	return m.adapter.CreateSession(session)
+}
+
 func (m *Manager) DeactivateSession(sessionID string) error {
 	return m.adapter.DeactivateSession(sessionID)
 }
@@ -29,30 +79,449 @@ func (m *Manager) GetSession(sessionID string) (*types.Session, error) {
 	return m.adapter.GetSession(sessionID)
 }
 
+// GetUserSession returns a session only if userID owns it.
+func (m *Manager) GetUserSession(userID, sessionID string) (*types.Session, error) {
+	session, err := m.adapter.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != userID {
+		return nil, errSessionNotFound
+	}
+	return session, nil
+}
+
 func (m *Manager) GetTelegramID(clientID string) (int64, error) {
 	return m.adapter.GetTelegramID(clientID)
 }
 
 func (m *Manager) StoreRequest(request *types.HITLRequest) error {
-	return m.adapter.StoreRequest(request)
+	if err := m.adapter.StoreRequest(request); err != nil {
+		return err
+	}
+	m.publish(EventRequestCreated, request)
+	return nil
+}
+
+// MarkRequestSent announces that request has been delivered to the human.
+func (m *Manager) MarkRequestSent(request *types.HITLRequest) {
+	m.publish(EventRequestSent, request)
+}
+
+// AdvanceEscalation records that a pending request has been escalated to
+// level. It reports false if another caller got there first or the request
+// was resolved, in which case the step must not be sent.
+func (m *Manager) AdvanceEscalation(requestID string, level int) (bool, error) {
+	return m.adapter.AdvanceEscalation(requestID, level)
+}
+
+// AdvanceReminders records that count reminders of a pending request have
+// been sent. It reports false if another caller got there first or the
+// request was resolved, in which case the reminder must not be sent.
+func (m *Manager) AdvanceReminders(requestID string, count int) (bool, error) {
+	return m.adapter.AdvanceReminders(requestID, count)
+}
+
+// MarkRequestEscalated announces that request has been sent to the targets
+// of its current escalation step.
+func (m *Manager) MarkRequestEscalated(request *types.HITLRequest) {
+	m.publish(EventRequestEscalated, request)
 }
 
 func (m *Manager) GetRequest(requestID string) (*types.HITLRequest, error) {
 	return m.adapter.GetRequest(requestID)
 }
 
-func (m *Manager) UpdateRequestResponse(requestID, response string, approved bool) error {
-	return m.adapter.UpdateRequestResponse(requestID, response, approved)
+// OnResolved registers a listener for requests that have been completed,
+// canceled or timed out. Listeners run synchronously, so slow work should be
+// handed off to a goroutine.
+func (m *Manager) OnResolved(listener ResolutionListener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, listener)
+}
+
+// UpdateRequestResponse completes a pending request with the answer given by
+// responder, which may be nil if unknown. It returns
+// storage.ErrRequestNotPending if another answer came first.
+//
+// On a quorum request the answer is counted as responder's vote instead, and
+// the request is only completed once the vote decides it. Votes from
+// responders who are not approvers, or who already voted, are refused with
+// storage.ErrNotApprover and storage.ErrAlreadyVoted.
+func (m *Manager) UpdateRequestResponse(requestID, response string, approved bool, responder *types.Responder) error {
+	request, err := m.adapter.GetRequest(requestID)
+	if err != nil {
+		return err
+	}
+	if request.Quorum != nil {
+		return m.recordVote(requestID, response, approved, responder)
+	}
+
+	if err := m.adapter.UpdateRequestResponse(requestID, response, approved, responder); err != nil {
+		return err
+	}
+	m.notifyResolved(requestID)
+	return nil
+}
+
+// Deliverer sends submitted requests to the humans they are for.
+// notifier.Registry is the implementation used by the transports.
+type Deliverer interface {
+	ValidateTarget(target types.ChannelTarget) error
+	Send(request *types.HITLRequest) error
+}
+
+// submitError keeps the message of err while matching kind with errors.Is.
+type submitError struct {
+	kind error
+	err  error
+}
+
+func (e *submitError) Error() string        { return e.err.Error() }
+func (e *submitError) Unwrap() error        { return e.err }
+func (e *submitError) Is(target error) bool { return target == e.kind }
+
+func invalidRequest(err error) error {
+	return &submitError{kind: ErrInvalidRequest, err: err}
+}
+
+// Submit validates a request from an agent, fills in its defaults, stores it
+// and delivers it through deliverer. request.UserID must already be set to
+// the submitting user, who has to own the request's session. A request that
+// cannot be delivered is canceled.
+func (m *Manager) Submit(request *types.HITLRequest, deliverer Deliverer) error {
+	if request.SessionID == "" || request.ClientID == "" || request.Message == "" {
+		return invalidRequest(errors.New("Missing required fields: client_id, session_id and message are required"))
+	}
+
+	PrepareRequest(request)
+
+	if err := ValidateTimeout(request); err != nil {
+		return invalidRequest(err)
+	}
+	if request.Timeout == 0 {
+		request.Timeout = 300
+	}
+
+	if request.RequestType == "" {
+		if len(request.Options) > 0 {
+			request.RequestType = types.RequestTypeChoice
+		} else {
+			request.RequestType = types.RequestTypeInput
+		}
+	}
+
+	for _, validate := range []func(*types.HITLRequest) error{ValidateQuorum, ValidateFormat, ValidateEscalation} {
+		if err := validate(request); err != nil {
+			return invalidRequest(err)
+		}
+	}
+	for _, step := range request.Escalation {
+		for _, target := range step.Targets {
+			if err := deliverer.ValidateTarget(target); err != nil {
+				return invalidRequest(fmt.Errorf("Escalation target: %v", err))
+			}
+		}
+	}
+
+	session, err := m.GetUserSession(request.UserID, request.SessionID)
+	if err != nil {
+		return &submitError{kind: ErrUnknownSession, err: fmt.Errorf("Session not found: %v", err)}
+	}
+	if !session.Active {
+		return invalidRequest(errors.New("Session is not active"))
+	}
+
+	if err := m.StoreRequest(request); err != nil {
+		return fmt.Errorf("Failed to store request: %v", err)
+	}
+	if err := deliverer.Send(request); err != nil {
+		// Nobody will see the request, so do not leave the agent waiting
+		// on it.
+		if cancelErr := m.CancelRequest(request.ID); cancelErr != nil {
+			log.Printf("Failed to cancel undelivered request %s: %v", request.ID, cancelErr)
+		}
+		return fmt.Errorf("Failed to deliver request: %v", err)
+	}
+	return nil
+}
+
+// PrepareRequest readies a request submitted by an agent for storage. It gets
+// a new ID and starts out pending, and every field the server owns is
+// cleared, so an agent cannot submit a request that already looks answered,
+// escalated or reminded of.
+func PrepareRequest(request *types.HITLRequest) {
+	request.ID = uuid.New().String()
+	request.Status = types.RequestStatusPending
+	request.CreatedAt = time.Now()
+	request.Response = ""
+	request.Approved = false
+	request.RespondedAt = nil
+	request.Responder = nil
+	request.TelegramMsgID = 0
+	request.ChannelMsgID = ""
+	request.Votes = nil
+	request.EscalationLevel = 0
+	request.RemindersSent = 0
+}
+
+// ValidateTimeout checks the timeout of a request about to be submitted.
+// Zero selects the default.
+func ValidateTimeout(request *types.HITLRequest) error {
+	if request.Timeout < 0 {
+		return errors.New("timeout_seconds must not be negative")
+	}
+	return nil
+}
+
+// ValidateQuorum checks the quorum of a request about to be submitted. Only
+// requests with options can have one, as votes approve or reject.
+func ValidateQuorum(request *types.HITLRequest) error {
+	quorum := request.Quorum
+	if quorum == nil {
+		return nil
+	}
+	if len(request.Options) == 0 {
+		return errors.New("A quorum requires a request with options")
+	}
+	if len(quorum.Approvers) == 0 {
+		return errors.New("A quorum requires at least one approver")
+	}
+	seen := make(map[string]bool)
+	for _, approver := range quorum.Approvers {
+		if channel, userID, ok := strings.Cut(approver, ":"); !ok || channel == "" || userID == "" {
+			return fmt.Errorf("Quorum approvers must be <channel>:<user ID>, e.g. telegram:123456789: %q", approver)
+		}
+		if seen[approver] {
+			return fmt.Errorf("Quorum approvers must be unique: %q", approver)
+		}
+		seen[approver] = true
+	}
+	if quorum.Required < 1 || quorum.Required > len(quorum.Approvers) {
+		return fmt.Errorf("Quorum required must be between 1 and %d", len(quorum.Approvers))
+	}
+	return nil
+}
+
+// ValidateFormat checks the message format of a request about to be
+// submitted.
+func ValidateFormat(request *types.HITLRequest) error {
+	switch request.Format {
+	case "", types.MessageFormatPlain, types.MessageFormatMarkdown, types.MessageFormatHTML:
+		return nil
+	}
+	return fmt.Errorf("Invalid format %q: must be plain, markdown or html", request.Format)
+}
+
+// ValidateEscalation checks the escalation steps of a request about to be
+// submitted: each needs targets and a delay longer than the step before,
+// and all of them must come before the request times out.
+func ValidateEscalation(request *types.HITLRequest) error {
+	previous := 0
+	for i, step := range request.Escalation {
+		if step.After <= previous {
+			return fmt.Errorf("Escalation step %d: after_seconds must be greater than %d", i+1, previous)
+		}
+		if request.Timeout > 0 && step.After >= request.Timeout {
+			return fmt.Errorf("Escalation step %d: after_seconds must be less than timeout_seconds (%d)", i+1, request.Timeout)
+		}
+		if len(step.Targets) == 0 {
+			return fmt.Errorf("Escalation step %d has no targets", i+1)
+		}
+		previous = step.After
+	}
+	return nil
+}
+
+func (m *Manager) recordVote(requestID, response string, approved bool, responder *types.Responder) error {
+	completed, err := m.adapter.RecordVote(requestID, response, approved, responder)
+	if err != nil {
+		return err
+	}
+	if completed {
+		m.notifyResolved(requestID)
+		return nil
+	}
+
+	request, err := m.adapter.GetRequest(requestID)
+	if err != nil {
+		log.Printf("Failed to load request %s after a vote: %v", requestID, err)
+		return nil
+	}
+	m.publish(EventRequestVoted, request)
+	return nil
 }
 
 func (m *Manager) GetPendingRequests() ([]*types.HITLRequest, error) {
 	return m.adapter.GetPendingRequests()
 }
 
+// GetUserRequest returns a request only if userID owns it.
+func (m *Manager) GetUserRequest(userID, requestID string) (*types.HITLRequest, error) {
+	request, err := m.adapter.GetRequest(requestID)
+	if err != nil {
+		return nil, err
+	}
+	if request.UserID != userID {
+		return nil, errRequestNotFound
+	}
+	return request, nil
+}
+
+// GetPendingRequestsByUser lists the pending requests owned by userID.
+func (m *Manager) GetPendingRequestsByUser(userID string) ([]*types.HITLRequest, error) {
+	return m.adapter.GetPendingRequestsByUser(userID)
+}
+
+// ListRequestsByUser returns up to limit of userID's requests, newest first.
+func (m *Manager) ListRequestsByUser(userID string, limit int) ([]*types.HITLRequest, error) {
+	return m.adapter.ListRequestsByUser(userID, limit)
+}
+
+// CancelRequest cancels a pending request. It returns
+// storage.ErrRequestNotPending if the request has already been resolved.
 func (m *Manager) CancelRequest(requestID string) error {
-	return m.adapter.CancelRequest(requestID)
+	if err := m.adapter.CancelRequest(requestID); err != nil {
+		return err
+	}
+	m.notifyResolved(requestID)
+	return nil
+}
+
+// ExpireRequest marks a pending request as timed out. It returns
+// storage.ErrRequestNotPending if the request was resolved in the meantime.
+func (m *Manager) ExpireRequest(requestID string) error {
+	if err := m.adapter.TimeoutRequest(requestID); err != nil {
+		return err
+	}
+	m.notifyResolved(requestID)
+	return nil
+}
+
+func (m *Manager) SetTelegramMsgID(requestID string, telegramMsgID int) error {
+	return m.adapter.UpdateRequestTelegramMsgID(requestID, telegramMsgID)
+}
+
+func (m *Manager) SetChannelMsgID(requestID, channelMsgID string) error {
+	return m.adapter.UpdateRequestChannelMsgID(requestID, channelMsgID)
+}
+
+// RecordChannelMessage remembers that requestID was delivered as messageID
+// in recipient's chat on channel.
+func (m *Manager) RecordChannelMessage(requestID, channel, recipient, messageID string) error {
+	return m.adapter.StoreChannelMessage(&types.ChannelMessage{
+		ID:        uuid.New().String(),
+		RequestID: requestID,
+		Channel:   channel,
+		Recipient: recipient,
+		MessageID: messageID,
+		CreatedAt: time.Now(),
+	})
+}
+
+// RecordReminderMessage remembers that requestID was reminded of as
+// messageID in recipient's chat on channel, so replies to the reminder can be
+// traced to the request.
+func (m *Manager) RecordReminderMessage(requestID, channel, recipient, messageID string) error {
+	return m.adapter.StoreChannelMessage(&types.ChannelMessage{
+		ID:        uuid.New().String(),
+		RequestID: requestID,
+		Channel:   channel,
+		Recipient: recipient,
+		MessageID: messageID,
+		CreatedAt: time.Now(),
+		Reminder:  true,
+	})
+}
+
+// GetChannelMessages lists the messages requestID was delivered as, and
+// reminded of, oldest first.
+func (m *Manager) GetChannelMessages(requestID string) ([]*types.ChannelMessage, error) {
+	return m.adapter.GetChannelMessages(requestID)
+}
+
+// FindChannelMessage looks up a delivered message by its channel, chat and
+// message ID.
+func (m *Manager) FindChannelMessage(channel, recipient, messageID string) (*types.ChannelMessage, error) {
+	return m.adapter.FindChannelMessage(channel, recipient, messageID)
 }
 
 func (m *Manager) GetActiveSessions() ([]*types.Session, error) {
 	return m.adapter.GetActiveSessions()
-}
\ No newline at end of file
+}
+
+func (m *Manager) GetWebhookDeliveries(requestID string) ([]*types.WebhookDelivery, error) {
+	return m.adapter.GetWebhookDeliveries(requestID)
+}
+
+// WaitForResolution blocks until the request is no longer pending or ctx is
+// done. It returns the request as last seen, together with ctx.Err() if it
+// gave up waiting.
+func (m *Manager) WaitForResolution(ctx context.Context, requestID string) (*types.HITLRequest, error) {
+	// Subscribe before reading so a transition between the two is not missed.
+	events, unsubscribe := m.hub.Subscribe(func(event Event) bool {
+		return event.Request.ID == requestID
+	})
+	defer unsubscribe()
+
+	request, err := m.adapter.GetRequest(requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	ticker := time.NewTicker(resolutionRecheckInterval)
+	defer ticker.Stop()
+
+	for request.Status == types.RequestStatusPending {
+		select {
+		case event := <-events:
+			request = event.Request
+		case <-ticker.C:
+			current, err := m.adapter.GetRequest(requestID)
+			if err != nil {
+				return request, err
+			}
+			request = current
+		case <-ctx.Done():
+			return request, ctx.Err()
+		}
+	}
+	return request, nil
+}
+
+// publish announces a transition of request on the hub. Subscribers get a
+// snapshot, as they read it on other goroutines while the caller and the
+// storage adapter may go on changing request.
+func (m *Manager) publish(eventType EventType, request *types.HITLRequest) {
+	m.hub.Publish(Event{Type: eventType, Request: request.Clone()})
+}
+
+// notifyResolved reloads the request, publishes the matching event on the hub
+// and passes the request to every ResolutionListener.
+func (m *Manager) notifyResolved(requestID string) {
+	request, err := m.adapter.GetRequest(requestID)
+	if err != nil {
+		log.Printf("Failed to load resolved request %s for listeners: %v", requestID, err)
+		return
+	}
+
+	var eventType EventType
+	switch request.Status {
+	case types.RequestStatusCompleted:
+		eventType = EventRequestAnswered
+	case types.RequestStatusTimeout:
+		eventType = EventRequestTimedOut
+	case types.RequestStatusCanceled:
+		eventType = EventRequestCanceled
+	}
+	m.publish(eventType, request)
+
+	m.mu.RLock()
+	listeners := m.listeners
+	m.mu.RUnlock()
+
+	for _, listener := range listeners {
+		listener(request)
+	}
+}
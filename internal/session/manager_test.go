@@ -0,0 +1,222 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager_WaitForResolution(t *testing.T) {
+	manager := NewManager(storage.NewInMemoryStorageAdapter())
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{ID: "req-1", Status: types.RequestStatusPending, CreatedAt: time.Now()}))
+
+	events, unsubscribe := manager.Hub().Subscribe(nil)
+	defer unsubscribe()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		manager.UpdateRequestResponse("req-1", "Approve", true, nil)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	request, err := manager.WaitForResolution(ctx, "req-1")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.Equal(t, "Approve", request.Response)
+
+	event := <-events
+	assert.Equal(t, EventRequestAnswered, event.Type)
+	assert.Equal(t, "req-1", event.Request.ID)
+
+	// Already resolved requests return immediately
+	request, err = manager.WaitForResolution(context.Background(), "req-1")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+}
+
+func TestManager_WaitForResolutionTimesOut(t *testing.T) {
+	manager := NewManager(storage.NewInMemoryStorageAdapter())
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{ID: "req-2", Status: types.RequestStatusPending, CreatedAt: time.Now()}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	request, err := manager.WaitForResolution(ctx, "req-2")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NotNil(t, request)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+
+	_, err = manager.WaitForResolution(context.Background(), "non-existent-request")
+	assert.Error(t, err)
+}
+
+func TestManager_QuorumVotes(t *testing.T) {
+	manager := NewManager(storage.NewInMemoryStorageAdapter())
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{
+		ID:        "req-3",
+		Status:    types.RequestStatusPending,
+		Options:   []string{"Approve", "Reject"},
+		Quorum:    &types.Quorum{Approvers: []string{"slack:U1", "slack:U2"}, Required: 2},
+		CreatedAt: time.Now(),
+	}))
+
+	var resolved []string
+	manager.OnResolved(func(request *types.HITLRequest) { resolved = append(resolved, request.ID) })
+	events, unsubscribe := manager.Hub().Subscribe(nil)
+	defer unsubscribe()
+
+	// The first vote is published but does not resolve the request
+	require.NoError(t, manager.UpdateRequestResponse("req-3", "Approve", true, &types.Responder{Channel: "slack", UserID: "U1", Name: "ada"}))
+	assert.Equal(t, EventRequestVoted, (<-events).Type)
+	assert.Empty(t, resolved)
+
+	err := manager.UpdateRequestResponse("req-3", "Approve", true, &types.Responder{Channel: "slack", UserID: "U3", Name: "mallory"})
+	assert.ErrorIs(t, err, storage.ErrNotApprover)
+	// Display names are not identities
+	err = manager.UpdateRequestResponse("req-3", "Approve", true, &types.Responder{Channel: "slack", UserID: "U3", Name: "bob"})
+	assert.ErrorIs(t, err, storage.ErrNotApprover)
+
+	require.NoError(t, manager.UpdateRequestResponse("req-3", "Approve", true, &types.Responder{Channel: "slack", UserID: "U2", Name: "bob"}))
+	assert.Equal(t, EventRequestAnswered, (<-events).Type)
+	assert.Equal(t, []string{"req-3"}, resolved)
+}
+
+func TestValidateQuorum(t *testing.T) {
+	options := []string{"Approve", "Reject"}
+	tests := []struct {
+		name    string
+		request types.HITLRequest
+		wantErr bool
+	}{
+		{"no quorum", types.HITLRequest{}, false},
+		{"two of three", types.HITLRequest{Options: options, Quorum: &types.Quorum{Approvers: []string{"slack:a", "slack:b", "slack:c"}, Required: 2}}, false},
+		{"without options", types.HITLRequest{Quorum: &types.Quorum{Approvers: []string{"slack:a"}, Required: 1}}, true},
+		{"unqualified approver", types.HITLRequest{Options: options, Quorum: &types.Quorum{Approvers: []string{"ada"}, Required: 1}}, true},
+		{"empty user ID", types.HITLRequest{Options: options, Quorum: &types.Quorum{Approvers: []string{"slack:"}, Required: 1}}, true},
+		{"no approvers", types.HITLRequest{Options: options, Quorum: &types.Quorum{Required: 1}}, true},
+		{"duplicate approver", types.HITLRequest{Options: options, Quorum: &types.Quorum{Approvers: []string{"slack:a", "slack:a"}, Required: 1}}, true},
+		{"more than approvers", types.HITLRequest{Options: options, Quorum: &types.Quorum{Approvers: []string{"slack:a", "slack:b"}, Required: 3}}, true},
+		{"zero required", types.HITLRequest{Options: options, Quorum: &types.Quorum{Approvers: []string{"slack:a"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateQuorum(&tt.request)
+			assert.Equal(t, tt.wantErr, err != nil, "ValidateQuorum() error = %v", err)
+		})
+	}
+}
+
+func TestValidateEscalation(t *testing.T) {
+	targets := []types.ChannelTarget{{TelegramID: 2}}
+	tests := []struct {
+		name       string
+		escalation []types.EscalationStep
+		wantErr    bool
+	}{
+		{"none", nil, false},
+		{"two steps", []types.EscalationStep{{After: 60, Targets: targets}, {After: 120, Targets: targets}}, false},
+		{"out of order", []types.EscalationStep{{After: 120, Targets: targets}, {After: 60, Targets: targets}}, true},
+		{"after the timeout", []types.EscalationStep{{After: 300, Targets: targets}}, true},
+		{"without targets", []types.EscalationStep{{After: 60}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEscalation(&types.HITLRequest{Timeout: 300, Escalation: tt.escalation})
+			assert.Equal(t, tt.wantErr, err != nil, "ValidateEscalation() error = %v", err)
+		})
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	for format, wantErr := range map[types.MessageFormat]bool{
+		"":         false,
+		"plain":    false,
+		"markdown": false,
+		"html":     false,
+		"Markdown": true,
+		"rst":      true,
+	} {
+		err := ValidateFormat(&types.HITLRequest{Format: format})
+		assert.Equal(t, wantErr, err != nil, "ValidateFormat(%q) error = %v", format, err)
+	}
+}
+
+type fakeDeliverer struct {
+	sent    []*types.HITLRequest
+	sendErr error
+}
+
+func (f *fakeDeliverer) ValidateTarget(target types.ChannelTarget) error {
+	if target.Channel == "pager" {
+		return errors.New("no notifier registered for channel pager")
+	}
+	return nil
+}
+
+func (f *fakeDeliverer) Send(request *types.HITLRequest) error {
+	f.sent = append(f.sent, request)
+	return f.sendErr
+}
+
+func TestManager_Submit(t *testing.T) {
+	manager := NewManager(storage.NewInMemoryStorageAdapter())
+	require.NoError(t, manager.CreateSession(&types.Session{ID: "s1", ClientID: "agent", TelegramID: 1, UserID: "u1"}))
+	deliverer := &fakeDeliverer{}
+
+	request := &types.HITLRequest{SessionID: "s1", ClientID: "agent", Message: "Deploy?", UserID: "u1",
+		Options: []string{"Yes", "No"}, Status: types.RequestStatusCompleted}
+	require.NoError(t, manager.Submit(request, deliverer))
+	assert.NotEmpty(t, request.ID)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+	assert.Equal(t, 300, request.Timeout)
+	assert.Equal(t, types.RequestTypeChoice, request.RequestType)
+	assert.Len(t, deliverer.sent, 1)
+
+	stored, err := manager.GetRequest(request.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Deploy?", stored.Message)
+
+	for _, tt := range []struct {
+		name    string
+		request types.HITLRequest
+		wantErr error
+	}{
+		{"missing message", types.HITLRequest{SessionID: "s1", ClientID: "agent", UserID: "u1"}, ErrInvalidRequest},
+		{"negative timeout", types.HITLRequest{SessionID: "s1", ClientID: "agent", Message: "Deploy?", UserID: "u1", Timeout: -1}, ErrInvalidRequest},
+		{"unknown escalation channel", types.HITLRequest{SessionID: "s1", ClientID: "agent", Message: "Deploy?", UserID: "u1",
+			Escalation: []types.EscalationStep{{After: 60, Targets: []types.ChannelTarget{{Channel: "pager", Recipient: "ops"}}}}}, ErrInvalidRequest},
+		{"another user's session", types.HITLRequest{SessionID: "s1", ClientID: "agent", Message: "Deploy?", UserID: "u2"}, ErrUnknownSession},
+		{"unknown session", types.HITLRequest{SessionID: "nope", ClientID: "agent", Message: "Deploy?", UserID: "u1"}, ErrUnknownSession},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := manager.Submit(&tt.request, deliverer)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+	assert.Len(t, deliverer.sent, 1, "refused submissions are not delivered")
+}
+
+func TestManager_SubmitCancelsUndeliveredRequest(t *testing.T) {
+	manager := NewManager(storage.NewInMemoryStorageAdapter())
+	require.NoError(t, manager.CreateSession(&types.Session{ID: "s1", ClientID: "agent", TelegramID: 1}))
+	deliverer := &fakeDeliverer{sendErr: errors.New("telegram is down")}
+
+	request := &types.HITLRequest{SessionID: "s1", ClientID: "agent", Message: "Deploy?"}
+	err := manager.Submit(request, deliverer)
+	assert.ErrorContains(t, err, "telegram is down")
+	assert.NotErrorIs(t, err, ErrInvalidRequest)
+
+	stored, err := manager.GetRequest(request.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCanceled, stored.Status)
+
+	pending, err := manager.GetPendingRequests()
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
@@ -0,0 +1,268 @@
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"loopgate/internal/notifier"
+	"loopgate/internal/session"
+	"loopgate/internal/types"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ChannelName is the session channel served by Bot.
+const ChannelName = "slack"
+
+// DefaultAPIURL is the base URL of the Slack Web API.
+const DefaultAPIURL = "https://slack.com/api/"
+
+// Block Kit identifiers that route interactions back to requests.
+const (
+	respondActionID    = "respond"
+	optionActionPrefix = "option_"
+	inputCallbackID    = "hitl_input"
+	inputBlockID       = "response"
+	inputActionID      = "value"
+)
+
+// Slack limits: elements per actions block and characters per button label.
+const (
+	maxActionsPerBlock = 25
+	maxButtonText      = 75
+)
+
+// Bot delivers HITL requests as Slack messages with Block Kit buttons and
+// records answers from Slack interaction callbacks. Options become buttons;
+// input requests get a Respond button that opens a modal. It implements
+// notifier.Notifier and notifier.WebhookReceiver.
+type Bot struct {
+	token          string
+	signingSecret  string
+	apiURL         string
+	client         *http.Client
+	sessionManager *session.Manager
+}
+
+// NewBot creates a Slack notifier that posts with the bot token and verifies
+// interactions with the app's signing secret. apiURL defaults to
+// DefaultAPIURL.
+func NewBot(token, signingSecret, apiURL string, sessionManager *session.Manager) *Bot {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &Bot{
+		token:          token,
+		signingSecret:  signingSecret,
+		apiURL:         strings.TrimRight(apiURL, "/") + "/",
+		client:         &http.Client{Timeout: 10 * time.Second},
+		sessionManager: sessionManager,
+	}
+}
+
+// Channel implements notifier.Notifier.
+func (b *Bot) Channel() string {
+	return ChannelName
+}
+
+// Start implements notifier.Notifier. Answers arrive as interaction
+// callbacks, so there is nothing to receive.
+func (b *Bot) Start() {
+	log.Println("Slack notifier ready; interactions are received at /slack/interactions")
+}
+
+// Stop implements notifier.Notifier.
+func (b *Bot) Stop() {}
+
+// SendRequest posts request to the session's Slack channel or user.
+func (b *Bot) SendRequest(request *types.HITLRequest, sess *types.Session) error {
+	if sess.Recipient == "" {
+		return fmt.Errorf("session %s has no slack recipient", sess.ID)
+	}
+
+	result, err := b.call("chat.postMessage", map[string]interface{}{
+		"channel": sess.Recipient,
+		"text":    "HITL Request: " + request.Message,
+		"blocks":  requestBlocks(request),
+	})
+	if err != nil {
+		return err
+	}
+
+	request.ChannelMsgID = messageRef(result.Channel, result.TS)
+	if err := b.sessionManager.SetChannelMsgID(request.ID, request.ChannelMsgID); err != nil {
+		log.Printf("Failed to store slack message for request %s: %v", request.ID, err)
+	}
+	return nil
+}
+
+// NotifyResolved replaces the request message with its outcome, which also
+// removes the buttons.
+func (b *Bot) NotifyResolved(request *types.HITLRequest, sess *types.Session) error {
+	channel, ts, ok := parseMessageRef(request.ChannelMsgID)
+	if !ok {
+		return nil
+	}
+
+	var text string
+	switch request.Status {
+	case types.RequestStatusCompleted:
+		text = fmt.Sprintf(":white_check_mark: *Response Recorded*\n\n%s\n\nResponse: %s",
+			escape(request.Message), escape(request.Response))
+		if answeredBy := notifier.AnsweredBy(request); answeredBy != "" {
+			text += "\nAnswered by: " + escape(answeredBy)
+		}
+	case types.RequestStatusTimeout:
+		text = fmt.Sprintf(":hourglass: *Request Expired*\n\n%s\n\nNo response within %d seconds.",
+			escape(request.Message), request.Timeout)
+	case types.RequestStatusCanceled:
+		text = fmt.Sprintf(":no_entry_sign: *Request Canceled*\n\n%s", escape(request.Message))
+	default:
+		return nil
+	}
+
+	_, err := b.call("chat.update", map[string]interface{}{
+		"channel": channel,
+		"ts":      ts,
+		"text":    text,
+		"blocks":  []interface{}{sectionBlock(text), contextBlock(request)},
+	})
+	return err
+}
+
+func requestBlocks(request *types.HITLRequest) []interface{} {
+	blocks := []interface{}{
+		sectionBlock(":robot_face: *HITL Request*\n\n" + escape(request.Message)),
+		contextBlock(request),
+	}
+
+	if len(request.Options) == 0 {
+		respond := button("Respond", respondActionID, request.ID)
+		respond["style"] = "primary"
+		return append(blocks, actionsBlock(request.ID, 0, []interface{}{respond}))
+	}
+
+	var buttons []interface{}
+	for i, option := range request.Options {
+		optionButton := button(option, fmt.Sprintf("%s%d", optionActionPrefix, i), fmt.Sprintf("%s:%d", request.ID, i))
+		if !notifier.OptionApproves(option) {
+			optionButton["style"] = "danger"
+		}
+		buttons = append(buttons, optionButton)
+	}
+	for start := 0; start < len(buttons); start += maxActionsPerBlock {
+		end := start + maxActionsPerBlock
+		if end > len(buttons) {
+			end = len(buttons)
+		}
+		blocks = append(blocks, actionsBlock(request.ID, start/maxActionsPerBlock, buttons[start:end]))
+	}
+	return blocks
+}
+
+func sectionBlock(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "section",
+		"text": map[string]interface{}{"type": "mrkdwn", "text": text},
+	}
+}
+
+func contextBlock(request *types.HITLRequest) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "context",
+		"elements": []interface{}{map[string]interface{}{
+			"type": "mrkdwn",
+			"text": fmt.Sprintf("Request ID: `%s` · Client: %s · Session: %s",
+				request.ID, escape(request.ClientID), escape(request.SessionID)),
+		}},
+	}
+}
+
+func actionsBlock(requestID string, index int, elements []interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "actions",
+		"block_id": fmt.Sprintf("hitl_%s_%d", requestID, index),
+		"elements": elements,
+	}
+}
+
+func button(text, actionID, value string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      "button",
+		"text":      plainText(truncate(text, maxButtonText)),
+		"action_id": actionID,
+		"value":     value,
+	}
+}
+
+func plainText(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "plain_text", "text": text, "emoji": true}
+}
+
+// escape escapes the characters Slack treats as control sequences in
+// mrkdwn text.
+func escape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+func truncate(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-1]) + "…"
+}
+
+// messageRef packs the channel and timestamp that identify a Slack message
+// into a request's ChannelMsgID.
+func messageRef(channel, ts string) string {
+	return channel + ":" + ts
+}
+
+func parseMessageRef(ref string) (channel, ts string, ok bool) {
+	channel, ts, ok = strings.Cut(ref, ":")
+	return channel, ts, ok && channel != "" && ts != ""
+}
+
+type apiResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+}
+
+// call invokes a Slack Web API method with a JSON body.
+func (b *Bot) call(method string, payload interface{}) (*apiResponse, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode slack %s: %w", method, err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, b.apiURL+method, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+b.token)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("slack %s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("slack %s failed: %s", method, resp.Status)
+	}
+
+	var result apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode slack %s response: %w", method, err)
+	}
+	if !result.OK {
+		return nil, fmt.Errorf("slack %s failed: %s", method, result.Error)
+	}
+	return &result, nil
+}
@@ -0,0 +1,222 @@
+package slack
+
+import (
+	"encoding/json"
+	"loopgate/internal/notifier"
+	"loopgate/internal/session"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSigningSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+type apiCall struct {
+	Method string
+	Body   map[string]interface{}
+}
+
+// fakeSlack records Web API calls and answers them successfully.
+type fakeSlack struct {
+	mu    sync.Mutex
+	calls []apiCall
+}
+
+func (f *fakeSlack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	if r.Header.Get("Authorization") != "Bearer xoxb-test" {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid_auth"})
+		return
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, apiCall{Method: strings.TrimPrefix(r.URL.Path, "/api/"), Body: body})
+	f.mu.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "channel": "C123", "ts": "1700000000.000100"})
+}
+
+func (f *fakeSlack) callsTo(method string) []apiCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []apiCall
+	for _, call := range f.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func setupBot(t *testing.T) (*session.Manager, *notifier.Registry, *fakeSlack, *httptest.Server) {
+	t.Helper()
+	slackAPI := &fakeSlack{}
+	apiServer := httptest.NewServer(slackAPI)
+	t.Cleanup(apiServer.Close)
+
+	manager := session.NewManager(storage.NewInMemoryStorageAdapter())
+	registry := notifier.NewRegistry(manager)
+	registry.Register(NewBot("xoxb-test", testSigningSecret, apiServer.URL+"/api", manager))
+	manager.OnResolved(registry.NotifyResolved)
+
+	router := mux.NewRouter()
+	registry.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	require.NoError(t, manager.CreateSession(&types.Session{ID: "s1", ClientID: "agent", Channel: ChannelName, Recipient: "C123"}))
+	return manager, registry, slackAPI, server
+}
+
+func submit(t *testing.T, manager *session.Manager, registry *notifier.Registry, request *types.HITLRequest) {
+	t.Helper()
+	request.SessionID = "s1"
+	request.ClientID = "agent"
+	request.Status = types.RequestStatusPending
+	request.CreatedAt = time.Now()
+	require.NoError(t, manager.StoreRequest(request))
+	require.NoError(t, registry.Send(request))
+}
+
+// postInteraction sends payload the way Slack does, signed with secret.
+func postInteraction(t *testing.T, serverURL, secret string, timestamp time.Time, payload string) *http.Response {
+	t.Helper()
+	body := url.Values{"payload": {payload}}.Encode()
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, serverURL+"/slack/interactions", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", ts)
+	req.Header.Set("X-Slack-Signature", sign(secret, ts, []byte(body)))
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestBot_OptionButtons(t *testing.T) {
+	manager, registry, slackAPI, server := setupBot(t)
+	submit(t, manager, registry, &types.HITLRequest{ID: "req-1", Message: "Deploy <prod>?", Options: []string{"Approve", "Reject"}})
+
+	posts := slackAPI.callsTo("chat.postMessage")
+	require.Len(t, posts, 1)
+	assert.Equal(t, "C123", posts[0].Body["channel"])
+	blocks := posts[0].Body["blocks"].([]interface{})
+	section := blocks[0].(map[string]interface{})["text"].(map[string]interface{})
+	assert.Contains(t, section["text"], "Deploy &lt;prod&gt;?", "message text is escaped for mrkdwn")
+	encoded, _ := json.Marshal(blocks)
+	assert.Contains(t, string(encoded), `"value":"req-1:1"`)
+	assert.Contains(t, string(encoded), `"style":"danger"`)
+
+	request, err := manager.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, "C123:1700000000.000100", request.ChannelMsgID)
+
+	resp := postInteraction(t, server.URL, testSigningSecret, time.Now(),
+		`{"type":"block_actions","user":{"id":"U1"},"channel":{"id":"C123"},"actions":[{"action_id":"option_1","value":"req-1:1"}]}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	request, err = manager.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.Equal(t, "Reject", request.Response)
+	assert.False(t, request.Approved)
+
+	updates := slackAPI.callsTo("chat.update")
+	require.Len(t, updates, 1)
+	assert.Equal(t, "1700000000.000100", updates[0].Body["ts"])
+	assert.Contains(t, updates[0].Body["text"], "Response: Reject")
+
+	// A second click only tells the user the request is closed
+	resp = postInteraction(t, server.URL, testSigningSecret, time.Now(),
+		`{"type":"block_actions","user":{"id":"U2"},"channel":{"id":"C123"},"actions":[{"action_id":"option_0","value":"req-1:0"}]}`)
+	resp.Body.Close()
+	ephemeral := slackAPI.callsTo("chat.postEphemeral")
+	require.Len(t, ephemeral, 1)
+	assert.Equal(t, "U2", ephemeral[0].Body["user"])
+	assert.Equal(t, notPendingMessage, ephemeral[0].Body["text"])
+}
+
+func TestBot_InputModal(t *testing.T) {
+	manager, registry, slackAPI, server := setupBot(t)
+	submit(t, manager, registry, &types.HITLRequest{ID: "req-2", Message: "Which branch?", RequestType: types.RequestTypeInput})
+
+	resp := postInteraction(t, server.URL, testSigningSecret, time.Now(),
+		`{"type":"block_actions","trigger_id":"trigger-1","user":{"id":"U1"},"channel":{"id":"C123"},"actions":[{"action_id":"respond","value":"req-2"}]}`)
+	resp.Body.Close()
+
+	views := slackAPI.callsTo("views.open")
+	require.Len(t, views, 1)
+	assert.Equal(t, "trigger-1", views[0].Body["trigger_id"])
+	view := views[0].Body["view"].(map[string]interface{})
+	assert.Equal(t, "req-2", view["private_metadata"])
+
+	submission := `{"type":"view_submission","user":{"id":"U1"},"view":{"callback_id":"hitl_input","private_metadata":"req-2",` +
+		`"state":{"values":{"response":{"value":{"type":"plain_text_input","value":"release/2.1"}}}}}}`
+	resp = postInteraction(t, server.URL, testSigningSecret, time.Now(), submission)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	request, err := manager.GetRequest("req-2")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.Equal(t, "release/2.1", request.Response)
+	assert.True(t, request.Approved)
+
+	// Submitting again keeps the modal open with an error
+	resp = postInteraction(t, server.URL, testSigningSecret, time.Now(), submission)
+	var result struct {
+		ResponseAction string            `json:"response_action"`
+		Errors         map[string]string `json:"errors"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	resp.Body.Close()
+	assert.Equal(t, "errors", result.ResponseAction)
+	assert.Equal(t, notPendingMessage, result.Errors["response"])
+}
+
+func TestBot_RejectsUnsignedInteractions(t *testing.T) {
+	manager, registry, _, server := setupBot(t)
+	submit(t, manager, registry, &types.HITLRequest{ID: "req-3", Message: "Ship it?", Options: []string{"Yes"}})
+
+	payload := `{"type":"block_actions","user":{"id":"U1"},"actions":[{"action_id":"option_0","value":"req-3:0"}]}`
+	for name, resp := range map[string]*http.Response{
+		"wrong secret": postInteraction(t, server.URL, "not-the-secret", time.Now(), payload),
+		"replayed":     postInteraction(t, server.URL, testSigningSecret, time.Now().Add(-10*time.Minute), payload),
+	} {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, name)
+	}
+
+	request, err := manager.GetRequest("req-3")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+}
+
+func TestBot_SendRequestErrors(t *testing.T) {
+	manager, _, _, _ := setupBot(t)
+	bot := NewBot("xoxb-wrong", testSigningSecret, "http://127.0.0.1:0", manager)
+
+	err := bot.SendRequest(&types.HITLRequest{ID: "req-4"}, &types.Session{ID: "s2"})
+	assert.EqualError(t, err, "session s2 has no slack recipient")
+
+	slackAPI := httptest.NewServer(&fakeSlack{})
+	defer slackAPI.Close()
+	bot = NewBot("xoxb-wrong", testSigningSecret, slackAPI.URL, manager)
+	err = bot.SendRequest(&types.HITLRequest{ID: "req-4"}, &types.Session{ID: "s1", Recipient: "C123"})
+	assert.EqualError(t, err, "slack chat.postMessage failed: invalid_auth")
+}
@@ -0,0 +1,295 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"loopgate/internal/notifier"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxSignatureAge rejects replayed interactions, as Slack recommends.
+	maxSignatureAge     = 5 * time.Minute
+	maxInteractionBytes = 1 << 20
+)
+
+const notPendingMessage = "This request is no longer pending; your response was not recorded."
+
+// interaction is the subset of a Slack interaction payload Bot handles.
+type interaction struct {
+	Type      string `json:"type"`
+	TriggerID string `json:"trigger_id"`
+	User      struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+		Name     string `json:"name"`
+	} `json:"user"`
+	Channel struct {
+		ID string `json:"id"`
+	} `json:"channel"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	View struct {
+		CallbackID      string `json:"callback_id"`
+		PrivateMetadata string `json:"private_metadata"`
+		State           struct {
+			Values map[string]map[string]struct {
+				Value string `json:"value"`
+			} `json:"values"`
+		} `json:"state"`
+	} `json:"view"`
+}
+
+// responder identifies the Slack user who interacted and the interaction.
+// Modal submissions carry no channel.
+func (i *interaction) responder() *types.Responder {
+	name := i.User.Username
+	if name == "" {
+		name = i.User.Name
+	}
+	return &types.Responder{
+		Channel:    ChannelName,
+		UserID:     i.User.ID,
+		Name:       name,
+		Recipient:  i.Channel.ID,
+		PayloadRef: "trigger_id:" + i.TriggerID,
+	}
+}
+
+// RegisterRoutes implements notifier.WebhookReceiver. Point the Slack app's
+// Interactivity Request URL at /slack/interactions.
+func (b *Bot) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/slack/interactions", b.HandleInteraction).Methods("POST")
+}
+
+// HandleInteraction records answers given with buttons and modals. Requests
+// without a valid Slack signature are rejected.
+func (b *Bot) HandleInteraction(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxInteractionBytes))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	if err := b.verifySignature(r.Header, body, time.Now()); err != nil {
+		log.Printf("Rejected slack interaction: %v", err)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "Invalid form body", http.StatusBadRequest)
+		return
+	}
+
+	var payload interaction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	switch payload.Type {
+	case "block_actions":
+		b.handleBlockActions(&payload)
+		w.WriteHeader(http.StatusOK)
+	case "view_submission":
+		b.handleViewSubmission(w, &payload)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// verifySignature checks the X-Slack-Signature header, an HMAC-SHA256 of
+// "v0:<timestamp>:<body>" keyed with the signing secret.
+func (b *Bot) verifySignature(header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid timestamp")
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+		return fmt.Errorf("timestamp is %s old", age)
+	}
+
+	expected := sign(b.signingSecret, timestamp, body)
+	if !hmac.Equal([]byte(header.Get("X-Slack-Signature")), []byte(expected)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (b *Bot) handleBlockActions(payload *interaction) {
+	for _, action := range payload.Actions {
+		switch {
+		case action.ActionID == respondActionID:
+			b.openInputModal(payload, action.Value)
+		case strings.HasPrefix(action.ActionID, optionActionPrefix):
+			b.recordOption(payload, action.Value)
+		}
+	}
+}
+
+// recordOption answers a request with the option whose button was pressed.
+// value is "<request ID>:<option index>".
+func (b *Bot) recordOption(payload *interaction, value string) {
+	separator := strings.LastIndex(value, ":")
+	if separator < 0 {
+		return
+	}
+	requestID := value[:separator]
+	optionIndex, err := strconv.Atoi(value[separator+1:])
+	if err != nil {
+		return
+	}
+
+	request, err := b.sessionManager.GetRequest(requestID)
+	if err != nil {
+		b.postEphemeral(payload, "Request not found.")
+		return
+	}
+	if optionIndex < 0 || optionIndex >= len(request.Options) {
+		b.postEphemeral(payload, "Invalid option.")
+		return
+	}
+
+	selectedOption := request.Options[optionIndex]
+	log.Printf("Slack user %s selected '%s' for request %s", payload.User.ID, selectedOption, requestID)
+
+	err = b.sessionManager.UpdateRequestResponse(requestID, selectedOption, notifier.OptionApproves(selectedOption), payload.responder())
+	if errors.Is(err, storage.ErrRequestNotPending) {
+		b.postEphemeral(payload, notPendingMessage)
+		return
+	}
+	if refusal := notifier.VoteRefusal(err); refusal != "" {
+		b.postEphemeral(payload, refusal)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating request %s: %v", requestID, err)
+		b.postEphemeral(payload, "Error recording your response.")
+	}
+	// The message itself is updated by NotifyResolved.
+}
+
+// openInputModal asks for a free-text answer to requestID.
+func (b *Bot) openInputModal(payload *interaction, requestID string) {
+	request, err := b.sessionManager.GetRequest(requestID)
+	if err != nil {
+		b.postEphemeral(payload, "Request not found.")
+		return
+	}
+	if request.Status != types.RequestStatusPending {
+		b.postEphemeral(payload, notPendingMessage)
+		return
+	}
+
+	_, err = b.call("views.open", map[string]interface{}{
+		"trigger_id": payload.TriggerID,
+		"view": map[string]interface{}{
+			"type":             "modal",
+			"callback_id":      inputCallbackID,
+			"private_metadata": request.ID,
+			"title":            plainText("HITL Request"),
+			"submit":           plainText("Submit"),
+			"close":            plainText("Cancel"),
+			"blocks": []interface{}{
+				sectionBlock(escape(truncate(request.Message, 3000))),
+				map[string]interface{}{
+					"type":     "input",
+					"block_id": inputBlockID,
+					"label":    plainText("Your response"),
+					"element": map[string]interface{}{
+						"type":      "plain_text_input",
+						"action_id": inputActionID,
+						"multiline": true,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Error opening slack modal for request %s: %v", requestID, err)
+	}
+}
+
+// handleViewSubmission records the text entered in the input modal. An
+// empty body closes the modal; errors keep it open and show the message.
+func (b *Bot) handleViewSubmission(w http.ResponseWriter, payload *interaction) {
+	if payload.View.CallbackID != inputCallbackID {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	requestID := payload.View.PrivateMetadata
+	response := strings.TrimSpace(payload.View.State.Values[inputBlockID][inputActionID].Value)
+	if response == "" {
+		writeViewError(w, "Please enter a response.")
+		return
+	}
+
+	log.Printf("Slack user %s answered request %s", payload.User.ID, requestID)
+
+	err := b.sessionManager.UpdateRequestResponse(requestID, response, true, payload.responder())
+	if errors.Is(err, storage.ErrRequestNotPending) {
+		writeViewError(w, notPendingMessage)
+		return
+	}
+	if refusal := notifier.VoteRefusal(err); refusal != "" {
+		writeViewError(w, refusal)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating request %s: %v", requestID, err)
+		writeViewError(w, "Error recording your response.")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeViewError(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"response_action": "errors",
+		"errors":          map[string]string{inputBlockID: message},
+	})
+}
+
+// postEphemeral shows text only to the user who interacted.
+func (b *Bot) postEphemeral(payload *interaction, text string) {
+	if payload.Channel.ID == "" {
+		return
+	}
+	_, err := b.call("chat.postEphemeral", map[string]interface{}{
+		"channel": payload.Channel.ID,
+		"user":    payload.User.ID,
+		"text":    text,
+	})
+	if err != nil {
+		log.Printf("Error posting slack message: %v", err)
+	}
+}
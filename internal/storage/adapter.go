@@ -1,26 +1,60 @@
 package storage
 
 import (
+	"errors"
 	"loopgate/internal/types"
+	"time"
 
 	"github.com/google/uuid"
-	// "time" // Removed unused import
 )
 
+// ErrRequestNotPending is returned when a state transition that only applies
+// to pending requests (answering, timing out) targets a request that has
+// already been resolved.
+var ErrRequestNotPending = errors.New("request is no longer pending")
+
 // StorageAdapter defines the interface for data persistence.
 type StorageAdapter interface {
 	// Session and HITL methods (existing)
 	RegisterSession(sessionID, clientID string, telegramID int64) error
+	CreateSession(session *types.Session) error // Stores a fully populated session; fails if the ID is taken
 	DeactivateSession(sessionID string) error
 	GetSession(sessionID string) (*types.Session, error)
 	GetTelegramID(clientID string) (int64, error)
 	StoreRequest(request *types.HITLRequest) error
 	GetRequest(requestID string) (*types.HITLRequest, error)
-	UpdateRequestResponse(requestID, response string, approved bool) error
+	UpdateRequestResponse(requestID, response string, approved bool, responder *types.Responder) error // responder may be nil
+	RecordVote(requestID, response string, approved bool, responder *types.Responder) (bool, error) // Reports whether the vote completed the quorum request
 	GetPendingRequests() ([]*types.HITLRequest, error)
-	CancelRequest(requestID string) error
+	GetPendingRequestsByUser(userID string) ([]*types.HITLRequest, error)
+	ListRequestsByUser(userID string, limit int) ([]*types.HITLRequest, error) // Newest first, in any status
+	CancelRequest(requestID string) error // Only transitions pending requests; returns ErrRequestNotPending otherwise
+	TimeoutRequest(requestID string) error // Only transitions pending requests; returns ErrRequestNotPending otherwise
+	UpdateRequestTelegramMsgID(requestID string, telegramMsgID int) error
+	UpdateRequestChannelMsgID(requestID, channelMsgID string) error
+	AdvanceEscalation(requestID string, level int) (bool, error) // Raises a pending request's EscalationLevel to level; false if it was not pending or already there
+	AdvanceReminders(requestID string, count int) (bool, error)  // Raises a pending request's RemindersSent to count, likewise
 	GetActiveSessions() ([]*types.Session, error)
 
+	// Channel message methods: the messages each request was delivered as
+	StoreChannelMessage(message *types.ChannelMessage) error
+	GetChannelMessages(requestID string) ([]*types.ChannelMessage, error) // Oldest first
+	FindChannelMessage(channel, recipient, messageID string) (*types.ChannelMessage, error)
+
+	// Webhook delivery log methods
+	RecordWebhookDelivery(delivery *types.WebhookDelivery) error
+	GetWebhookDeliveries(requestID string) ([]*types.WebhookDelivery, error) // Oldest attempt first
+
+	// Webhook outbox methods. UpdateRequestResponse, CancelRequest and
+	// TimeoutRequest enqueue an entry atomically when the request has a CallbackURL.
+	GetDueOutboxEntries(now time.Time, limit int) ([]*types.WebhookOutboxEntry, error)
+	ClaimOutboxEntry(entryID string, now, leaseUntil time.Time) (bool, error) // False if another caller got there first
+	GetOutboxEntry(entryID string) (*types.WebhookOutboxEntry, error)
+	ListOutboxEntries(status types.OutboxStatus) ([]*types.WebhookOutboxEntry, error) // All statuses if empty
+	ListOutboxEntriesByUser(userID string, status types.OutboxStatus) ([]*types.WebhookOutboxEntry, error)
+	UpdateOutboxEntry(entry *types.WebhookOutboxEntry) error
+	RequeueOutboxEntry(entryID string) error // Moves a dead entry back to pending with attempts reset
+
 	// User management methods
 	CreateUser(user *types.User) error
 	GetUserByUsername(username string) (*types.User, error)
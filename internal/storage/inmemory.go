@@ -3,6 +3,7 @@ package storage
 import (
 	"errors"
 	"loopgate/internal/types"
+	"sort"
 	"sync"
 	"time"
 
@@ -17,6 +18,9 @@ type InMemoryStorageAdapter struct {
 	usersByID        map[uuid.UUID]*types.User
 	apiKeys          map[string]*types.APIKey // key hash -> key
 	clientToTelegram map[string]int64
+	deliveries       map[string][]*types.WebhookDelivery // request ID -> attempts
+	outbox           map[string]*types.WebhookOutboxEntry
+	channelMessages  map[string][]*types.ChannelMessage // request ID -> messages
 	mu               sync.RWMutex
 }
 
@@ -29,28 +33,34 @@ func NewInMemoryStorageAdapter() *InMemoryStorageAdapter {
 		usersByID:        make(map[uuid.UUID]*types.User),
 		apiKeys:          make(map[string]*types.APIKey),
 		clientToTelegram: make(map[string]int64),
+		deliveries:       make(map[string][]*types.WebhookDelivery),
+		outbox:           make(map[string]*types.WebhookOutboxEntry),
+		channelMessages:  make(map[string][]*types.ChannelMessage),
 	}
 }
 
 // RegisterSession stores a new session.
 func (s *InMemoryStorageAdapter) RegisterSession(sessionID, clientID string, telegramID int64) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if _, exists := s.sessions[sessionID]; exists {
-		return errors.New("session already exists")
-	}
-
-	session := &types.Session{
+	return s.CreateSession(&types.Session{
 		ID:         sessionID,
 		ClientID:   clientID,
 		TelegramID: telegramID,
 		Active:     true,
 		CreatedAt:  time.Now(),
+	})
+}
+
+// CreateSession stores a fully populated session.
+func (s *InMemoryStorageAdapter) CreateSession(session *types.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.sessions[session.ID]; exists {
+		return errors.New("session already exists")
 	}
 
-	s.sessions[sessionID] = session
-	s.clientToTelegram[clientID] = telegramID
+	s.sessions[session.ID] = session
+	s.clientToTelegram[session.ClientID] = session.TelegramID
 	return nil
 }
 
@@ -101,7 +111,7 @@ func (s *InMemoryStorageAdapter) StoreRequest(request *types.HITLRequest) error
 	if _, exists := s.requests[request.ID]; exists {
 		return errors.New("request already exists")
 	}
-	s.requests[request.ID] = request
+	s.requests[request.ID] = request.Clone()
 	return nil
 }
 
@@ -114,11 +124,11 @@ func (s *InMemoryStorageAdapter) GetRequest(requestID string) (*types.HITLReques
 	if !exists {
 		return nil, errors.New("request not found")
 	}
-	return request, nil
+	return request.Clone(), nil
 }
 
 // UpdateRequestResponse updates the response and status of a HITL request.
-func (s *InMemoryStorageAdapter) UpdateRequestResponse(requestID, response string, approved bool) error {
+func (s *InMemoryStorageAdapter) UpdateRequestResponse(requestID, response string, approved bool, responder *types.Responder) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -126,13 +136,38 @@ func (s *InMemoryStorageAdapter) UpdateRequestResponse(requestID, response strin
 	if !exists {
 		return errors.New("request not found")
 	}
+	if request.Status != types.RequestStatusPending {
+		return ErrRequestNotPending
+	}
 
 	now := time.Now()
 	request.Response = response
 	request.Approved = approved
 	request.Status = types.RequestStatusCompleted
 	request.RespondedAt = &now
-	return nil
+	request.Responder = responder
+	return s.enqueueOutboxLocked(request)
+}
+
+// RecordVote adds a vote to a pending quorum request and reports whether it
+// completed the request.
+func (s *InMemoryStorageAdapter) RecordVote(requestID, response string, approved bool, responder *types.Responder) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, exists := s.requests[requestID]
+	if !exists {
+		return false, errors.New("request not found")
+	}
+	if request.Status != types.RequestStatusPending {
+		return false, ErrRequestNotPending
+	}
+
+	completed, err := castVote(request, response, approved, responder)
+	if err != nil || !completed {
+		return false, err
+	}
+	return true, s.enqueueOutboxLocked(request)
 }
 
 // GetPendingRequests retrieves all requests with a 'pending' status.
@@ -143,13 +178,48 @@ func (s *InMemoryStorageAdapter) GetPendingRequests() ([]*types.HITLRequest, err
 	var pending []*types.HITLRequest
 	for _, request := range s.requests {
 		if request.Status == types.RequestStatusPending {
-			pending = append(pending, request)
+			pending = append(pending, request.Clone())
+		}
+	}
+	return pending, nil
+}
+
+// GetPendingRequestsByUser retrieves the pending requests owned by userID.
+func (s *InMemoryStorageAdapter) GetPendingRequestsByUser(userID string) ([]*types.HITLRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var pending []*types.HITLRequest
+	for _, request := range s.requests {
+		if request.Status == types.RequestStatusPending && request.UserID == userID {
+			pending = append(pending, request.Clone())
 		}
 	}
 	return pending, nil
 }
 
-// CancelRequest marks a request as 'canceled'.
+// ListRequestsByUser retrieves up to limit requests owned by userID, newest
+// first.
+func (s *InMemoryStorageAdapter) ListRequestsByUser(userID string, limit int) ([]*types.HITLRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var requests []*types.HITLRequest
+	for _, request := range s.requests {
+		if request.UserID == userID {
+			requests = append(requests, request.Clone())
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.After(requests[j].CreatedAt)
+	})
+	if limit > 0 && len(requests) > limit {
+		requests = requests[:limit]
+	}
+	return requests, nil
+}
+
+// CancelRequest marks a pending request as 'canceled'.
 func (s *InMemoryStorageAdapter) CancelRequest(requestID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -158,10 +228,91 @@ func (s *InMemoryStorageAdapter) CancelRequest(requestID string) error {
 	if !exists {
 		return errors.New("request not found")
 	}
+	if request.Status != types.RequestStatusPending {
+		return ErrRequestNotPending
+	}
 	request.Status = types.RequestStatusCanceled
+	return s.enqueueOutboxLocked(request)
+}
+
+// TimeoutRequest marks a pending request as 'timeout'.
+func (s *InMemoryStorageAdapter) TimeoutRequest(requestID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, exists := s.requests[requestID]
+	if !exists {
+		return errors.New("request not found")
+	}
+	if request.Status != types.RequestStatusPending {
+		return ErrRequestNotPending
+	}
+	request.Status = types.RequestStatusTimeout
+	return s.enqueueOutboxLocked(request)
+}
+
+// UpdateRequestTelegramMsgID records the Telegram message a request was sent as.
+func (s *InMemoryStorageAdapter) UpdateRequestTelegramMsgID(requestID string, telegramMsgID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, exists := s.requests[requestID]
+	if !exists {
+		return errors.New("request not found")
+	}
+	request.TelegramMsgID = telegramMsgID
+	return nil
+}
+
+// UpdateRequestChannelMsgID records the message a request was sent as on a
+// channel other than Telegram.
+func (s *InMemoryStorageAdapter) UpdateRequestChannelMsgID(requestID, channelMsgID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, exists := s.requests[requestID]
+	if !exists {
+		return errors.New("request not found")
+	}
+	request.ChannelMsgID = channelMsgID
 	return nil
 }
 
+// AdvanceEscalation raises the EscalationLevel of a pending request to level
+// and reports whether it did. It is false if the request is no longer
+// pending or has already been escalated that far.
+func (s *InMemoryStorageAdapter) AdvanceEscalation(requestID string, level int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, exists := s.requests[requestID]
+	if !exists {
+		return false, errors.New("request not found")
+	}
+	if request.Status != types.RequestStatusPending || request.EscalationLevel >= level {
+		return false, nil
+	}
+	request.EscalationLevel = level
+	return true, nil
+}
+
+// AdvanceReminders raises the RemindersSent of a pending request to count
+// and reports whether it did.
+func (s *InMemoryStorageAdapter) AdvanceReminders(requestID string, count int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, exists := s.requests[requestID]
+	if !exists {
+		return false, errors.New("request not found")
+	}
+	if request.Status != types.RequestStatusPending || request.RemindersSent >= count {
+		return false, nil
+	}
+	request.RemindersSent = count
+	return true, nil
+}
+
 // GetActiveSessions retrieves all sessions that are currently active.
 func (s *InMemoryStorageAdapter) GetActiveSessions() ([]*types.Session, error) {
 	s.mu.RLock()
@@ -176,6 +327,189 @@ func (s *InMemoryStorageAdapter) GetActiveSessions() ([]*types.Session, error) {
 	return active, nil
 }
 
+// --- Webhook delivery log methods ---
+
+// RecordWebhookDelivery appends a delivery attempt to the request's log.
+func (s *InMemoryStorageAdapter) RecordWebhookDelivery(delivery *types.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries[delivery.RequestID] = append(s.deliveries[delivery.RequestID], delivery)
+	return nil
+}
+
+// GetWebhookDeliveries returns all delivery attempts for a request, oldest first.
+func (s *InMemoryStorageAdapter) GetWebhookDeliveries(requestID string) ([]*types.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	deliveries := make([]*types.WebhookDelivery, len(s.deliveries[requestID]))
+	copy(deliveries, s.deliveries[requestID])
+	return deliveries, nil
+}
+
+// --- Channel message methods ---
+
+// StoreChannelMessage records a message a request was delivered as.
+func (s *InMemoryStorageAdapter) StoreChannelMessage(message *types.ChannelMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channelMessages[message.RequestID] = append(s.channelMessages[message.RequestID], message)
+	return nil
+}
+
+// GetChannelMessages returns the messages a request was delivered as,
+// oldest first.
+func (s *InMemoryStorageAdapter) GetChannelMessages(requestID string) ([]*types.ChannelMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	messages := make([]*types.ChannelMessage, len(s.channelMessages[requestID]))
+	copy(messages, s.channelMessages[requestID])
+	return messages, nil
+}
+
+// FindChannelMessage returns the record of the message identified by
+// messageID in recipient's chat on channel.
+func (s *InMemoryStorageAdapter) FindChannelMessage(channel, recipient, messageID string) (*types.ChannelMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, messages := range s.channelMessages {
+		for _, message := range messages {
+			if message.Channel == channel && message.Recipient == recipient && message.MessageID == messageID {
+				return message, nil
+			}
+		}
+	}
+	return nil, errors.New("channel message not found")
+}
+
+// --- Webhook outbox methods ---
+
+// enqueueOutboxLocked adds the outbox entry for request. Callers hold s.mu.
+func (s *InMemoryStorageAdapter) enqueueOutboxLocked(request *types.HITLRequest) error {
+	entry, err := newOutboxEntry(request)
+	if err != nil || entry == nil {
+		return err
+	}
+	s.outbox[entry.ID] = entry
+	return nil
+}
+
+// GetDueOutboxEntries returns up to limit pending entries whose next attempt is due.
+func (s *InMemoryStorageAdapter) GetDueOutboxEntries(now time.Time, limit int) ([]*types.WebhookOutboxEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var due []*types.WebhookOutboxEntry
+	for _, entry := range s.outbox {
+		if entry.Status == types.OutboxStatusPending && !entry.NextAttemptAt.After(now) {
+			copied := *entry
+			due = append(due, &copied)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// ClaimOutboxEntry leases a due pending entry until leaseUntil by moving its
+// next attempt there, and reports whether it did.
+func (s *InMemoryStorageAdapter) ClaimOutboxEntry(entryID string, now, leaseUntil time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.outbox[entryID]
+	if !exists {
+		return false, ErrOutboxEntryNotFound
+	}
+	if entry.Status != types.OutboxStatusPending || entry.NextAttemptAt.After(now) {
+		return false, nil
+	}
+	entry.NextAttemptAt = leaseUntil
+	return true, nil
+}
+
+// GetOutboxEntry retrieves an outbox entry by its ID.
+func (s *InMemoryStorageAdapter) GetOutboxEntry(entryID string) (*types.WebhookOutboxEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, exists := s.outbox[entryID]
+	if !exists {
+		return nil, ErrOutboxEntryNotFound
+	}
+	copied := *entry
+	return &copied, nil
+}
+
+// ListOutboxEntries returns entries with the given status, or all entries if
+// status is empty, oldest first.
+func (s *InMemoryStorageAdapter) ListOutboxEntries(status types.OutboxStatus) ([]*types.WebhookOutboxEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []*types.WebhookOutboxEntry
+	for _, entry := range s.outbox {
+		if status == "" || entry.Status == status {
+			copied := *entry
+			entries = append(entries, &copied)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+	return entries, nil
+}
+
+// ListOutboxEntriesByUser returns userID's entries with the given status, or
+// all of userID's entries if status is empty, oldest first.
+func (s *InMemoryStorageAdapter) ListOutboxEntriesByUser(userID string, status types.OutboxStatus) ([]*types.WebhookOutboxEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []*types.WebhookOutboxEntry
+	for _, entry := range s.outbox {
+		if entry.UserID == userID && (status == "" || entry.Status == status) {
+			copied := *entry
+			entries = append(entries, &copied)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+	return entries, nil
+}
+
+// UpdateOutboxEntry saves the delivery state of an outbox entry.
+func (s *InMemoryStorageAdapter) UpdateOutboxEntry(entry *types.WebhookOutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.outbox[entry.ID]; !exists {
+		return ErrOutboxEntryNotFound
+	}
+	copied := *entry
+	copied.UpdatedAt = time.Now()
+	s.outbox[entry.ID] = &copied
+	return nil
+}
+
+// RequeueOutboxEntry moves a dead entry back to pending for immediate delivery.
+func (s *InMemoryStorageAdapter) RequeueOutboxEntry(entryID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.outbox[entryID]
+	if !exists {
+		return ErrOutboxEntryNotFound
+	}
+	if entry.Status != types.OutboxStatusDead {
+		return ErrOutboxEntryNotDead
+	}
+	now := time.Now()
+	entry.Status = types.OutboxStatusPending
+	entry.Attempts = 0
+	entry.NextAttemptAt = now
+	entry.UpdatedAt = now
+	return nil
+}
+
 // --- User management methods ---
 
 func (s *InMemoryStorageAdapter) CreateUser(user *types.User) error {
@@ -94,7 +94,7 @@ func TestInMemoryStorageAdapter_RequestManagement(t *testing.T) {
 
 	// Test UpdateRequestResponse
 	responseMessage := "This is the response"
-	err = adapter.UpdateRequestResponse(requestID, responseMessage, true)
+	err = adapter.UpdateRequestResponse(requestID, responseMessage, true, nil)
 	require.NoError(t, err)
 
 	updatedRequest, err := adapter.GetRequest(requestID)
@@ -126,6 +126,32 @@ func TestInMemoryStorageAdapter_RequestManagement(t *testing.T) {
 	assert.Equal(t, types.RequestStatusCanceled, cancelledRequest.Status)
 }
 
+func TestInMemoryStorageAdapter_RequestsAreCopies(t *testing.T) {
+	adapter := NewInMemoryStorageAdapter()
+	request := &types.HITLRequest{ID: "req-1", UserID: "u1", Status: types.RequestStatusPending,
+		Options: []string{"Yes", "No"}, CreatedAt: time.Now()}
+	require.NoError(t, adapter.StoreRequest(request))
+	request.Status = types.RequestStatusCompleted
+	request.Options[0] = "Changed"
+
+	fetched, err := adapter.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, fetched.Status, "storing keeps a copy")
+	assert.Equal(t, []string{"Yes", "No"}, fetched.Options)
+
+	// Requests handed out do not change with the stored one
+	require.NoError(t, adapter.UpdateRequestResponse("req-1", "Yes", true, nil))
+	assert.Equal(t, types.RequestStatusPending, fetched.Status)
+
+	requests, err := adapter.ListRequestsByUser("u1", 0)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	requests[0].Status = types.RequestStatusCanceled
+	fetched, err = adapter.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, fetched.Status)
+}
+
 func TestInMemoryStorageAdapter_ErrorConditions(t *testing.T) {
 	adapter := NewInMemoryStorageAdapter()
 	// Using a different error variable name to be absolutely sure about scoping.
@@ -144,7 +170,7 @@ func TestInMemoryStorageAdapter_ErrorConditions(t *testing.T) {
 	assert.Error(t, errCond)
 
 	// Test UpdateRequestResponse for non-existent request
-	errCond = adapter.UpdateRequestResponse("non-existent-request", "response", true)
+	errCond = adapter.UpdateRequestResponse("non-existent-request", "response", true, nil)
 	assert.Error(t, errCond)
 
 	// Test CancelRequest for non-existent request
@@ -169,3 +195,298 @@ func TestInMemoryStorageAdapter_ErrorConditions(t *testing.T) {
 	_, errCond = adapter.GetTelegramID("non-existent-client")
 	assert.Error(t, errCond)
 }
+
+func TestInMemoryStorageAdapter_TimeoutRequest(t *testing.T) {
+	adapter := NewInMemoryStorageAdapter()
+
+	request := &types.HITLRequest{ID: "timeout-req", SessionID: "s1", Status: types.RequestStatusPending, CreatedAt: time.Now()}
+	require.NoError(t, adapter.StoreRequest(request))
+
+	require.NoError(t, adapter.UpdateRequestTelegramMsgID("timeout-req", 42))
+	require.NoError(t, adapter.UpdateRequestChannelMsgID("timeout-req", "1700000000.000100"))
+
+	err := adapter.TimeoutRequest("timeout-req")
+	require.NoError(t, err)
+
+	timedOut, err := adapter.GetRequest("timeout-req")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusTimeout, timedOut.Status)
+	assert.Equal(t, 42, timedOut.TelegramMsgID)
+	assert.Equal(t, "1700000000.000100", timedOut.ChannelMsgID)
+
+	// A late answer must not resurrect a timed-out request
+	err = adapter.UpdateRequestResponse("timeout-req", "too late", true, nil)
+	assert.ErrorIs(t, err, ErrRequestNotPending)
+
+	// Timing out twice is reported, not silently accepted
+	err = adapter.TimeoutRequest("timeout-req")
+	assert.ErrorIs(t, err, ErrRequestNotPending)
+
+	err = adapter.TimeoutRequest("non-existent-request")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrRequestNotPending)
+}
+
+func TestInMemoryStorageAdapter_CancelRequest(t *testing.T) {
+	adapter := NewInMemoryStorageAdapter()
+
+	request := &types.HITLRequest{ID: "cancel-req", SessionID: "s1", Status: types.RequestStatusPending,
+		CallbackURL: "https://agent.example.com/hook", CreatedAt: time.Now()}
+	require.NoError(t, adapter.StoreRequest(request))
+	require.NoError(t, adapter.UpdateRequestResponse("cancel-req", "Yes", true, nil))
+
+	// A cancel that lost the race to an answer leaves the answer alone
+	err := adapter.CancelRequest("cancel-req")
+	assert.ErrorIs(t, err, ErrRequestNotPending)
+
+	answered, err := adapter.GetRequest("cancel-req")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, answered.Status)
+	assert.Equal(t, "Yes", answered.Response)
+
+	entries, err := adapter.ListOutboxEntries("")
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "only the answer's callback is enqueued")
+
+	err = adapter.CancelRequest("non-existent-request")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrRequestNotPending)
+}
+
+func TestInMemoryStorageAdapter_UserScoping(t *testing.T) {
+	adapter := NewInMemoryStorageAdapter()
+
+	require.NoError(t, adapter.CreateSession(&types.Session{ID: "owned-session", ClientID: "client-a", TelegramID: 1, Active: true, CreatedAt: time.Now(), UserID: "user-a"}))
+	session, err := adapter.GetSession("owned-session")
+	require.NoError(t, err)
+	assert.Equal(t, "user-a", session.UserID)
+
+	require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: "req-a", Status: types.RequestStatusPending, CreatedAt: time.Now(), UserID: "user-a"}))
+	require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: "req-b", Status: types.RequestStatusPending, CreatedAt: time.Now(), UserID: "user-b"}))
+
+	pending, err := adapter.GetPendingRequestsByUser("user-a")
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "req-a", pending[0].ID)
+
+	pending, err = adapter.GetPendingRequestsByUser("user-c")
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: "req-a2", Status: types.RequestStatusCompleted, CreatedAt: time.Now().Add(time.Minute), UserID: "user-a"}))
+	history, err := adapter.ListRequestsByUser("user-a", 10)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "req-a2", history[0].ID, "newest first")
+
+	history, err = adapter.ListRequestsByUser("user-a", 1)
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+}
+
+func TestInMemoryStorageAdapter_WebhookDeliveries(t *testing.T) {
+	adapter := NewInMemoryStorageAdapter()
+
+	deliveries, err := adapter.GetWebhookDeliveries("req-1")
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+
+	require.NoError(t, adapter.RecordWebhookDelivery(&types.WebhookDelivery{ID: "d1", RequestID: "req-1", Attempt: 1, StatusCode: 500, CreatedAt: time.Now()}))
+	require.NoError(t, adapter.RecordWebhookDelivery(&types.WebhookDelivery{ID: "d2", RequestID: "req-1", Attempt: 2, StatusCode: 200, Succeeded: true, CreatedAt: time.Now()}))
+	require.NoError(t, adapter.RecordWebhookDelivery(&types.WebhookDelivery{ID: "d3", RequestID: "req-2", Attempt: 1, CreatedAt: time.Now()}))
+
+	deliveries, err = adapter.GetWebhookDeliveries("req-1")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, "d1", deliveries[0].ID)
+	assert.Equal(t, "d2", deliveries[1].ID)
+	assert.True(t, deliveries[1].Succeeded)
+}
+
+func TestInMemoryStorageAdapter_ChannelMessages(t *testing.T) {
+	adapter := NewInMemoryStorageAdapter()
+
+	now := time.Now()
+	require.NoError(t, adapter.StoreChannelMessage(&types.ChannelMessage{ID: "m1", RequestID: "req-1", Channel: "telegram", Recipient: "42", MessageID: "7", CreatedAt: now}))
+	require.NoError(t, adapter.StoreChannelMessage(&types.ChannelMessage{ID: "m2", RequestID: "req-1", Channel: "slack", Recipient: "C1", MessageID: "C1:1.2", CreatedAt: now.Add(time.Second)}))
+	require.NoError(t, adapter.StoreChannelMessage(&types.ChannelMessage{ID: "m3", RequestID: "req-2", Channel: "telegram", Recipient: "43", MessageID: "7", CreatedAt: now}))
+
+	messages, err := adapter.GetChannelMessages("req-1")
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, "m1", messages[0].ID)
+	assert.Equal(t, "m2", messages[1].ID)
+
+	message, err := adapter.FindChannelMessage("telegram", "43", "7")
+	require.NoError(t, err)
+	assert.Equal(t, "req-2", message.RequestID)
+
+	_, err = adapter.FindChannelMessage("slack", "42", "7")
+	assert.Error(t, err)
+}
+
+func TestInMemoryStorageAdapter_Responder(t *testing.T) {
+	adapter := NewInMemoryStorageAdapter()
+
+	require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: "req-1", Status: types.RequestStatusPending, CreatedAt: time.Now()}))
+	responder := &types.Responder{Channel: "slack", UserID: "U1", Name: "ada", Recipient: "C1", PayloadRef: "trigger_id:13345224609.738474920.8088930838d88f008e0"}
+	require.NoError(t, adapter.UpdateRequestResponse("req-1", "Yes", true, responder))
+
+	request, err := adapter.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, responder, request.Responder)
+}
+
+func TestInMemoryStorageAdapter_Quorum(t *testing.T) {
+	adapter := NewInMemoryStorageAdapter()
+	quorum := &types.Quorum{Approvers: []string{"telegram:1", "slack:U2", "console:c"}, Required: 2}
+	for _, id := range []string{"approved", "vetoed", "unreachable"} {
+		q := *quorum
+		q.Veto = id == "vetoed"
+		require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: id, Status: types.RequestStatusPending, Quorum: &q, CreatedAt: time.Now()}))
+	}
+	ada := &types.Responder{Channel: "telegram", UserID: "1", Name: "Ada"}
+	bob := &types.Responder{Channel: "slack", UserID: "U2", Name: "bob"}
+	carol := &types.Responder{Channel: "console", UserID: "c", Name: "carol"}
+
+	// Votes count once per approver, and only from approvers
+	completed, err := adapter.RecordVote("approved", "Approve", true, ada)
+	require.NoError(t, err)
+	assert.False(t, completed)
+	_, err = adapter.RecordVote("approved", "Approve", true, ada)
+	assert.ErrorIs(t, err, ErrAlreadyVoted)
+	_, err = adapter.RecordVote("approved", "Approve", true, &types.Responder{Channel: "telegram", UserID: "U2", Name: "mallory"})
+	assert.ErrorIs(t, err, ErrNotApprover)
+	// A display name matching an approver's is not that approver
+	_, err = adapter.RecordVote("approved", "Approve", true, &types.Responder{Channel: "slack", UserID: "U9", Name: "bob"})
+	assert.ErrorIs(t, err, ErrNotApprover)
+
+	completed, err = adapter.RecordVote("approved", "Approve", true, bob)
+	require.NoError(t, err)
+	assert.True(t, completed)
+	request, err := adapter.GetRequest("approved")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.True(t, request.Approved)
+	assert.Equal(t, bob, request.Responder)
+	require.Len(t, request.Votes, 2)
+	assert.Equal(t, "telegram:1", request.Votes[0].Approver)
+	assert.Equal(t, "slack:U2", request.Votes[1].Approver)
+
+	_, err = adapter.RecordVote("approved", "Approve", true, carol)
+	assert.ErrorIs(t, err, ErrRequestNotPending)
+
+	// A veto rejects at once
+	completed, err = adapter.RecordVote("vetoed", "Reject", false, carol)
+	require.NoError(t, err)
+	assert.True(t, completed)
+	request, err = adapter.GetRequest("vetoed")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.False(t, request.Approved)
+
+	// Without a veto, rejections complete the request once the quorum is out of reach
+	completed, err = adapter.RecordVote("unreachable", "Reject", false, carol)
+	require.NoError(t, err)
+	assert.False(t, completed)
+	completed, err = adapter.RecordVote("unreachable", "Reject", false, ada)
+	require.NoError(t, err)
+	assert.True(t, completed)
+	request, err = adapter.GetRequest("unreachable")
+	require.NoError(t, err)
+	assert.False(t, request.Approved)
+	assert.Equal(t, "Reject", request.Response)
+}
+
+func TestInMemoryStorageAdapter_AdvanceEscalation(t *testing.T) {
+	adapter := NewInMemoryStorageAdapter()
+	require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: "req-1", Status: types.RequestStatusPending, CreatedAt: time.Now()}))
+
+	advanced, err := adapter.AdvanceEscalation("req-1", 1)
+	require.NoError(t, err)
+	assert.True(t, advanced)
+
+	// Each level is taken once
+	advanced, err = adapter.AdvanceEscalation("req-1", 1)
+	require.NoError(t, err)
+	assert.False(t, advanced)
+
+	request, err := adapter.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, request.EscalationLevel)
+
+	// Resolved requests are not escalated
+	require.NoError(t, adapter.CancelRequest("req-1"))
+	advanced, err = adapter.AdvanceEscalation("req-1", 2)
+	require.NoError(t, err)
+	assert.False(t, advanced)
+}
+
+func TestInMemoryStorageAdapter_AdvanceReminders(t *testing.T) {
+	adapter := NewInMemoryStorageAdapter()
+
+	require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: "req-1", Status: types.RequestStatusPending, CreatedAt: time.Now()}))
+
+	advanced, err := adapter.AdvanceReminders("req-1", 2)
+	require.NoError(t, err)
+	assert.True(t, advanced)
+	advanced, err = adapter.AdvanceReminders("req-1", 1)
+	require.NoError(t, err)
+	assert.False(t, advanced)
+
+	request, err := adapter.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, request.RemindersSent)
+}
+
+func TestInMemoryStorageAdapter_WebhookOutbox(t *testing.T) {
+	adapter := NewInMemoryStorageAdapter()
+
+	require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: "with-callback", Status: types.RequestStatusPending, CallbackURL: "http://example.test/hook", UserID: "u1", CreatedAt: time.Now()}))
+	require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: "without-callback", Status: types.RequestStatusPending, CreatedAt: time.Now()}))
+
+	// Resolving a request enqueues its webhook; requests without a callback do not
+	require.NoError(t, adapter.UpdateRequestResponse("with-callback", "Yes", true, nil))
+	require.NoError(t, adapter.CancelRequest("without-callback"))
+
+	due, err := adapter.GetDueOutboxEntries(time.Now(), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	entry := due[0]
+	assert.Equal(t, "with-callback", entry.RequestID)
+	assert.Equal(t, "http://example.test/hook", entry.URL)
+	assert.Equal(t, types.OutboxStatusPending, entry.Status)
+	assert.Contains(t, entry.Payload, `"status":"completed"`)
+
+	// A dead entry is no longer due, and can be requeued
+	entry.Attempts = 3
+	entry.Status = types.OutboxStatusDead
+	require.NoError(t, adapter.UpdateOutboxEntry(entry))
+
+	due, err = adapter.GetDueOutboxEntries(time.Now(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+
+	dead, err := adapter.ListOutboxEntries(types.OutboxStatusDead)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+
+	mine, err := adapter.ListOutboxEntriesByUser("u1", types.OutboxStatusDead)
+	require.NoError(t, err)
+	require.Len(t, mine, 1)
+	others, err := adapter.ListOutboxEntriesByUser("u2", "")
+	require.NoError(t, err)
+	assert.Empty(t, others)
+
+	require.NoError(t, adapter.RequeueOutboxEntry(entry.ID))
+	requeued, err := adapter.GetOutboxEntry(entry.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.OutboxStatusPending, requeued.Status)
+	assert.Equal(t, 0, requeued.Attempts)
+
+	assert.ErrorIs(t, adapter.RequeueOutboxEntry(entry.ID), ErrOutboxEntryNotDead)
+	assert.ErrorIs(t, adapter.RequeueOutboxEntry("non-existent-entry"), ErrOutboxEntryNotFound)
+	_, err = adapter.GetOutboxEntry("non-existent-entry")
+	assert.ErrorIs(t, err, ErrOutboxEntryNotFound)
+	assert.Error(t, adapter.RequeueOutboxEntry("non-existent-entry"))
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"loopgate/internal/types"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrOutboxEntryNotFound is returned for outbox entry IDs that do not exist.
+var ErrOutboxEntryNotFound = errors.New("outbox entry not found")
+
+// ErrOutboxEntryNotDead is returned by RequeueOutboxEntry for entries that are
+// still being retried or were already delivered.
+var ErrOutboxEntryNotDead = errors.New("outbox entry is not dead")
+
+// newOutboxEntry builds the entry announcing request's current state to its
+// CallbackURL. It returns nil if the request has no CallbackURL.
+func newOutboxEntry(request *types.HITLRequest) (*types.WebhookOutboxEntry, error) {
+	if request.CallbackURL == "" {
+		return nil, nil
+	}
+
+	now := time.Now()
+	timestamp := now
+	if request.RespondedAt != nil {
+		timestamp = *request.RespondedAt
+	}
+	payload, err := json.Marshal(types.HITLResponse{
+		RequestID: request.ID,
+		Status:    request.Status,
+		Response:  request.Response,
+		Approved:  request.Approved,
+		Timestamp: timestamp,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.WebhookOutboxEntry{
+		ID:            uuid.New().String(),
+		RequestID:     request.ID,
+		UserID:        request.UserID,
+		URL:           request.CallbackURL,
+		Payload:       string(payload),
+		Status:        types.OutboxStatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, nil
+}
+
+// enqueueOutboxTx inserts the outbox entry for request using tx, so it commits
+// or rolls back together with the status change. Shared by the GORM adapters.
+func enqueueOutboxTx(tx *gorm.DB, request *types.HITLRequest) error {
+	entry, err := newOutboxEntry(request)
+	if err != nil || entry == nil {
+		return err
+	}
+	return tx.Create(entry).Error
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // PostgreSQLStorageAdapter implements the StorageAdapter interface for PostgreSQL.
@@ -24,7 +25,7 @@ func NewPostgreSQLStorageAdapter(dsn string) (*PostgreSQLStorageAdapter, error)
 	}
 
 	// Auto-migrate schema
-	err = db.AutoMigrate(&types.Session{}, &types.HITLRequest{}, &types.User{}, &types.APIKey{})
+	err = db.AutoMigrate(&types.Session{}, &types.HITLRequest{}, &types.User{}, &types.APIKey{}, &types.WebhookDelivery{}, &types.WebhookOutboxEntry{}, &types.ChannelMessage{})
 	if err != nil {
 		// Attempt to close connection if migration fails
 		sqlDB, _ := db.DB()
@@ -37,13 +38,17 @@ func NewPostgreSQLStorageAdapter(dsn string) (*PostgreSQLStorageAdapter, error)
 
 // RegisterSession stores a new session.
 func (s *PostgreSQLStorageAdapter) RegisterSession(sessionID, clientID string, telegramID int64) error {
-	session := &types.Session{
+	return s.CreateSession(&types.Session{
 		ID:         sessionID,
 		ClientID:   clientID,
 		TelegramID: telegramID,
 		Active:     true,
 		CreatedAt:  time.Now(),
-	}
+	})
+}
+
+// CreateSession stores a fully populated session.
+func (s *PostgreSQLStorageAdapter) CreateSession(session *types.Session) error {
 	return s.db.Create(session).Error
 }
 
@@ -98,20 +103,72 @@ func (s *PostgreSQLStorageAdapter) GetRequest(requestID string) (*types.HITLRequ
 	return &request, nil
 }
 
-// UpdateRequestResponse updates the response and status of a HITL request.
-func (s *PostgreSQLStorageAdapter) UpdateRequestResponse(requestID, response string, approved bool) error {
-	request, err := s.GetRequest(requestID)
-	if err != nil {
-		return err
-	}
+// UpdateRequestResponse completes a pending HITL request with its response
+// and, in the same transaction, enqueues its callback webhook. The status
+// check is part of the UPDATE so only one of several concurrent answers, or
+// an answer and the expirer, can resolve the request.
+func (s *PostgreSQLStorageAdapter) UpdateRequestResponse(requestID, response string, approved bool, responder *types.Responder) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&types.HITLRequest{}).
+			Where("id = ? AND status = ?", requestID, types.RequestStatusPending).
+			Select("response", "approved", "status", "responded_at", "responder").
+			Updates(&types.HITLRequest{
+				Response:    response,
+				Approved:    approved,
+				Status:      types.RequestStatusCompleted,
+				RespondedAt: &now,
+				Responder:   responder,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			var count int64
+			if err := tx.Model(&types.HITLRequest{}).Where("id = ?", requestID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return errors.New("request not found")
+			}
+			return ErrRequestNotPending
+		}
+		return s.enqueueOutboxForRequest(tx, requestID)
+	})
+}
 
-	now := time.Now()
-	request.Response = response
-	request.Approved = approved
-	request.Status = types.RequestStatusCompleted
-	request.RespondedAt = &now
+// RecordVote adds a vote to a pending quorum request and reports whether it
+// completed the request. A completing vote enqueues the callback webhook in
+// the same transaction.
+func (s *PostgreSQLStorageAdapter) RecordVote(requestID, response string, approved bool, responder *types.Responder) (bool, error) {
+	completed := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the row so concurrent votes are not lost.
+		var request types.HITLRequest
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&request, "id = ?", requestID).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("request not found")
+			}
+			return err
+		}
+		if request.Status != types.RequestStatusPending {
+			return ErrRequestNotPending
+		}
 
-	return s.db.Save(request).Error
+		completed, err = castVote(&request, response, approved, responder)
+		if err != nil {
+			return err
+		}
+		if err := tx.Save(&request).Error; err != nil {
+			return err
+		}
+		if !completed {
+			return nil
+		}
+		return enqueueOutboxTx(tx, &request)
+	})
+	return completed && err == nil, err
 }
 
 // GetPendingRequests retrieves all requests with a 'pending' status.
@@ -124,9 +181,120 @@ func (s *PostgreSQLStorageAdapter) GetPendingRequests() ([]*types.HITLRequest, e
 	return pendingRequests, nil
 }
 
-// CancelRequest marks a request as 'canceled'.
+// ListRequestsByUser retrieves up to limit requests owned by userID, newest
+// first.
+func (s *PostgreSQLStorageAdapter) ListRequestsByUser(userID string, limit int) ([]*types.HITLRequest, error) {
+	var requests []*types.HITLRequest
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Limit(limit).Find(&requests).Error
+	if err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// GetPendingRequestsByUser retrieves the pending requests owned by userID.
+func (s *PostgreSQLStorageAdapter) GetPendingRequestsByUser(userID string) ([]*types.HITLRequest, error) {
+	var pendingRequests []*types.HITLRequest
+	err := s.db.Where("status = ? AND user_id = ?", types.RequestStatusPending, userID).Find(&pendingRequests).Error
+	if err != nil {
+		return nil, err
+	}
+	return pendingRequests, nil
+}
+
+// CancelRequest marks a pending request as 'canceled' and, in the same
+// transaction, enqueues its callback webhook. The status check is part of the
+// UPDATE so a concurrent answer is never overwritten.
 func (s *PostgreSQLStorageAdapter) CancelRequest(requestID string) error {
-	return s.db.Model(&types.HITLRequest{}).Where("id = ?", requestID).Update("status", types.RequestStatusCanceled).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&types.HITLRequest{}).
+			Where("id = ? AND status = ?", requestID, types.RequestStatusPending).
+			Update("status", types.RequestStatusCanceled)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			var count int64
+			if err := tx.Model(&types.HITLRequest{}).Where("id = ?", requestID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return errors.New("request not found")
+			}
+			return ErrRequestNotPending
+		}
+		return s.enqueueOutboxForRequest(tx, requestID)
+	})
+}
+
+// TimeoutRequest marks a pending request as 'timeout' and, in the same
+// transaction, enqueues its callback webhook. The status check is part of the
+// UPDATE so a concurrent answer is never overwritten.
+func (s *PostgreSQLStorageAdapter) TimeoutRequest(requestID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&types.HITLRequest{}).
+			Where("id = ? AND status = ?", requestID, types.RequestStatusPending).
+			Update("status", types.RequestStatusTimeout)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			var count int64
+			if err := tx.Model(&types.HITLRequest{}).Where("id = ?", requestID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return errors.New("request not found")
+			}
+			return ErrRequestNotPending
+		}
+		return s.enqueueOutboxForRequest(tx, requestID)
+	})
+}
+
+// UpdateRequestTelegramMsgID records the Telegram message a request was sent as.
+func (s *PostgreSQLStorageAdapter) UpdateRequestTelegramMsgID(requestID string, telegramMsgID int) error {
+	return s.db.Model(&types.HITLRequest{}).Where("id = ?", requestID).Update("telegram_msg_id", telegramMsgID).Error
+}
+
+// UpdateRequestChannelMsgID records the message a request was sent as on a
+// channel other than Telegram.
+func (s *PostgreSQLStorageAdapter) UpdateRequestChannelMsgID(requestID, channelMsgID string) error {
+	return s.db.Model(&types.HITLRequest{}).Where("id = ?", requestID).Update("channel_msg_id", channelMsgID).Error
+}
+
+// enqueueOutboxForRequest reloads requestID inside tx and enqueues its webhook.
+func (s *PostgreSQLStorageAdapter) enqueueOutboxForRequest(tx *gorm.DB, requestID string) error {
+	var request types.HITLRequest
+	if err := tx.First(&request, "id = ?", requestID).Error; err != nil {
+		return err
+	}
+	return enqueueOutboxTx(tx, &request)
+}
+
+// AdvanceEscalation raises the EscalationLevel of a pending request to level
+// and reports whether it did. The conditional update makes sure only one
+// caller takes each escalation step.
+func (s *PostgreSQLStorageAdapter) AdvanceEscalation(requestID string, level int) (bool, error) {
+	result := s.db.Model(&types.HITLRequest{}).
+		Where("id = ? AND status = ? AND escalation_level < ?", requestID, types.RequestStatusPending, level).
+		Update("escalation_level", level)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// AdvanceReminders raises the RemindersSent of a pending request to count
+// and reports whether it did, so only one caller sends each reminder.
+func (s *PostgreSQLStorageAdapter) AdvanceReminders(requestID string, count int) (bool, error) {
+	result := s.db.Model(&types.HITLRequest{}).
+		Where("id = ? AND status = ? AND reminders_sent < ?", requestID, types.RequestStatusPending, count).
+		Update("reminders_sent", count)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
 }
 
 // GetActiveSessions retrieves all sessions that are currently active.
@@ -148,6 +316,155 @@ func (s *PostgreSQLStorageAdapter) Close() error {
 	return sqlDB.Close()
 }
 
+// --- Webhook delivery log methods ---
+
+// RecordWebhookDelivery appends a delivery attempt to the request's log.
+func (s *PostgreSQLStorageAdapter) RecordWebhookDelivery(delivery *types.WebhookDelivery) error {
+	return s.db.Create(delivery).Error
+}
+
+// GetWebhookDeliveries returns all delivery attempts for a request, oldest first.
+func (s *PostgreSQLStorageAdapter) GetWebhookDeliveries(requestID string) ([]*types.WebhookDelivery, error) {
+	var deliveries []*types.WebhookDelivery
+	err := s.db.Where("request_id = ?", requestID).Order("created_at ASC, attempt ASC").Find(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// --- Channel message methods ---
+
+// StoreChannelMessage records a message a request was delivered as.
+func (s *PostgreSQLStorageAdapter) StoreChannelMessage(message *types.ChannelMessage) error {
+	return s.db.Create(message).Error
+}
+
+// GetChannelMessages returns the messages a request was delivered as,
+// oldest first.
+func (s *PostgreSQLStorageAdapter) GetChannelMessages(requestID string) ([]*types.ChannelMessage, error) {
+	var messages []*types.ChannelMessage
+	err := s.db.Where("request_id = ?", requestID).Order("created_at ASC").Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// FindChannelMessage returns the record of the message identified by
+// messageID in recipient's chat on channel.
+func (s *PostgreSQLStorageAdapter) FindChannelMessage(channel, recipient, messageID string) (*types.ChannelMessage, error) {
+	var message types.ChannelMessage
+	err := s.db.Where("channel = ? AND recipient = ? AND message_id = ?", channel, recipient, messageID).First(&message).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("channel message not found")
+		}
+		return nil, err
+	}
+	return &message, nil
+}
+
+// --- Webhook outbox methods ---
+
+// GetDueOutboxEntries returns up to limit pending entries whose next attempt is due.
+func (s *PostgreSQLStorageAdapter) GetDueOutboxEntries(now time.Time, limit int) ([]*types.WebhookOutboxEntry, error) {
+	var entries []*types.WebhookOutboxEntry
+	query := s.db.Where("status = ? AND next_attempt_at <= ?", types.OutboxStatusPending, now).Order("next_attempt_at ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ClaimOutboxEntry leases a due pending entry until leaseUntil by moving its
+// next attempt there, and reports whether it did, so only one dispatcher
+// attempts each delivery.
+func (s *PostgreSQLStorageAdapter) ClaimOutboxEntry(entryID string, now, leaseUntil time.Time) (bool, error) {
+	result := s.db.Model(&types.WebhookOutboxEntry{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", entryID, types.OutboxStatusPending, now).
+		Update("next_attempt_at", leaseUntil)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetOutboxEntry retrieves an outbox entry by its ID.
+func (s *PostgreSQLStorageAdapter) GetOutboxEntry(entryID string) (*types.WebhookOutboxEntry, error) {
+	var entry types.WebhookOutboxEntry
+	err := s.db.First(&entry, "id = ?", entryID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOutboxEntryNotFound
+		}
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// ListOutboxEntries returns entries with the given status, or all entries if
+// status is empty, oldest first.
+func (s *PostgreSQLStorageAdapter) ListOutboxEntries(status types.OutboxStatus) ([]*types.WebhookOutboxEntry, error) {
+	var entries []*types.WebhookOutboxEntry
+	query := s.db.Order("created_at ASC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ListOutboxEntriesByUser returns userID's entries with the given status, or
+// all of userID's entries if status is empty, oldest first.
+func (s *PostgreSQLStorageAdapter) ListOutboxEntriesByUser(userID string, status types.OutboxStatus) ([]*types.WebhookOutboxEntry, error) {
+	var entries []*types.WebhookOutboxEntry
+	query := s.db.Where("user_id = ?", userID).Order("created_at ASC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// UpdateOutboxEntry saves the delivery state of an outbox entry.
+func (s *PostgreSQLStorageAdapter) UpdateOutboxEntry(entry *types.WebhookOutboxEntry) error {
+	return s.db.Model(&types.WebhookOutboxEntry{}).Where("id = ?", entry.ID).Updates(map[string]interface{}{
+		"status":          entry.Status,
+		"attempts":        entry.Attempts,
+		"last_error":      entry.LastError,
+		"next_attempt_at": entry.NextAttemptAt,
+		"updated_at":      time.Now(),
+	}).Error
+}
+
+// RequeueOutboxEntry moves a dead entry back to pending for immediate delivery.
+func (s *PostgreSQLStorageAdapter) RequeueOutboxEntry(entryID string) error {
+	entry, err := s.GetOutboxEntry(entryID)
+	if err != nil {
+		return err
+	}
+	if entry.Status != types.OutboxStatusDead {
+		return ErrOutboxEntryNotDead
+	}
+	now := time.Now()
+	return s.db.Model(&types.WebhookOutboxEntry{}).
+		Where("id = ? AND status = ?", entryID, types.OutboxStatusDead).
+		Updates(map[string]interface{}{
+			"status":          types.OutboxStatusPending,
+			"attempts":        0,
+			"next_attempt_at": now,
+			"updated_at":      now,
+		}).Error
+}
+
 // --- User management methods ---
 
 // CreateUser creates a new user.
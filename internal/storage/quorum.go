@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"errors"
+	"loopgate/internal/types"
+	"strings"
+	"time"
+)
+
+// Returned by RecordVote when a vote cannot be counted.
+var (
+	ErrNotApprover  = errors.New("responder is not one of the request's approvers")
+	ErrAlreadyVoted = errors.New("approver has already voted on this request")
+)
+
+// castVote adds responder's vote to a pending quorum request and completes
+// the request once the outcome is certain: approved when enough approvers
+// have approved, rejected on a veto or when too few approvers are left to
+// reach the quorum. It reports whether the request was completed. Shared by
+// all adapters, which persist the request afterwards.
+func castVote(request *types.HITLRequest, response string, approved bool, responder *types.Responder) (bool, error) {
+	quorum := request.Quorum
+	if quorum == nil {
+		return false, errors.New("request has no quorum")
+	}
+
+	approver, ok := matchApprover(quorum.Approvers, responder)
+	if !ok {
+		return false, ErrNotApprover
+	}
+	for _, vote := range request.Votes {
+		if vote.Approver == approver {
+			return false, ErrAlreadyVoted
+		}
+	}
+
+	now := time.Now()
+	request.Votes = append(request.Votes, types.Vote{
+		Approver:  approver,
+		Response:  response,
+		Approved:  approved,
+		Responder: responder,
+		CreatedAt: now,
+	})
+
+	approvals := 0
+	for _, vote := range request.Votes {
+		if vote.Approved {
+			approvals++
+		}
+	}
+	remaining := len(quorum.Approvers) - len(request.Votes)
+
+	switch {
+	case approvals >= quorum.Required:
+	case !approved && (quorum.Veto || approvals+remaining < quorum.Required):
+	default:
+		return false, nil
+	}
+
+	request.Response = response
+	request.Approved = approved
+	request.Status = types.RequestStatusCompleted
+	request.RespondedAt = &now
+	request.Responder = responder
+	return true, nil
+}
+
+// matchApprover returns the entry of approvers that names responder. Entries
+// are "<channel>:<user ID>" and match only responder's user ID on that
+// channel; display names are chosen by users themselves, so they never
+// identify an approver.
+func matchApprover(approvers []string, responder *types.Responder) (string, bool) {
+	if responder == nil || responder.UserID == "" {
+		return "", false
+	}
+	for _, approver := range approvers {
+		channel, userID, ok := strings.Cut(approver, ":")
+		if ok && channel == responder.Channel && userID == responder.UserID {
+			return approver, true
+		}
+	}
+	return "", false
+}
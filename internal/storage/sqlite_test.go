@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"loopgate/internal/types"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -138,7 +139,7 @@ func TestSQLiteStorageAdapter_RequestManagement(t *testing.T) {
 
 	// Test UpdateRequestResponse
 	responseMessage := "This is the SQLite response"
-	err = adapter.UpdateRequestResponse(requestID, responseMessage, true)
+	err = adapter.UpdateRequestResponse(requestID, responseMessage, true, nil)
 	require.NoError(t, err)
 
 	updatedRequest, err := adapter.GetRequest(requestID)
@@ -197,12 +198,12 @@ func TestSQLiteStorageAdapter_ErrorConditions(t *testing.T) {
 
 
 	// Test UpdateRequestResponse for non-existent request
-	err = adapter.UpdateRequestResponse("non-existent-request-sqlite", "response", true)
+	err = adapter.UpdateRequestResponse("non-existent-request-sqlite", "response", true, nil)
 	assert.Error(t, err) // This should error because GetRequest inside it will fail
 
-	// Test CancelRequest for non-existent request - similar to DeactivateSession with GORM update
+	// Test CancelRequest for non-existent request - the status check reports it
 	err = adapter.CancelRequest("non-existent-request-sqlite")
-	assert.NoError(t, err, "Cancel on non-existent request should ideally not error with GORM update, or we should add a check")
+	assert.Error(t, err, "Cancel on non-existent request should report that the request was not found")
 
 	// Test RegisterSession with existing ID (Primary Key violation)
 	err = adapter.RegisterSession("existing-id-sqlite", "client1-s", 111)
@@ -250,3 +251,359 @@ func TestSQLiteStorageAdapter_Persistence(t *testing.T) {
 	require.NotNil(t, session)
 	assert.Equal(t, clientID, session.ClientID)
 }
+
+func TestSQLiteStorageAdapter_TimeoutRequest(t *testing.T) {
+	adapter, cleanup := setupSQLiteAdapter(t)
+	defer cleanup()
+
+	request := &types.HITLRequest{ID: "timeout-req-sqlite", SessionID: "s1", Status: types.RequestStatusPending, CreatedAt: time.Now()}
+	require.NoError(t, adapter.StoreRequest(request))
+
+	require.NoError(t, adapter.UpdateRequestTelegramMsgID("timeout-req-sqlite", 42))
+	require.NoError(t, adapter.UpdateRequestChannelMsgID("timeout-req-sqlite", "1700000000.000100"))
+
+	err := adapter.TimeoutRequest("timeout-req-sqlite")
+	require.NoError(t, err)
+
+	timedOut, err := adapter.GetRequest("timeout-req-sqlite")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusTimeout, timedOut.Status)
+	assert.Equal(t, 42, timedOut.TelegramMsgID)
+	assert.Equal(t, "1700000000.000100", timedOut.ChannelMsgID)
+
+	pending, err := adapter.GetPendingRequests()
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// A late answer must not resurrect a timed-out request
+	err = adapter.UpdateRequestResponse("timeout-req-sqlite", "too late", true, nil)
+	assert.ErrorIs(t, err, ErrRequestNotPending)
+
+	err = adapter.TimeoutRequest("timeout-req-sqlite")
+	assert.ErrorIs(t, err, ErrRequestNotPending)
+
+	err = adapter.TimeoutRequest("non-existent-request-sqlite")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrRequestNotPending)
+}
+
+func TestSQLiteStorageAdapter_CancelRequest(t *testing.T) {
+	adapter, cleanup := setupSQLiteAdapter(t)
+	defer cleanup()
+
+	request := &types.HITLRequest{ID: "cancel-req-sqlite", SessionID: "s1", Status: types.RequestStatusPending,
+		CallbackURL: "https://agent.example.com/hook", CreatedAt: time.Now()}
+	require.NoError(t, adapter.StoreRequest(request))
+	require.NoError(t, adapter.UpdateRequestResponse("cancel-req-sqlite", "Yes", true, nil))
+
+	// A cancel that lost the race to an answer leaves the answer alone
+	err := adapter.CancelRequest("cancel-req-sqlite")
+	assert.ErrorIs(t, err, ErrRequestNotPending)
+
+	answered, err := adapter.GetRequest("cancel-req-sqlite")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, answered.Status)
+	assert.Equal(t, "Yes", answered.Response)
+
+	entries, err := adapter.ListOutboxEntries("")
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "only the answer's callback is enqueued")
+
+	err = adapter.CancelRequest("non-existent-request-sqlite")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrRequestNotPending)
+}
+
+func TestSQLiteStorageAdapter_UserScoping(t *testing.T) {
+	adapter, cleanup := setupSQLiteAdapter(t)
+	defer cleanup()
+
+	require.NoError(t, adapter.CreateSession(&types.Session{ID: "owned-session-sqlite", ClientID: "client-a", TelegramID: 1, Active: true, CreatedAt: time.Now(), UserID: "user-a"}))
+	session, err := adapter.GetSession("owned-session-sqlite")
+	require.NoError(t, err)
+	assert.Equal(t, "user-a", session.UserID)
+
+	require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: "req-a-sqlite", Status: types.RequestStatusPending, CreatedAt: time.Now(), UserID: "user-a"}))
+	require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: "req-b-sqlite", Status: types.RequestStatusPending, CreatedAt: time.Now(), UserID: "user-b"}))
+
+	pending, err := adapter.GetPendingRequestsByUser("user-a")
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "req-a-sqlite", pending[0].ID)
+
+	pending, err = adapter.GetPendingRequestsByUser("user-c")
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: "req-a2-sqlite", Status: types.RequestStatusCompleted, CreatedAt: time.Now().Add(time.Minute), UserID: "user-a"}))
+	history, err := adapter.ListRequestsByUser("user-a", 10)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "req-a2-sqlite", history[0].ID, "newest first")
+
+	history, err = adapter.ListRequestsByUser("user-a", 1)
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+}
+
+func TestSQLiteStorageAdapter_WebhookDeliveries(t *testing.T) {
+	adapter, cleanup := setupSQLiteAdapter(t)
+	defer cleanup()
+
+	now := time.Now()
+	require.NoError(t, adapter.RecordWebhookDelivery(&types.WebhookDelivery{ID: "d1", RequestID: "req-1", URL: "http://example.test", Attempt: 1, StatusCode: 500, CreatedAt: now}))
+	require.NoError(t, adapter.RecordWebhookDelivery(&types.WebhookDelivery{ID: "d2", RequestID: "req-1", URL: "http://example.test", Attempt: 2, StatusCode: 200, Succeeded: true, CreatedAt: now.Add(time.Second)}))
+	require.NoError(t, adapter.RecordWebhookDelivery(&types.WebhookDelivery{ID: "d3", RequestID: "req-2", Attempt: 1, CreatedAt: now}))
+
+	deliveries, err := adapter.GetWebhookDeliveries("req-1")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, "d1", deliveries[0].ID)
+	assert.Equal(t, 500, deliveries[0].StatusCode)
+	assert.Equal(t, "d2", deliveries[1].ID)
+	assert.True(t, deliveries[1].Succeeded)
+}
+
+func TestSQLiteStorageAdapter_ChannelMessages(t *testing.T) {
+	adapter, cleanup := setupSQLiteAdapter(t)
+	defer cleanup()
+
+	now := time.Now()
+	require.NoError(t, adapter.StoreChannelMessage(&types.ChannelMessage{ID: "m1", RequestID: "req-1", Channel: "telegram", Recipient: "42", MessageID: "7", CreatedAt: now}))
+	require.NoError(t, adapter.StoreChannelMessage(&types.ChannelMessage{ID: "m2", RequestID: "req-1", Channel: "slack", Recipient: "C1", MessageID: "C1:1.2", CreatedAt: now.Add(time.Second)}))
+	require.NoError(t, adapter.StoreChannelMessage(&types.ChannelMessage{ID: "m3", RequestID: "req-2", Channel: "telegram", Recipient: "43", MessageID: "7", CreatedAt: now}))
+	require.NoError(t, adapter.StoreChannelMessage(&types.ChannelMessage{ID: "m4", RequestID: "req-2", Channel: "telegram", Recipient: "43", MessageID: "9", CreatedAt: now, Reminder: true}))
+
+	messages, err := adapter.GetChannelMessages("req-1")
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, "m1", messages[0].ID)
+	assert.Equal(t, "m2", messages[1].ID)
+
+	message, err := adapter.FindChannelMessage("telegram", "43", "7")
+	require.NoError(t, err)
+	assert.Equal(t, "req-2", message.RequestID)
+	assert.False(t, message.Reminder)
+
+	message, err = adapter.FindChannelMessage("telegram", "43", "9")
+	require.NoError(t, err)
+	assert.Equal(t, "req-2", message.RequestID)
+	assert.True(t, message.Reminder)
+
+	_, err = adapter.FindChannelMessage("slack", "42", "7")
+	assert.Error(t, err)
+}
+
+func TestSQLiteStorageAdapter_ConcurrentAnswers(t *testing.T) {
+	adapter, cleanup := setupSQLiteAdapter(t)
+	defer cleanup()
+
+	request := &types.HITLRequest{ID: "race-req-sqlite", Status: types.RequestStatusPending,
+		CallbackURL: "https://agent.example.com/hook", CreatedAt: time.Now()}
+	require.NoError(t, adapter.StoreRequest(request))
+
+	const answers = 8
+	errs := make(chan error, answers)
+	var wg sync.WaitGroup
+	for i := 0; i < answers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- adapter.UpdateRequestResponse("race-req-sqlite", fmt.Sprintf("answer %d", i), true, nil)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.ErrorIs(t, err, ErrRequestNotPending)
+	}
+	assert.Equal(t, 1, succeeded, "exactly one answer completes the request")
+
+	entries, err := adapter.ListOutboxEntries("")
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "only the winning answer's callback is enqueued")
+}
+
+func TestSQLiteStorageAdapter_Responder(t *testing.T) {
+	adapter, cleanup := setupSQLiteAdapter(t)
+	defer cleanup()
+
+	require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: "req-1", Status: types.RequestStatusPending, CreatedAt: time.Now()}))
+	responder := &types.Responder{Channel: "slack", UserID: "U1", Name: "ada", Recipient: "C1", PayloadRef: "trigger_id:13345224609.738474920.8088930838d88f008e0"}
+	require.NoError(t, adapter.UpdateRequestResponse("req-1", "Yes", true, responder))
+
+	request, err := adapter.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, responder, request.Responder)
+}
+
+func TestSQLiteStorageAdapter_Quorum(t *testing.T) {
+	adapter, cleanup := setupSQLiteAdapter(t)
+	defer cleanup()
+
+	require.NoError(t, adapter.StoreRequest(&types.HITLRequest{
+		ID:          "req-1",
+		Status:      types.RequestStatusPending,
+		Quorum:      &types.Quorum{Approvers: []string{"slack:U1", "telegram:2"}, Required: 2},
+		CallbackURL: "http://example.test/hook",
+		CreatedAt:   time.Now(),
+	}))
+
+	completed, err := adapter.RecordVote("req-1", "Approve", true, &types.Responder{Channel: "slack", UserID: "U1", Name: "ada"})
+	require.NoError(t, err)
+	assert.False(t, completed)
+	_, err = adapter.RecordVote("req-1", "Approve", true, &types.Responder{Channel: "slack", UserID: "U1", Name: "ada"})
+	assert.ErrorIs(t, err, ErrAlreadyVoted)
+
+	// Only the completing vote enqueues the callback webhook
+	due, err := adapter.GetDueOutboxEntries(time.Now(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+
+	completed, err = adapter.RecordVote("req-1", "Approve", true, &types.Responder{Channel: "telegram", UserID: "2", Name: "bob"})
+	require.NoError(t, err)
+	assert.True(t, completed)
+
+	request, err := adapter.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.True(t, request.Approved)
+	require.Len(t, request.Votes, 2)
+	assert.Equal(t, "slack:U1", request.Votes[0].Approver)
+	assert.Equal(t, "U1", request.Votes[0].Responder.UserID)
+
+	due, err = adapter.GetDueOutboxEntries(time.Now(), 10)
+	require.NoError(t, err)
+	assert.Len(t, due, 1)
+}
+
+func TestSQLiteStorageAdapter_AdvanceEscalation(t *testing.T) {
+	adapter, cleanup := setupSQLiteAdapter(t)
+	defer cleanup()
+	require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: "req-1", Status: types.RequestStatusPending, CreatedAt: time.Now()}))
+
+	advanced, err := adapter.AdvanceEscalation("req-1", 1)
+	require.NoError(t, err)
+	assert.True(t, advanced)
+
+	// Each level is taken once
+	advanced, err = adapter.AdvanceEscalation("req-1", 1)
+	require.NoError(t, err)
+	assert.False(t, advanced)
+
+	request, err := adapter.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, request.EscalationLevel)
+
+	// Resolved requests are not escalated
+	require.NoError(t, adapter.CancelRequest("req-1"))
+	advanced, err = adapter.AdvanceEscalation("req-1", 2)
+	require.NoError(t, err)
+	assert.False(t, advanced)
+}
+
+func TestSQLiteStorageAdapter_AdvanceReminders(t *testing.T) {
+	adapter, cleanup := setupSQLiteAdapter(t)
+	defer cleanup()
+
+	require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: "req-1", Status: types.RequestStatusPending, CreatedAt: time.Now()}))
+
+	advanced, err := adapter.AdvanceReminders("req-1", 2)
+	require.NoError(t, err)
+	assert.True(t, advanced)
+	advanced, err = adapter.AdvanceReminders("req-1", 1)
+	require.NoError(t, err)
+	assert.False(t, advanced)
+
+	request, err := adapter.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, request.RemindersSent)
+}
+
+func TestSQLiteStorageAdapter_WebhookOutbox(t *testing.T) {
+	adapter, cleanup := setupSQLiteAdapter(t)
+	defer cleanup()
+
+	for _, id := range []string{"answered", "canceled", "timed-out"} {
+		require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: id, Status: types.RequestStatusPending, CallbackURL: "http://example.test/" + id, UserID: "u1", CreatedAt: time.Now()}))
+	}
+	require.NoError(t, adapter.StoreRequest(&types.HITLRequest{ID: "no-callback", Status: types.RequestStatusPending, CreatedAt: time.Now()}))
+
+	require.NoError(t, adapter.UpdateRequestResponse("answered", "Yes", true, nil))
+	require.NoError(t, adapter.CancelRequest("canceled"))
+	require.NoError(t, adapter.TimeoutRequest("timed-out"))
+	require.NoError(t, adapter.UpdateRequestResponse("no-callback", "Yes", true, nil))
+
+	// A failed transition must not enqueue anything
+	assert.ErrorIs(t, adapter.TimeoutRequest("answered"), ErrRequestNotPending)
+
+	due, err := adapter.GetDueOutboxEntries(time.Now().Add(time.Second), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 3)
+	byRequest := map[string]*types.WebhookOutboxEntry{}
+	for _, entry := range due {
+		byRequest[entry.RequestID] = entry
+	}
+	assert.Contains(t, byRequest["answered"].Payload, `"status":"completed"`)
+	assert.Contains(t, byRequest["canceled"].Payload, `"status":"canceled"`)
+	assert.Contains(t, byRequest["timed-out"].Payload, `"status":"timeout"`)
+
+	limited, err := adapter.GetDueOutboxEntries(time.Now().Add(time.Second), 2)
+	require.NoError(t, err)
+	assert.Len(t, limited, 2)
+
+	entry := byRequest["answered"]
+	entry.Attempts = 5
+	entry.Status = types.OutboxStatusDead
+	entry.LastError = "unexpected status 500"
+	require.NoError(t, adapter.UpdateOutboxEntry(entry))
+
+	dead, err := adapter.ListOutboxEntries(types.OutboxStatusDead)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "unexpected status 500", dead[0].LastError)
+
+	all, err := adapter.ListOutboxEntries("")
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	mine, err := adapter.ListOutboxEntriesByUser("u1", types.OutboxStatusDead)
+	require.NoError(t, err)
+	require.Len(t, mine, 1)
+	assert.Equal(t, entry.ID, mine[0].ID)
+	mine, err = adapter.ListOutboxEntriesByUser("u1", "")
+	require.NoError(t, err)
+	assert.Len(t, mine, 3)
+	others, err := adapter.ListOutboxEntriesByUser("u2", "")
+	require.NoError(t, err)
+	assert.Empty(t, others)
+
+	require.NoError(t, adapter.RequeueOutboxEntry(entry.ID))
+	requeued, err := adapter.GetOutboxEntry(entry.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.OutboxStatusPending, requeued.Status)
+	assert.Equal(t, 0, requeued.Attempts)
+
+	assert.ErrorIs(t, adapter.RequeueOutboxEntry(entry.ID), ErrOutboxEntryNotDead)
+	// Only one dispatcher claims a due entry, until its lease runs out
+	now := time.Now().Add(time.Second)
+	claimed, err := adapter.ClaimOutboxEntry(entry.ID, now, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	claimed, err = adapter.ClaimOutboxEntry(entry.ID, now, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	claimed, err = adapter.ClaimOutboxEntry(entry.ID, now.Add(time.Minute), now.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	_, err = adapter.GetOutboxEntry("non-existent-entry")
+	assert.ErrorIs(t, err, ErrOutboxEntryNotFound)
+	assert.ErrorIs(t, adapter.RequeueOutboxEntry("non-existent-entry"), ErrOutboxEntryNotFound)
+}
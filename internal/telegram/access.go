@@ -0,0 +1,62 @@
+package telegram
+
+import (
+	"log"
+	"loopgate/internal/types"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// notAllowedMessage is shown to users who may not answer a request.
+const notAllowedMessage = "You are not allowed to answer this request."
+
+// authorize checks whether user may answer request in chat under the
+// restrictions of the request's session: its allowlist of user IDs and, in
+// group chats, its admins-only mode. It returns the refusal to show the user,
+// or "" if they may answer.
+func (b *Bot) authorize(request *types.HITLRequest, chat *tgbotapi.Chat, user *tgbotapi.User) string {
+	if user == nil {
+		return notAllowedMessage
+	}
+
+	sess, err := b.sessionManager.GetSession(request.SessionID)
+	if err != nil {
+		log.Printf("Failed to load session %s of request %s: %v", request.SessionID, request.ID, err)
+		return notAllowedMessage
+	}
+
+	if len(sess.TelegramAllowedUsers) > 0 && !containsID(sess.TelegramAllowedUsers, user.ID) {
+		log.Printf("Telegram user %d is not on the allowlist of session %s; refused answer to request %s", user.ID, sess.ID, request.ID)
+		return notAllowedMessage
+	}
+
+	if sess.TelegramAdminsOnly {
+		if chat == nil {
+			return notAllowedMessage
+		}
+		if chat.IsPrivate() {
+			return ""
+		}
+		member, err := b.api.GetChatMember(tgbotapi.GetChatMemberConfig{
+			ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chat.ID, UserID: user.ID},
+		})
+		if err != nil {
+			log.Printf("Failed to look up telegram user %d in chat %d: %v", user.ID, chat.ID, err)
+			return notAllowedMessage
+		}
+		if !member.IsCreator() && !member.IsAdministrator() {
+			log.Printf("Telegram user %d is not an administrator of chat %d; refused answer to request %s", user.ID, chat.ID, request.ID)
+			return "Only chat administrators may answer this request."
+		}
+	}
+	return ""
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
@@ -1,83 +1,346 @@
 package telegram
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"loopgate/internal/notifier"
 	"loopgate/internal/session"
+	"loopgate/internal/storage"
 	"loopgate/internal/types"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/gorilla/mux"
 )
 
+// ChannelName is the session channel served by Bot.
+const ChannelName = "telegram"
+
+// WebhookPath is the route Telegram pushes updates to in webhook mode.
+const WebhookPath = "/telegram/webhook"
+
+// secretTokenHeader carries the webhook's secret token on every update.
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// webhookRetryDelay is how long Start waits before retrying setWebhook.
+const webhookRetryDelay = 5 * time.Second
+
+// maxUpdateBytes bounds the body of a pushed update.
+const maxUpdateBytes = 1 << 20
+
+// pendingPreviewLength bounds each request's message in the /pending list,
+// which ends with morePending when it would not fit in one message.
+const (
+	pendingPreviewLength = 200
+	morePending          = "…and %d more."
+)
+
+// Config configures a Bot.
+type Config struct {
+	Token string
+	// APIEndpoint is the Bot API URL pattern with placeholders for the token
+	// and method; tgbotapi.APIEndpoint if empty.
+	APIEndpoint string
+	// PublicURL is the https base URL at which Telegram reaches this server.
+	// If set, Telegram pushes updates to WebhookPath below it; otherwise the
+	// bot long-polls for them.
+	PublicURL string
+	// WebhookSecret authenticates pushed updates. If empty it is derived
+	// from the token, so every replica uses the same secret.
+	WebhookSecret string
+}
+
+// Bot delivers HITL requests as Telegram messages and records answers given
+// with inline buttons or replies. It implements notifier.Notifier and, for
+// webhook mode, notifier.WebhookReceiver.
 type Bot struct {
 	api            *tgbotapi.BotAPI
 	sessionManager *session.Manager
-	updates        tgbotapi.UpdatesChannel
+
+	webhookURL    string // Empty in polling mode
+	webhookSecret string
+	stop          chan struct{}
+	stopOnce      sync.Once
 }
 
-func NewBot(token string, sessionManager *session.Manager) (*Bot, error) {
-	bot, err := tgbotapi.NewBotAPI(token)
+func NewBot(config Config, sessionManager *session.Manager) (*Bot, error) {
+	endpoint := config.APIEndpoint
+	if endpoint == "" {
+		endpoint = tgbotapi.APIEndpoint
+	}
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint(config.Token, endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create telegram bot: %w", err)
 	}
 
 	bot.Debug = false
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-
-	updates := bot.GetUpdatesChan(u)
-
-	return &Bot{
+	b := &Bot{
 		api:            bot,
 		sessionManager: sessionManager,
-		updates:        updates,
-	}, nil
+		webhookSecret:  config.WebhookSecret,
+		stop:           make(chan struct{}),
+	}
+	if strings.HasPrefix(config.PublicURL, "https://") {
+		b.webhookURL = strings.TrimRight(config.PublicURL, "/") + WebhookPath
+	} else if config.PublicURL != "" {
+		log.Printf("Telegram webhooks need an https PUBLIC_URL; polling for updates instead")
+	}
+	if b.webhookSecret == "" {
+		mac := hmac.New(sha256.New, []byte(config.Token))
+		mac.Write([]byte("loopgate telegram webhook"))
+		b.webhookSecret = hex.EncodeToString(mac.Sum(nil))
+	}
+	return b, nil
+}
+
+// Channel implements notifier.Notifier.
+func (b *Bot) Channel() string {
+	return ChannelName
 }
 
+// Start receives updates until Stop is called. In webhook mode it registers
+// the webhook with Telegram, retrying until it succeeds, and updates arrive
+// at the route added by RegisterRoutes. Otherwise it removes any webhook,
+// which would block polling, and long-polls.
 func (b *Bot) Start() {
+	if b.webhookURL != "" {
+		log.Printf("Starting Telegram bot in webhook mode at %s...", b.webhookURL)
+		for {
+			err := b.setWebhook()
+			if err == nil {
+				break
+			}
+			log.Printf("Failed to register telegram webhook: %v", err)
+			select {
+			case <-time.After(webhookRetryDelay):
+			case <-b.stop:
+				return
+			}
+		}
+		<-b.stop
+		return
+	}
+
 	log.Println("Starting Telegram bot...")
-	
-	for update := range b.updates {
-		if update.Message != nil {
-			b.handleMessage(update.Message)
-		} else if update.CallbackQuery != nil {
-			b.handleCallbackQuery(update.CallbackQuery)
+	if _, err := b.api.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		log.Printf("Failed to remove telegram webhook: %v", err)
+	}
+
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+	updates := b.api.GetUpdatesChan(u)
+	for {
+		select {
+		case update := <-updates:
+			b.handleUpdate(update)
+		case <-b.stop:
+			b.api.StopReceivingUpdates()
+			return
 		}
 	}
 }
 
-func (b *Bot) SendHITLRequest(request *types.HITLRequest) error {
-	telegramID, err := b.sessionManager.GetTelegramID(request.ClientID)
-	if err != nil {
-		return fmt.Errorf("failed to get telegram ID for client %s: %w", request.ClientID, err)
+// Stop ends Start. A registered webhook stays in place for other replicas.
+func (b *Bot) Stop() {
+	b.stopOnce.Do(func() { close(b.stop) })
+}
+
+// setWebhook points Telegram at WebhookPath, asking only for the updates
+// the bot handles.
+func (b *Bot) setWebhook() error {
+	params := tgbotapi.Params{"url": b.webhookURL, "secret_token": b.webhookSecret}
+	if err := params.AddInterface("allowed_updates", []string{"message", "callback_query"}); err != nil {
+		return err
 	}
+	_, err := b.api.MakeRequest("setWebhook", params)
+	return err
+}
 
-	var msg tgbotapi.MessageConfig
+// RegisterRoutes implements notifier.WebhookReceiver. The route is only
+// added in webhook mode.
+func (b *Bot) RegisterRoutes(router *mux.Router) {
+	if b.webhookURL == "" {
+		return
+	}
+	router.HandleFunc(WebhookPath, b.HandleWebhook).Methods("POST")
+}
 
-	if len(request.Options) > 0 {
-		msg = b.createMessageWithButtons(telegramID, request)
-	} else {
-		msg = b.createSimpleMessage(telegramID, request)
+// HandleWebhook handles an update pushed by Telegram. Requests without the
+// webhook's secret token are refused.
+func (b *Bot) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get(secretTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(b.webhookSecret)) != 1 {
+		http.Error(w, "Invalid secret token", http.StatusUnauthorized)
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUpdateBytes)).Decode(&update); err != nil {
+		http.Error(w, "Invalid update", http.StatusBadRequest)
+		return
+	}
+
+	b.handleUpdate(update)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (b *Bot) handleUpdate(update tgbotapi.Update) {
+	if update.Message != nil {
+		b.handleMessage(update.Message)
+	} else if update.CallbackQuery != nil {
+		b.handleCallbackQuery(update.CallbackQuery)
 	}
+}
 
-	sentMsg, err := b.api.Send(msg)
+// SendRequest sends request to the session's Telegram chat, with a button
+// per option if it has any. Messages too long for Telegram are cut short
+// and followed by the full text as a file. If Telegram cannot parse the
+// request's markup, it is sent as plain text rather than not at all.
+func (b *Bot) SendRequest(request *types.HITLRequest, sess *types.Session) error {
+	if sess.TelegramID == 0 {
+		return fmt.Errorf("session %s has no telegram ID", sess.ID)
+	}
+
+	footer := requestFooter(request)
+	message := render(request, "🤖 HITL Request", footer)
+	sentMsg, err := b.api.Send(b.createRequestMessage(sess.TelegramID, request, message))
+	if isMarkupError(err) {
+		log.Printf("Telegram could not parse the %s markup of request %s, sending it as plain text: %v", request.Format, request.ID, err)
+		message = renderPlain(request, "🤖 HITL Request", footer)
+		sentMsg, err = b.api.Send(b.createRequestMessage(sess.TelegramID, request, message))
+	}
 	if err != nil {
 		return fmt.Errorf("failed to send telegram message: %w", err)
 	}
 
 	request.TelegramMsgID = sentMsg.MessageID
+	if err := b.sessionManager.SetTelegramMsgID(request.ID, sentMsg.MessageID); err != nil {
+		log.Printf("Failed to store telegram message ID for request %s: %v", request.ID, err)
+	}
+
+	if message.truncated {
+		document := tgbotapi.NewDocument(sess.TelegramID, attachment(request))
+		document.ReplyToMessageID = sentMsg.MessageID
+		if _, err := b.api.Send(document); err != nil {
+			log.Printf("Failed to attach the full message of request %s: %v", request.ID, err)
+		}
+	}
 	return nil
 }
 
-func (b *Bot) createMessageWithButtons(chatID int64, request *types.HITLRequest) tgbotapi.MessageConfig {
-	text := fmt.Sprintf("🤖 *HITL Request*\n\n%s\n\n*Request ID:* `%s`\n*Client:* %s\n*Session:* %s",
-		request.Message, request.ID, request.ClientID, request.SessionID)
+// NotifyResolved edits the original request message to show the outcome and
+// removes any answer buttons.
+func (b *Bot) NotifyResolved(request *types.HITLRequest, sess *types.Session) error {
+	if request.TelegramMsgID == 0 {
+		return nil
+	}
 
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ParseMode = "Markdown"
+	var heading string
+	var outcome func(m markup) string
+	switch request.Status {
+	case types.RequestStatusCompleted:
+		heading = "✅ Response Recorded"
+		outcome = func(m markup) string {
+			text := m.escape("Response: "+request.Response) + "\n"
+			if answeredBy := notifier.AnsweredBy(request); answeredBy != "" {
+				text += m.escape("Answered by: "+answeredBy) + "\n"
+			}
+			return text
+		}
+	case types.RequestStatusTimeout:
+		heading = "⌛ Request Expired"
+		outcome = func(m markup) string {
+			return m.escape(fmt.Sprintf("No response within %d seconds.", request.Timeout)) + "\n"
+		}
+	case types.RequestStatusCanceled:
+		heading = "🚫 Request Canceled"
+		outcome = func(m markup) string { return "" }
+	default:
+		return nil
+	}
+	footer := func(m markup) string {
+		return outcome(m) + m.escape("Request ID: ") + m.code(request.ID)
+	}
+
+	message := render(request, heading, footer)
+	_, err := b.api.Send(editMessage(sess.TelegramID, request.TelegramMsgID, message))
+	if isMarkupError(err) {
+		_, err = b.api.Send(editMessage(sess.TelegramID, request.TelegramMsgID, renderPlain(request, heading, footer)))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to edit telegram message: %w", err)
+	}
+	return nil
+}
+
+// SendReminder replies to the request message to remind the chat that it is
+// still waiting for an answer, and for how long it will. The reminder is
+// recorded, so replying to it answers the request.
+func (b *Bot) SendReminder(request *types.HITLRequest, sess *types.Session, remaining time.Duration) error {
+	if request.TelegramMsgID == 0 || sess.TelegramID == 0 {
+		return nil
+	}
+
+	m := htmlMarkup
+	text := m.bold("⏰ Reminder:") + m.escape(" this request is still waiting for an answer.") + "\n"
+	if remaining > 0 {
+		text += m.escape(fmt.Sprintf("%s left before it times out.", remaining.Round(time.Second))) + "\n"
+	}
+	text += "\n" + m.escape("Request ID: ") + m.code(request.ID)
+
+	msg := tgbotapi.NewMessage(sess.TelegramID, text)
+	msg.ParseMode = m.parseMode
+	msg.ReplyToMessageID = request.TelegramMsgID
+	if len(request.Options) == 0 {
+		msg.ReplyMarkup = forceReply()
+	}
+	sent, err := b.api.Send(msg)
+	if err != nil {
+		return fmt.Errorf("failed to send telegram reminder: %w", err)
+	}
+
+	err = b.sessionManager.RecordReminderMessage(request.ID, ChannelName,
+		strconv.FormatInt(sess.TelegramID, 10), strconv.Itoa(sent.MessageID))
+	if err != nil {
+		log.Printf("Failed to record telegram reminder of request %s: %v", request.ID, err)
+	}
+	return nil
+}
+
+// requestFooter renders the details below a new request's message.
+func requestFooter(request *types.HITLRequest) func(m markup) string {
+	return func(m markup) string {
+		footer := m.bold("Request ID:") + " " + m.code(request.ID) + "\n" +
+			m.bold("Client:") + " " + m.escape(request.ClientID) + "\n" +
+			m.bold("Session:") + " " + m.escape(request.SessionID)
+		if len(request.Options) == 0 {
+			footer += "\n\n" + m.escape("Please reply with your response.")
+		}
+		return footer
+	}
+}
+
+// createRequestMessage sends message to chatID with a button per option of
+// request, or prompting for a reply if it has none.
+func (b *Bot) createRequestMessage(chatID int64, request *types.HITLRequest, message rendered) tgbotapi.MessageConfig {
+	msg := tgbotapi.NewMessage(chatID, message.text)
+	msg.ParseMode = message.parseMode
+
+	if len(request.Options) == 0 {
+		msg.ReplyMarkup = forceReply()
+		return msg
+	}
 
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for i, option := range request.Options {
@@ -92,14 +355,16 @@ func (b *Bot) createMessageWithButtons(chatID int64, request *types.HITLRequest)
 	return msg
 }
 
-func (b *Bot) createSimpleMessage(chatID int64, request *types.HITLRequest) tgbotapi.MessageConfig {
-	text := fmt.Sprintf("🤖 *HITL Request*\n\n%s\n\n*Request ID:* `%s`\n*Client:* %s\n*Session:* %s\n\nPlease reply with your response.",
-		request.Message, request.ID, request.ClientID, request.SessionID)
-
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ParseMode = "Markdown"
+func editMessage(chatID int64, messageID int, message rendered) tgbotapi.EditMessageTextConfig {
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, message.text)
+	edit.ParseMode = message.parseMode
+	return edit
+}
 
-	return msg
+// forceReply opens a reply to the message in the user's client, so answers
+// to requests without options reach handleReply.
+func forceReply() tgbotapi.ForceReply {
+	return tgbotapi.ForceReply{ForceReply: true, InputFieldPlaceholder: "Your response"}
 }
 
 func (b *Bot) handleMessage(message *tgbotapi.Message) {
@@ -139,15 +404,17 @@ func (b *Bot) handleStatusCommand(chatID int64) {
 		return
 	}
 
-	text := "*Active Sessions:*\n\n"
+	m := htmlMarkup
+	text := m.bold("Active Sessions:") + "\n\n"
 	for _, session := range sessions {
 		if session.TelegramID == chatID {
-			text += fmt.Sprintf("• Session: `%s`\n  Client: %s\n  Started: %s\n\n",
-				session.ID, session.ClientID, session.CreatedAt.Format("2006-01-02 15:04:05"))
+			text += "• Session: " + m.code(session.ID) + "\n" +
+				"  Client: " + m.escape(session.ClientID) + "\n" +
+				"  Started: " + session.CreatedAt.Format("2006-01-02 15:04:05") + "\n\n"
 		}
 	}
 
-	b.sendMarkdownResponse(chatID, text)
+	b.sendHTMLResponse(chatID, text)
 }
 
 func (b *Bot) handlePendingCommand(chatID int64) {
@@ -163,33 +430,102 @@ func (b *Bot) handlePendingCommand(chatID int64) {
 		return
 	}
 
-	text := "*Pending Requests:*\n\n"
+	m := htmlMarkup
+	var items []string
 	for _, request := range pending {
-		telegramID, err := b.sessionManager.GetTelegramID(request.ClientID)
-		if err != nil || telegramID != chatID {
+		if !b.deliveredTo(request, chatID) {
 			continue
 		}
-		
-		text += fmt.Sprintf("• Request: `%s`\n  Message: %s\n  Client: %s\n\n",
-			request.ID, request.Message, request.ClientID)
+
+		preview := truncateEscaped(request.Message, pendingPreviewLength, m.escape)
+		if len(preview) < len(m.escape(request.Message)) {
+			preview += "…"
+		}
+		items = append(items, "• Request: "+m.code(request.ID)+"\n"+
+			"  Message: "+preview+"\n"+
+			"  Client: "+m.escape(request.ClientID)+"\n\n")
+	}
+
+	if len(items) == 0 {
+		b.sendResponse(chatID, "No pending requests.")
+		return
+	}
+
+	text := m.bold("Pending Requests:") + "\n\n"
+	for i, item := range items {
+		if textLength(text+item)+len(morePending) > maxMessageLength {
+			text += fmt.Sprintf(morePending, len(items)-i)
+			break
+		}
+		text += item
 	}
 
-	b.sendMarkdownResponse(chatID, text)
+	b.sendHTMLResponse(chatID, text)
 }
 
+// deliveredTo reports whether request was sent to chatID, going by the
+// messages recorded for it. Requests sent before messages were recorded
+// count as sent to their own session's chat. Either way the chat comes from
+// the request itself, never from another session that shares its client ID.
+func (b *Bot) deliveredTo(request *types.HITLRequest, chatID int64) bool {
+	messages, err := b.sessionManager.GetChannelMessages(request.ID)
+	if err != nil {
+		log.Printf("Error getting messages of request %s: %v", request.ID, err)
+		return false
+	}
+	if len(messages) > 0 {
+		recipient := strconv.FormatInt(chatID, 10)
+		for _, message := range messages {
+			if message.Channel == ChannelName && message.Recipient == recipient {
+				return true
+			}
+		}
+		return false
+	}
+
+	sess, err := b.sessionManager.GetUserSession(request.UserID, request.SessionID)
+	return err == nil && sess.TelegramID == chatID
+}
+
+// handleReply answers a request with the text of a reply to its message or
+// to one of its reminders. Replies to other messages are ignored.
 func (b *Bot) handleReply(message *tgbotapi.Message) {
-	replyText := message.ReplyToMessage.Text
-	
-	if !strings.Contains(replyText, "Request ID:") {
+	requestID, ok := b.repliedRequest(message)
+	if !ok {
 		return
 	}
 
-	requestID := b.extractRequestID(replyText)
-	if requestID == "" {
+	request, err := b.sessionManager.GetRequest(requestID)
+	if err != nil {
+		b.sendResponse(message.Chat.ID, "Request not found.")
+		return
+	}
+	if refusal := b.authorize(request, message.Chat, message.From); refusal != "" {
+		b.sendResponse(message.Chat.ID, refusal)
 		return
 	}
 
-	err := b.sessionManager.UpdateRequestResponse(requestID, message.Text, true)
+	// A reply to a request with options has to pick one of them, so typing
+	// "no" cannot approve it.
+	response, approved := message.Text, true
+	if len(request.Options) > 0 {
+		option, ok := notifier.MatchOption(request.Options, message.Text)
+		if !ok {
+			b.sendResponse(message.Chat.ID, "Please use the buttons, or reply with one of: "+strings.Join(request.Options, ", "))
+			return
+		}
+		response, approved = option, notifier.OptionApproves(option)
+	}
+
+	err = b.sessionManager.UpdateRequestResponse(requestID, response, approved, responder(message.From, message.Chat, fmt.Sprintf("message:%d", message.MessageID)))
+	if errors.Is(err, storage.ErrRequestNotPending) {
+		b.sendResponse(message.Chat.ID, "This request is no longer pending; your response was not recorded.")
+		return
+	}
+	if refusal := notifier.VoteRefusal(err); refusal != "" {
+		b.sendResponse(message.Chat.ID, refusal)
+		return
+	}
 	if err != nil {
 		b.sendResponse(message.Chat.ID, fmt.Sprintf("Error updating request: %v", err))
 		return
@@ -198,6 +534,35 @@ func (b *Bot) handleReply(message *tgbotapi.Message) {
 	b.sendResponse(message.Chat.ID, "✅ Response recorded successfully!")
 }
 
+// repliedRequest returns the ID of the request message replies to, going by
+// the messages recorded for requests. Requests sent before messages were
+// recorded are matched by their TelegramMsgID in their own session's chat,
+// as NotifyResolved does.
+func (b *Bot) repliedRequest(message *tgbotapi.Message) (string, bool) {
+	chatID := message.Chat.ID
+	replyTo := message.ReplyToMessage.MessageID
+	delivered, err := b.sessionManager.FindChannelMessage(ChannelName, strconv.FormatInt(chatID, 10), strconv.Itoa(replyTo))
+	if err == nil {
+		return delivered.RequestID, true
+	}
+
+	pending, err := b.sessionManager.GetPendingRequests()
+	if err != nil {
+		log.Printf("Error getting pending requests: %v", err)
+		return "", false
+	}
+	for _, request := range pending {
+		if request.TelegramMsgID != replyTo {
+			continue
+		}
+		sess, err := b.sessionManager.GetUserSession(request.UserID, request.SessionID)
+		if err == nil && sess.TelegramID == chatID {
+			return request.ID, true
+		}
+	}
+	return "", false
+}
+
 func (b *Bot) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
 	data := query.Data
 	log.Printf("Received callback query from user %d: %s", query.From.ID, data)
@@ -224,19 +589,30 @@ func (b *Bot) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
 		return
 	}
 
-	if optionIndex >= len(request.Options) {
+	if refusal := b.authorize(request, callbackChat(query), query.From); refusal != "" {
+		b.answerCallbackAlert(query.ID, refusal)
+		return
+	}
+
+	if optionIndex < 0 || optionIndex >= len(request.Options) {
 		b.answerCallbackQuery(query.ID, "Invalid option")
 		return
 	}
 
 	selectedOption := request.Options[optionIndex]
-	approved := strings.ToLower(selectedOption) != "cancel" && 
-	           strings.ToLower(selectedOption) != "reject" &&
-	           strings.ToLower(selectedOption) != "deny"
+	approved := notifier.OptionApproves(selectedOption)
 
 	log.Printf("Processing response for request %s: option='%s', approved=%t", requestID, selectedOption, approved)
 
-	err = b.sessionManager.UpdateRequestResponse(requestID, selectedOption, approved)
+	err = b.sessionManager.UpdateRequestResponse(requestID, selectedOption, approved, responder(query.From, callbackChat(query), "callback_query:"+query.ID))
+	if errors.Is(err, storage.ErrRequestNotPending) {
+		b.answerCallbackQuery(query.ID, "This request is no longer pending")
+		return
+	}
+	if refusal := notifier.VoteRefusal(err); refusal != "" {
+		b.answerCallbackQuery(query.ID, refusal)
+		return
+	}
 	if err != nil {
 		log.Printf("Error updating request %s: %v", requestID, err)
 		b.answerCallbackQuery(query.ID, "Error updating request")
@@ -245,27 +621,25 @@ func (b *Bot) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
 
 	log.Printf("Successfully updated request %s with response: %s", requestID, selectedOption)
 
+	// The message itself is edited by NotifyResolved.
 	b.answerCallbackQuery(query.ID, fmt.Sprintf("Selected: %s", selectedOption))
-	
-	updateText := fmt.Sprintf("✅ *Response Recorded*\n\nSelected: %s\nRequest ID: `%s`", 
-		selectedOption, requestID)
-	
-	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, updateText)
-	edit.ParseMode = "Markdown"
-	b.api.Send(edit)
 }
 
-func (b *Bot) extractRequestID(text string) string {
-	lines := strings.Split(text, "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "Request ID:") {
-			parts := strings.Split(line, "`")
-			if len(parts) >= 2 {
-				return parts[1]
-			}
+// responder identifies the Telegram user who answered, the chat they
+// answered in and the update that carried the answer.
+func responder(user *tgbotapi.User, chat *tgbotapi.Chat, payloadRef string) *types.Responder {
+	r := &types.Responder{Channel: ChannelName, PayloadRef: payloadRef}
+	if chat != nil {
+		r.Recipient = strconv.FormatInt(chat.ID, 10)
+	}
+	if user != nil {
+		r.UserID = strconv.FormatInt(user.ID, 10)
+		r.Name = user.UserName
+		if r.Name == "" {
+			r.Name = strings.TrimSpace(user.FirstName + " " + user.LastName)
 		}
 	}
-	return ""
+	return r
 }
 
 func (b *Bot) sendResponse(chatID int64, text string) {
@@ -273,13 +647,28 @@ func (b *Bot) sendResponse(chatID int64, text string) {
 	b.api.Send(msg)
 }
 
-func (b *Bot) sendMarkdownResponse(chatID int64, text string) {
+func (b *Bot) sendHTMLResponse(chatID int64, text string) {
 	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ParseMode = "Markdown"
+	msg.ParseMode = tgbotapi.ModeHTML
 	b.api.Send(msg)
 }
 
 func (b *Bot) answerCallbackQuery(queryID, text string) {
 	callback := tgbotapi.NewCallback(queryID, text)
 	b.api.Request(callback)
+}
+
+// answerCallbackAlert answers a callback query with a dialog the user has to
+// dismiss, for presses that were refused.
+func (b *Bot) answerCallbackAlert(queryID, text string) {
+	callback := tgbotapi.NewCallbackWithAlert(queryID, text)
+	b.api.Request(callback)
+}
+
+// callbackChat returns the chat of the message whose button was pressed.
+func callbackChat(query *tgbotapi.CallbackQuery) *tgbotapi.Chat {
+	if query.Message == nil {
+		return nil
+	}
+	return query.Message.Chat
 }
\ No newline at end of file
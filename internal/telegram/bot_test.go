@@ -0,0 +1,570 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"loopgate/internal/notifier"
+	"loopgate/internal/session"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testToken  = "123456:test-token"
+	testSecret = "webhook-secret"
+	testChatID = 4242
+	// adminUserID is the only administrator of the test chat.
+	adminUserID = 1
+	// brokenMarkup is markup the fake Bot API cannot parse.
+	brokenMarkup = "<broken>"
+)
+
+type apiCall struct {
+	Method string
+	Params url.Values
+}
+
+// fakeBotAPI stands in for the Telegram Bot API. It records calls and
+// answers them successfully, except for messages containing brokenMarkup,
+// which it cannot parse.
+type fakeBotAPI struct {
+	mu     sync.Mutex
+	calls  []apiCall
+	nextID int
+}
+
+func (f *fakeBotAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		r.ParseForm()
+	}
+	method := strings.TrimPrefix(r.URL.Path, "/bot"+testToken+"/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, apiCall{Method: method, Params: r.PostForm})
+
+	if r.PostForm.Get("parse_mode") != "" && strings.Contains(r.PostForm.Get("text"), brokenMarkup) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error_code": 400,
+			"description": "Bad Request: can't parse entities: Unclosed start tag at byte offset 0"})
+		return
+	}
+
+	var result interface{} = true
+	switch method {
+	case "getMe":
+		result = map[string]interface{}{"id": 1, "is_bot": true, "username": "loopgate_bot"}
+	case "sendMessage", "editMessageText", "sendDocument":
+		f.nextID++
+		result = map[string]interface{}{"message_id": 100 + f.nextID, "chat": map[string]interface{}{"id": testChatID}}
+	case "getChatMember":
+		status := "member"
+		if r.PostForm.Get("user_id") == strconv.Itoa(adminUserID) {
+			status = "administrator"
+		}
+		result = map[string]interface{}{"user": map[string]interface{}{"id": 1}, "status": status}
+	case "getUpdates":
+		// A long poll that found nothing
+		time.Sleep(10 * time.Millisecond)
+		result = []interface{}{}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+func (f *fakeBotAPI) callsTo(method string) []apiCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []apiCall
+	for _, call := range f.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+type testBot struct {
+	*Bot
+	manager  *session.Manager
+	registry *notifier.Registry
+	api      *fakeBotAPI
+	endpoint string
+	server   *httptest.Server
+}
+
+func setupBot(t *testing.T, publicURL string) *testBot {
+	t.Helper()
+	api := &fakeBotAPI{}
+	apiServer := httptest.NewServer(api)
+	t.Cleanup(apiServer.Close)
+
+	manager := session.NewManager(storage.NewInMemoryStorageAdapter())
+	endpoint := apiServer.URL + "/bot%s/%s"
+	bot, err := NewBot(Config{
+		Token:         testToken,
+		APIEndpoint:   endpoint,
+		PublicURL:     publicURL,
+		WebhookSecret: testSecret,
+	}, manager)
+	require.NoError(t, err)
+	t.Cleanup(bot.Stop)
+
+	registry := notifier.NewRegistry(manager)
+	registry.Register(bot)
+	manager.OnResolved(registry.NotifyResolved)
+
+	router := mux.NewRouter()
+	registry.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	require.NoError(t, manager.CreateSession(&types.Session{ID: "s1", ClientID: "agent", Channel: ChannelName, TelegramID: testChatID}))
+	return &testBot{Bot: bot, manager: manager, registry: registry, api: api, endpoint: endpoint, server: server}
+}
+
+func (tb *testBot) submit(t *testing.T, request *types.HITLRequest) {
+	t.Helper()
+	if request.SessionID == "" {
+		request.SessionID = "s1"
+	}
+	if request.ClientID == "" {
+		request.ClientID = "agent"
+	}
+	request.Status = types.RequestStatusPending
+	request.CreatedAt = time.Now()
+	require.NoError(t, tb.manager.StoreRequest(request))
+	require.NoError(t, tb.registry.Send(request))
+}
+
+// pushUpdate posts update to the webhook route the way Telegram does.
+func (tb *testBot) pushUpdate(t *testing.T, secret, update string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, tb.server.URL+WebhookPath, strings.NewReader(update))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(secretTokenHeader, secret)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp
+}
+
+// deliver hands update to the bot the way polling does.
+func (tb *testBot) deliver(t *testing.T, update string) {
+	t.Helper()
+	var parsed tgbotapi.Update
+	require.NoError(t, json.Unmarshal([]byte(update), &parsed))
+	tb.handleUpdate(parsed)
+}
+
+// callbackUpdate is a press of a button on a message in the test group chat.
+func callbackUpdate(userID int64, data string) string {
+	return fmt.Sprintf(`{"update_id":1,"callback_query":{"id":"cb-1","from":{"id":%d,"username":"ada"},`+
+		`"message":{"message_id":101,"date":0,"chat":{"id":%d,"type":"group"}},"data":%q}}`, userID, testChatID, data)
+}
+
+// replyUpdate is a reply in the test group chat to message replyTo.
+func replyUpdate(userID int64, replyTo int, text string) string {
+	return fmt.Sprintf(`{"update_id":2,"message":{"message_id":200,"date":0,"from":{"id":%d,"username":"ada"},`+
+		`"chat":{"id":%d,"type":"group"},"text":%q,"reply_to_message":{"message_id":%d,"date":0,"chat":{"id":%d,"type":"group"}}}}`,
+		userID, testChatID, text, replyTo, testChatID)
+}
+
+func TestBot_WebhookAnswersRequest(t *testing.T) {
+	tb := setupBot(t, "https://loopgate.example.com/")
+	tb.submit(t, &types.HITLRequest{ID: "req-1", Message: "Deploy?", Options: []string{"Approve", "Reject"}})
+
+	resp := tb.pushUpdate(t, testSecret, callbackUpdate(7, "response:req-1:0"))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	request, err := tb.manager.GetRequest("req-1")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.Equal(t, "Approve", request.Response)
+	assert.Equal(t, &types.Responder{Channel: ChannelName, UserID: "7", Name: "ada",
+		Recipient: strconv.Itoa(testChatID), PayloadRef: "callback_query:cb-1"}, request.Responder)
+
+	answers := tb.api.callsTo("answerCallbackQuery")
+	require.Len(t, answers, 1)
+	assert.Equal(t, "Selected: Approve", answers[0].Params.Get("text"))
+}
+
+func TestBot_WebhookRejectsWrongSecret(t *testing.T) {
+	tb := setupBot(t, "https://loopgate.example.com")
+	tb.submit(t, &types.HITLRequest{ID: "req-2", Message: "Deploy?", Options: []string{"Approve"}})
+
+	for _, secret := range []string{"", "not-the-secret"} {
+		resp := tb.pushUpdate(t, secret, callbackUpdate(7, "response:req-2:0"))
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	request, err := tb.manager.GetRequest("req-2")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+	assert.Empty(t, tb.api.callsTo("answerCallbackQuery"))
+}
+
+func TestBot_StartRegistersWebhook(t *testing.T) {
+	tb := setupBot(t, "https://loopgate.example.com")
+
+	done := make(chan struct{})
+	go func() {
+		tb.Start()
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		return len(tb.api.callsTo("setWebhook")) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	params := tb.api.callsTo("setWebhook")[0].Params
+	assert.Equal(t, "https://loopgate.example.com"+WebhookPath, params.Get("url"))
+	assert.Equal(t, testSecret, params.Get("secret_token"))
+	assert.JSONEq(t, `["message","callback_query"]`, params.Get("allowed_updates"))
+	assert.Empty(t, tb.api.callsTo("getUpdates"))
+
+	tb.Stop()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Start did not return after Stop")
+	}
+}
+
+func TestBot_PollsWithoutPublicURL(t *testing.T) {
+	for _, publicURL := range []string{"", "http://localhost:8080"} {
+		tb := setupBot(t, publicURL)
+
+		// No webhook route is added
+		resp := tb.pushUpdate(t, testSecret, callbackUpdate(7, "response:req-1:0"))
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, publicURL)
+
+		done := make(chan struct{})
+		go func() {
+			tb.Start()
+			close(done)
+		}()
+
+		require.Eventually(t, func() bool {
+			return len(tb.api.callsTo("getUpdates")) > 0
+		}, 2*time.Second, 10*time.Millisecond, publicURL)
+		assert.Len(t, tb.api.callsTo("deleteWebhook"), 1, publicURL)
+		assert.Empty(t, tb.api.callsTo("setWebhook"), publicURL)
+
+		tb.Stop()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Start did not return after Stop")
+		}
+	}
+}
+
+func TestNewBot_DerivesWebhookSecret(t *testing.T) {
+	tb := setupBot(t, "")
+	first, err := NewBot(Config{Token: testToken, APIEndpoint: tb.endpoint}, tb.manager)
+	require.NoError(t, err)
+	second, err := NewBot(Config{Token: testToken, APIEndpoint: tb.endpoint}, tb.manager)
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, first.webhookSecret)
+	assert.NotContains(t, first.webhookSecret, testToken)
+	assert.Equal(t, first.webhookSecret, second.webhookSecret)
+}
+
+func TestBot_AllowlistRefusesOtherUsers(t *testing.T) {
+	tb := setupBot(t, "")
+	require.NoError(t, tb.manager.CreateSession(&types.Session{ID: "s2", ClientID: "agent", Channel: ChannelName,
+		TelegramID: testChatID, TelegramAllowedUsers: []int64{7}}))
+	tb.submit(t, &types.HITLRequest{ID: "req-3", SessionID: "s2", Message: "Deploy?", Options: []string{"Approve", "Reject"}})
+
+	tb.deliver(t, callbackUpdate(8, "response:req-3:0"))
+	tb.deliver(t, replyUpdate(8, 101, "yes"))
+
+	request, err := tb.manager.GetRequest("req-3")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+
+	answers := tb.api.callsTo("answerCallbackQuery")
+	require.Len(t, answers, 1)
+	assert.Equal(t, notAllowedMessage, answers[0].Params.Get("text"))
+	assert.Equal(t, "true", answers[0].Params.Get("show_alert"))
+	messages := tb.api.callsTo("sendMessage")
+	assert.Equal(t, notAllowedMessage, messages[len(messages)-1].Params.Get("text"))
+
+	tb.deliver(t, callbackUpdate(7, "response:req-3:1"))
+	request, err = tb.manager.GetRequest("req-3")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.Equal(t, "Reject", request.Response)
+	assert.Equal(t, &types.Responder{Channel: ChannelName, UserID: "7", Name: "ada",
+		Recipient: strconv.Itoa(testChatID), PayloadRef: "callback_query:cb-1"}, request.Responder)
+}
+
+func TestBot_AdminsOnly(t *testing.T) {
+	tb := setupBot(t, "")
+	require.NoError(t, tb.manager.CreateSession(&types.Session{ID: "s3", ClientID: "agent", Channel: ChannelName,
+		TelegramID: testChatID, TelegramAdminsOnly: true}))
+	tb.submit(t, &types.HITLRequest{ID: "req-4", SessionID: "s3", Message: "Which region?", RequestType: types.RequestTypeInput})
+	tb.submit(t, &types.HITLRequest{ID: "req-5", SessionID: "s3", Message: "Deploy?", Options: []string{"Approve"}})
+
+	tb.deliver(t, callbackUpdate(8, "response:req-5:0"))
+	answers := tb.api.callsTo("answerCallbackQuery")
+	require.Len(t, answers, 1)
+	assert.Equal(t, "Only chat administrators may answer this request.", answers[0].Params.Get("text"))
+	assert.Equal(t, "true", answers[0].Params.Get("show_alert"))
+
+	tb.deliver(t, replyUpdate(8, 101, "eu-west-1"))
+	request, err := tb.manager.GetRequest("req-4")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+
+	tb.deliver(t, replyUpdate(adminUserID, 101, "eu-west-1"))
+	tb.deliver(t, callbackUpdate(adminUserID, "response:req-5:0"))
+	for _, id := range []string{"req-4", "req-5"} {
+		request, err := tb.manager.GetRequest(id)
+		require.NoError(t, err)
+		assert.Equal(t, types.RequestStatusCompleted, request.Status, id)
+		assert.Equal(t, strconv.Itoa(adminUserID), request.Responder.UserID, id)
+	}
+	request, err = tb.manager.GetRequest("req-4")
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", request.Response)
+	assert.Equal(t, "message:200", request.Responder.PayloadRef)
+}
+
+func TestBot_RepliesResolveThroughStoredMessages(t *testing.T) {
+	tb := setupBot(t, "")
+	tb.submit(t, &types.HITLRequest{ID: "req-6", Message: "Which region?", RequestType: types.RequestTypeInput, Timeout: 600})
+	tb.submit(t, &types.HITLRequest{ID: "req-7", Message: "Which zone?", RequestType: types.RequestTypeInput, Timeout: 600})
+
+	// Input requests prompt for a reply
+	messages := tb.api.callsTo("sendMessage")
+	require.Len(t, messages, 2)
+	assert.JSONEq(t, `{"force_reply":true,"input_field_placeholder":"Your response"}`, messages[0].Params.Get("reply_markup"))
+
+	// Replies to messages that are not requests are ignored, whatever they say
+	tb.deliver(t, replyUpdate(7, 150, "eu-west-1"))
+	request, err := tb.manager.GetRequest("req-6")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+	assert.Len(t, tb.api.callsTo("sendMessage"), 2)
+
+	tb.deliver(t, replyUpdate(7, 102, "zone-b"))
+	request, err = tb.manager.GetRequest("req-7")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.Equal(t, "zone-b", request.Response)
+
+	// A reply to a reminder answers the request it reminds of
+	request, err = tb.manager.GetRequest("req-6")
+	require.NoError(t, err)
+	sent, err := tb.registry.Remind(request, 5*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	reminder := tb.api.callsTo("sendMessage")[3]
+	assert.Equal(t, "101", reminder.Params.Get("reply_to_message_id"))
+	assert.Contains(t, reminder.Params.Get("reply_markup"), `"force_reply":true`)
+
+	stored, err := tb.manager.GetChannelMessages("req-6")
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+	assert.True(t, stored[1].Reminder)
+	reminderID, err := strconv.Atoi(stored[1].MessageID)
+	require.NoError(t, err)
+
+	tb.deliver(t, replyUpdate(7, reminderID, "eu-west-1"))
+	request, err = tb.manager.GetRequest("req-6")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.Equal(t, "eu-west-1", request.Response)
+
+	// Only the request message is updated with the outcome
+	edits := tb.api.callsTo("editMessageText")
+	require.Len(t, edits, 2)
+	assert.Equal(t, "101", edits[1].Params.Get("message_id"))
+}
+
+func TestBot_EscapesPlainMessages(t *testing.T) {
+	tb := setupBot(t, "")
+	require.NoError(t, tb.manager.CreateSession(&types.Session{ID: "deploy_bot", ClientID: "agent", Channel: ChannelName, TelegramID: testChatID}))
+	tb.submit(t, &types.HITLRequest{ID: "req-8", SessionID: "deploy_bot", Message: "Run `rm -rf *_tmp` on <prod> & staging?", Options: []string{"Yes", "No"}})
+
+	messages := tb.api.callsTo("sendMessage")
+	require.Len(t, messages, 1)
+	assert.Equal(t, "HTML", messages[0].Params.Get("parse_mode"))
+	assert.Equal(t, "<b>🤖 HITL Request</b>\n\nRun `rm -rf *_tmp` on &lt;prod&gt; &amp; staging?\n\n"+
+		"<b>Request ID:</b> <code>req-8</code>\n<b>Client:</b> agent\n<b>Session:</b> deploy_bot", messages[0].Params.Get("text"))
+
+	tb.deliver(t, callbackUpdate(7, "response:req-8:0"))
+	edits := tb.api.callsTo("editMessageText")
+	require.Len(t, edits, 1)
+	assert.Equal(t, "HTML", edits[0].Params.Get("parse_mode"))
+	assert.Contains(t, edits[0].Params.Get("text"), "&lt;prod&gt; &amp; staging?\n\nResponse: Yes\nAnswered by: ada via telegram\n")
+}
+
+func TestBot_MarkdownMessages(t *testing.T) {
+	tb := setupBot(t, "")
+	require.NoError(t, tb.manager.CreateSession(&types.Session{ID: "s.2", ClientID: "agent_1", Channel: ChannelName, TelegramID: testChatID}))
+	tb.submit(t, &types.HITLRequest{ID: "req-9", SessionID: "s.2", ClientID: "agent_1", Message: "Deploy *v1\\.2*?", Format: types.MessageFormatMarkdown, Options: []string{"Yes"}})
+
+	messages := tb.api.callsTo("sendMessage")
+	require.Len(t, messages, 1)
+	assert.Equal(t, "MarkdownV2", messages[0].Params.Get("parse_mode"))
+	assert.Equal(t, "*🤖 HITL Request*\n\nDeploy *v1\\.2*?\n\n*Request ID:* `req-9`\n*Client:* agent\\_1\n*Session:* s\\.2",
+		messages[0].Params.Get("text"))
+}
+
+func TestBot_FallsBackToPlainTextOnBrokenMarkup(t *testing.T) {
+	tb := setupBot(t, "")
+	tb.submit(t, &types.HITLRequest{ID: "req-10", Message: "Deploy " + brokenMarkup + "now?", Format: types.MessageFormatHTML, Options: []string{"Yes"}})
+
+	messages := tb.api.callsTo("sendMessage")
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages[1].Params.Get("text"), "Deploy &lt;broken&gt;now?")
+
+	request, err := tb.manager.GetRequest("req-10")
+	require.NoError(t, err)
+	assert.NotZero(t, request.TelegramMsgID)
+}
+
+func TestBot_AttachesLongMessages(t *testing.T) {
+	tb := setupBot(t, "")
+	long := strings.Repeat("Step <n> of the rollout.\n", 300)
+	tb.submit(t, &types.HITLRequest{ID: "req-11", Message: long, Options: []string{"Yes"}})
+
+	messages := tb.api.callsTo("sendMessage")
+	require.Len(t, messages, 1)
+	text := messages[0].Params.Get("text")
+	assert.LessOrEqual(t, textLength(text), maxMessageLength)
+	assert.Contains(t, text, truncatedNote+"\n\n<b>Request ID:</b> <code>req-11</code>")
+	assert.NotContains(t, text, "<n>")
+
+	documents := tb.api.callsTo("sendDocument")
+	require.Len(t, documents, 1)
+	assert.Equal(t, "101", documents[0].Params.Get("reply_to_message_id"))
+
+	// The outcome fits as well
+	tb.deliver(t, callbackUpdate(7, "response:req-11:0"))
+	edits := tb.api.callsTo("editMessageText")
+	require.Len(t, edits, 1)
+	assert.LessOrEqual(t, textLength(edits[0].Params.Get("text")), maxMessageLength)
+	assert.Contains(t, edits[0].Params.Get("text"), "Response: Yes")
+}
+
+func TestTruncateEscaped(t *testing.T) {
+	assert.Equal(t, "a&lt;", truncateEscaped("a<b", 5, htmlMarkup.escape))
+	assert.Equal(t, "a", truncateEscaped("a<b", 4, htmlMarkup.escape))
+	// Emoji take two UTF-16 code units
+	assert.Equal(t, "🤖", truncateEscaped("🤖🤖", 3, htmlMarkup.escape))
+	assert.Equal(t, 4, textLength("🤖🤖"))
+}
+
+func TestBot_RepliesResolveRequestsSentBeforeMessagesWereRecorded(t *testing.T) {
+	tb := setupBot(t, "")
+	// Stored with only its Telegram message ID, as before messages were recorded
+	require.NoError(t, tb.manager.StoreRequest(&types.HITLRequest{ID: "req-old", SessionID: "s1", ClientID: "agent",
+		Message: "Which region?", Status: types.RequestStatusPending, CreatedAt: time.Now()}))
+	require.NoError(t, tb.manager.SetTelegramMsgID("req-old", 55))
+
+	// The same message ID in another chat is someone else's message
+	other := strings.Replace(replyUpdate(7, 55, "us-east-1"), `"chat":{"id":4242`, `"chat":{"id":9999`, 1)
+	tb.deliver(t, other)
+	request, err := tb.manager.GetRequest("req-old")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+
+	tb.deliver(t, replyUpdate(7, 55, "eu-west-1"))
+	request, err = tb.manager.GetRequest("req-old")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.Equal(t, "eu-west-1", request.Response)
+}
+
+func TestBot_PendingListsOnlyThisChatsRequests(t *testing.T) {
+	tb := setupBot(t, "")
+	// Another tenant's session with the same client ID, in another chat
+	const otherChatID = 9999
+	require.NoError(t, tb.manager.CreateSession(&types.Session{ID: "other", ClientID: "agent", Channel: ChannelName,
+		TelegramID: otherChatID, UserID: "other-user"}))
+	tb.submit(t, &types.HITLRequest{ID: "req-mine", Message: "Deploy?", Options: []string{"Yes"}})
+	tb.submit(t, &types.HITLRequest{ID: "req-theirs", SessionID: "other", UserID: "other-user", Message: "Rotate the secret keys?"})
+
+	for _, chatID := range []int64{testChatID, otherChatID} {
+		tb.deliver(t, fmt.Sprintf(`{"update_id":3,"message":{"message_id":300,"date":0,"from":{"id":7},`+
+			`"chat":{"id":%d,"type":"group"},"text":"/pending","entities":[{"type":"bot_command","offset":0,"length":8}]}}`, chatID))
+	}
+
+	var lists []apiCall
+	for _, call := range tb.api.callsTo("sendMessage") {
+		if strings.Contains(call.Params.Get("text"), "Pending Requests") {
+			lists = append(lists, call)
+		}
+	}
+	require.Len(t, lists, 2)
+	assert.Equal(t, strconv.Itoa(testChatID), lists[0].Params.Get("chat_id"))
+	assert.Contains(t, lists[0].Params.Get("text"), "req-mine")
+	assert.NotContains(t, lists[0].Params.Get("text"), "req-theirs")
+	assert.Equal(t, strconv.Itoa(otherChatID), lists[1].Params.Get("chat_id"))
+	assert.Contains(t, lists[1].Params.Get("text"), "req-theirs")
+	assert.NotContains(t, lists[1].Params.Get("text"), "req-mine")
+}
+
+func TestBot_RefusesOutOfRangeOptions(t *testing.T) {
+	tb := setupBot(t, "")
+	tb.submit(t, &types.HITLRequest{ID: "req-12", Message: "Deploy?", Options: []string{"Approve", "Reject"}})
+
+	for _, data := range []string{"response:req-12:-1", "response:req-12:2"} {
+		tb.deliver(t, callbackUpdate(7, data))
+	}
+
+	request, err := tb.manager.GetRequest("req-12")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+	answers := tb.api.callsTo("answerCallbackQuery")
+	require.Len(t, answers, 2)
+	assert.Equal(t, "Invalid option", answers[0].Params.Get("text"))
+}
+
+func TestBot_RepliesToOptionRequestsMustPickAnOption(t *testing.T) {
+	tb := setupBot(t, "")
+	tb.submit(t, &types.HITLRequest{ID: "req-13", Message: "Deploy?", Options: []string{"Approve", "Reject"}})
+
+	// Free text does not count as an approval
+	tb.deliver(t, replyUpdate(7, 101, "no way"))
+	request, err := tb.manager.GetRequest("req-13")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusPending, request.Status)
+	messages := tb.api.callsTo("sendMessage")
+	assert.Equal(t, "Please use the buttons, or reply with one of: Approve, Reject", messages[len(messages)-1].Params.Get("text"))
+
+	tb.deliver(t, replyUpdate(7, 101, "reject"))
+	request, err = tb.manager.GetRequest("req-13")
+	require.NoError(t, err)
+	assert.Equal(t, types.RequestStatusCompleted, request.Status)
+	assert.Equal(t, "Reject", request.Response)
+	assert.False(t, request.Approved)
+
+	// Options can also be picked by number
+	tb.submit(t, &types.HITLRequest{ID: "req-14", Message: "Deploy?", Options: []string{"Approve", "Reject"}})
+	request, err = tb.manager.GetRequest("req-14")
+	require.NoError(t, err)
+	tb.deliver(t, replyUpdate(7, request.TelegramMsgID, "1"))
+	request, err = tb.manager.GetRequest("req-14")
+	require.NoError(t, err)
+	assert.Equal(t, "Approve", request.Response)
+	assert.True(t, request.Approved)
+}
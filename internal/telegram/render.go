@@ -0,0 +1,147 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"loopgate/internal/types"
+	"strings"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxMessageLength is the most UTF-16 code units Telegram accepts in a
+// message. Markup counts too, so the check errs on the safe side.
+const maxMessageLength = 4096
+
+// truncatedNote ends a request message that was cut short.
+const truncatedNote = "… (truncated; the full message is attached)"
+
+// markup renders text for one of Telegram's parse modes.
+type markup struct {
+	parseMode string
+	escape    func(string) string
+	bold      func(string) string
+	code      func(string) string
+}
+
+var htmlMarkup = markup{
+	parseMode: tgbotapi.ModeHTML,
+	escape:    html.EscapeString,
+	bold:      func(s string) string { return "<b>" + html.EscapeString(s) + "</b>" },
+	code:      func(s string) string { return "<code>" + html.EscapeString(s) + "</code>" },
+}
+
+var markdownMarkup = markup{
+	parseMode: tgbotapi.ModeMarkdownV2,
+	escape:    escapeMarkdownV2,
+	bold:      func(s string) string { return "*" + escapeMarkdownV2(s) + "*" },
+	code:      func(s string) string { return "`" + codeEscaper.Replace(s) + "`" },
+}
+
+// markdownEscaper escapes every character MarkdownV2 reserves.
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(",
+	")", "\\)", "~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+",
+	"-", "\\-", "=", "\\=", "|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.",
+	"!", "\\!",
+)
+
+// codeEscaper escapes the characters MarkdownV2 reserves in code spans.
+var codeEscaper = strings.NewReplacer("\\", "\\\\", "`", "\\`")
+
+func escapeMarkdownV2(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// rendered is a message ready to send to Telegram.
+type rendered struct {
+	text      string
+	parseMode string
+	// truncated is set when the request's message was cut short to fit.
+	truncated bool
+}
+
+// markupFor returns the markup for request's format and its message in it.
+// Plain messages are escaped; markdown and HTML messages are passed on as
+// the agent wrote them.
+func markupFor(request *types.HITLRequest) (markup, string) {
+	switch request.Format {
+	case types.MessageFormatMarkdown:
+		return markdownMarkup, request.Message
+	case types.MessageFormatHTML:
+		return htmlMarkup, request.Message
+	default:
+		return htmlMarkup, html.EscapeString(request.Message)
+	}
+}
+
+// render lays out a message about request: heading in bold, the request's
+// message, then the lines footer renders. If that exceeds Telegram's limit,
+// the message is cut short and shown as plain text instead, as markup
+// cannot be cut safely.
+func render(request *types.HITLRequest, heading string, footer func(m markup) string) rendered {
+	m, body := markupFor(request)
+	head := m.bold(heading) + "\n\n"
+	tail := "\n\n" + footer(m)
+
+	text := head + body + tail
+	if textLength(text) <= maxMessageLength {
+		return rendered{text: text, parseMode: m.parseMode}
+	}
+
+	note := "\n" + m.escape(truncatedNote)
+	budget := maxMessageLength - textLength(head) - textLength(tail) - textLength(note)
+	body = truncateEscaped(request.Message, budget, m.escape)
+	return rendered{text: head + body + note + tail, parseMode: m.parseMode, truncated: true}
+}
+
+// renderPlain renders like render, but treats request's message as plain
+// text whatever its format, for when Telegram rejects the agent's markup.
+func renderPlain(request *types.HITLRequest, heading string, footer func(m markup) string) rendered {
+	plain := *request
+	plain.Format = types.MessageFormatPlain
+	return render(&plain, heading, footer)
+}
+
+// truncateEscaped returns the longest prefix of text whose escaped form fits
+// in budget UTF-16 code units, escaped.
+func truncateEscaped(text string, budget int, escape func(string) string) string {
+	var b strings.Builder
+	length := 0
+	for _, r := range text {
+		escaped := escape(string(r))
+		n := textLength(escaped)
+		if length+n > budget {
+			break
+		}
+		b.WriteString(escaped)
+		length += n
+	}
+	return b.String()
+}
+
+// textLength counts s in UTF-16 code units, as Telegram does.
+func textLength(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// attachment returns the full message of request as a text file.
+func attachment(request *types.HITLRequest) tgbotapi.FileBytes {
+	return tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("request-%s.txt", request.ID),
+		Bytes: []byte(request.Message),
+	}
+}
+
+// isMarkupError reports whether Telegram refused a message because its
+// markup could not be parsed.
+func isMarkupError(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && strings.Contains(apiErr.Message, "can't parse entities")
+}
@@ -14,6 +14,15 @@ const (
 	RequestTypeChoice       RequestType = "choice"
 )
 
+// MessageFormat says how a request's message is marked up.
+type MessageFormat string
+
+const (
+	MessageFormatPlain    MessageFormat = "plain"    // Shown as written; the default
+	MessageFormatMarkdown MessageFormat = "markdown" // Telegram MarkdownV2
+	MessageFormatHTML     MessageFormat = "html"     // Telegram HTML
+)
+
 type RequestStatus string
 
 const (
@@ -39,6 +48,97 @@ type HITLRequest struct {
 	CreatedAt     time.Time              `json:"created_at"`
 	RespondedAt   *time.Time             `json:"responded_at,omitempty"`
 	TelegramMsgID int                    `json:"telegram_msg_id,omitempty"`
+	// ChannelMsgID identifies the delivered message on channels other than
+	// Telegram, e.g. a Slack message timestamp.
+	ChannelMsgID string `json:"channel_msg_id,omitempty"`
+	// UserID is the owner of the API key that submitted the request. Only
+	// that user can poll, list or cancel it.
+	UserID string `json:"user_id,omitempty" gorm:"index"`
+	// Responder is who gave the answer that completed the request.
+	Responder *Responder `json:"responder,omitempty" gorm:"serializer:json"`
+	// Quorum, if set, makes the request wait for votes from several named
+	// approvers instead of completing on the first answer.
+	Quorum *Quorum `json:"quorum,omitempty" gorm:"serializer:json"`
+	// Votes are the answers cast so far on a quorum request, oldest first.
+	Votes []Vote `json:"votes,omitempty" gorm:"serializer:json"`
+	// Escalation re-sends the request to further targets while nobody
+	// answers. EscalationLevel counts the steps that have been taken.
+	Escalation      []EscalationStep `json:"escalation,omitempty" gorm:"serializer:json"`
+	EscalationLevel int              `json:"escalation_level,omitempty"`
+	// RemindersSent counts the reminders sent while the request is pending.
+	RemindersSent int `json:"reminders_sent,omitempty"`
+	// Format is the markup of Message. Telegram renders it; other channels
+	// show the message as written.
+	Format MessageFormat `json:"format,omitempty"`
+}
+
+// Clone returns a copy of the request that shares no slices, maps or
+// pointers with it, so either can be changed without affecting the other.
+func (r *HITLRequest) Clone() *HITLRequest {
+	copied := *r
+	copied.Options = append([]string(nil), r.Options...)
+	copied.Votes = append([]Vote(nil), r.Votes...)
+	copied.Escalation = append([]EscalationStep(nil), r.Escalation...)
+	if r.Metadata != nil {
+		copied.Metadata = make(map[string]interface{}, len(r.Metadata))
+		for key, value := range r.Metadata {
+			copied.Metadata[key] = value
+		}
+	}
+	if r.RespondedAt != nil {
+		respondedAt := *r.RespondedAt
+		copied.RespondedAt = &respondedAt
+	}
+	if r.Responder != nil {
+		responder := *r.Responder
+		copied.Responder = &responder
+	}
+	if r.Quorum != nil {
+		quorum := *r.Quorum
+		quorum.Approvers = append([]string(nil), r.Quorum.Approvers...)
+		copied.Quorum = &quorum
+	}
+	return &copied
+}
+
+// EscalationStep sends a request that is still pending After seconds after
+// it was created to Targets as well, e.g. a secondary approver's chat.
+type EscalationStep struct {
+	After   int             `json:"after_seconds"`
+	Targets []ChannelTarget `json:"targets"`
+}
+
+// Quorum requires Required of the named Approvers to approve a request. An
+// approver is a user ID qualified with its channel, e.g. "slack:U0123" or
+// "telegram:123456789".
+type Quorum struct {
+	Approvers []string `json:"approvers"`
+	Required  int      `json:"required"`       // Approvals needed, between 1 and len(Approvers)
+	Veto      bool     `json:"veto,omitempty"` // Any rejection rejects the request at once
+}
+
+// Vote is one approver's answer to a quorum request.
+type Vote struct {
+	Approver  string     `json:"approver"` // The Quorum.Approvers entry that voted
+	Response  string     `json:"response"`
+	Approved  bool       `json:"approved"`
+	Responder *Responder `json:"responder,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Responder identifies the human who answered a request and where the
+// answer came from.
+type Responder struct {
+	Channel string `json:"channel"`           // Channel the answer came through, e.g. "slack" or "console"
+	UserID  string `json:"user_id,omitempty"` // The user's ID on that channel
+	Name    string `json:"name,omitempty"`    // Display name or username
+	// Recipient is the chat, room or address on the channel the answer was
+	// given in, in the form of ChannelTarget; a Telegram chat ID as a string.
+	Recipient string `json:"recipient,omitempty"`
+	// PayloadRef identifies the inbound payload that carried the answer,
+	// e.g. a Telegram callback query or a Matrix event, for tracing it in
+	// the channel's own records.
+	PayloadRef string `json:"payload_ref,omitempty"`
 }
 
 type Session struct {
@@ -47,6 +147,46 @@ type Session struct {
 	TelegramID int64  `json:"telegram_id"`
 	Active     bool   `json:"active"`
 	CreatedAt  time.Time `json:"created_at"`
+	// UserID is the owner of the API key that registered the session.
+	UserID string `json:"user_id,omitempty" gorm:"index"`
+	// Channel names the notifier that delivers the session's requests, such
+	// as "telegram". Empty means the default channel.
+	Channel string `json:"channel,omitempty"`
+	// Recipient addresses the human on channels other than Telegram, e.g. a
+	// Slack channel or user ID.
+	Recipient string `json:"recipient,omitempty"`
+	// Targets are further places every request is delivered to besides the
+	// channel above. The first answer from any of them wins.
+	Targets []ChannelTarget `json:"targets,omitempty" gorm:"serializer:json"`
+	// TelegramAllowedUsers lists the Telegram user IDs that may answer the
+	// session's requests. Empty means anyone who can see the message.
+	TelegramAllowedUsers []int64 `json:"telegram_allowed_users,omitempty" gorm:"serializer:json"`
+	// TelegramAdminsOnly limits answers in Telegram group chats to the
+	// chat's administrators.
+	TelegramAdminsOnly bool `json:"telegram_admins_only,omitempty"`
+}
+
+// ChannelTarget is a place requests are delivered to: a channel and the
+// chat, room or address on it.
+type ChannelTarget struct {
+	Channel    string `json:"channel"`
+	TelegramID int64  `json:"telegram_id,omitempty"` // Required for the telegram channel
+	Recipient  string `json:"recipient,omitempty"`   // Required for every other channel
+}
+
+// ChannelMessage records one message a request was delivered as, so it can
+// be updated when the request is resolved.
+type ChannelMessage struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	RequestID string    `json:"request_id" gorm:"index"`
+	Channel   string    `json:"channel" gorm:"index:idx_channel_message"`
+	Recipient string    `json:"recipient" gorm:"index:idx_channel_message"` // Chat ID on Telegram
+	MessageID string    `json:"message_id" gorm:"index:idx_channel_message"`
+	CreatedAt time.Time `json:"created_at"`
+	// Reminder marks a reminder of the request rather than the request
+	// itself. Replies to it answer the request, but it is not updated when
+	// the request is resolved.
+	Reminder bool `json:"reminder,omitempty" gorm:"default:false"`
 }
 
 type HITLResponse struct {
@@ -57,10 +197,56 @@ type HITLResponse struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// WebhookDelivery records one attempt to POST a HITLResponse to a request's
+// CallbackURL.
+type WebhookDelivery struct {
+	ID         string    `json:"id" gorm:"primaryKey"`
+	RequestID  string    `json:"request_id" gorm:"index"`
+	URL        string    `json:"url"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Succeeded  bool      `json:"succeeded"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type OutboxStatus string
+
+const (
+	OutboxStatusPending   OutboxStatus = "pending"
+	OutboxStatusDelivered OutboxStatus = "delivered"
+	OutboxStatusDead      OutboxStatus = "dead"
+)
+
+// WebhookOutboxEntry is a callback_url notification waiting to be delivered.
+// It is written in the same transaction that resolves the request, so a crash
+// before delivery cannot lose it.
+type WebhookOutboxEntry struct {
+	ID            string       `json:"id" gorm:"primaryKey"`
+	RequestID     string       `json:"request_id" gorm:"index"`
+	UserID        string       `json:"user_id,omitempty" gorm:"index"`
+	URL           string       `json:"url"`
+	Payload       string       `json:"payload"` // JSON-encoded HITLResponse
+	Status        OutboxStatus `json:"status" gorm:"index"`
+	Attempts      int          `json:"attempts"`
+	LastError     string       `json:"last_error,omitempty"`
+	NextAttemptAt time.Time    `json:"next_attempt_at"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
 type SessionRegistration struct {
 	SessionID  string `json:"session_id"`
 	ClientID   string `json:"client_id"`
-	TelegramID int64  `json:"telegram_id"`
+	TelegramID int64  `json:"telegram_id,omitempty"` // Required for the telegram channel
+	Channel    string `json:"channel,omitempty"`     // Defaults to "telegram"
+	Recipient  string `json:"recipient,omitempty"`   // Required for every other channel
+	// Targets adds further channels every request is delivered to.
+	Targets []ChannelTarget `json:"targets,omitempty"`
+	// TelegramAllowedUsers and TelegramAdminsOnly restrict who may answer
+	// in Telegram; see Session.
+	TelegramAllowedUsers []int64 `json:"telegram_allowed_users,omitempty"`
+	TelegramAdminsOnly   bool    `json:"telegram_admins_only,omitempty"`
 }
 
 type PollResponse struct {
@@ -69,18 +255,50 @@ type PollResponse struct {
 	Approved    bool          `json:"approved"`
 	RequestID   string        `json:"request_id"`
 	Completed   bool          `json:"completed"`
+	// Votes are the votes cast so far on a quorum request.
+	Votes []Vote `json:"votes,omitempty"`
+	// Responder and RespondedAt record who answered the request, and when.
+	Responder   *Responder `json:"responder,omitempty"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+}
+
+// NewPollResponse reports the state of request to the agent polling it.
+func NewPollResponse(request *HITLRequest) PollResponse {
+	return PollResponse{
+		RequestID: request.ID,
+		Status:    request.Status,
+		Response:  request.Response,
+		Approved:  request.Approved,
+		Completed: request.Status == RequestStatusCompleted ||
+			request.Status == RequestStatusTimeout ||
+			request.Status == RequestStatusCanceled,
+		Votes: request.Votes,
+
+		Responder:   request.Responder,
+		RespondedAt: request.RespondedAt,
+	}
 }
 
 type MCPRequest struct {
-	Method string      `json:"method"`
-	Params interface{} `json:"params"`
-	ID     interface{} `json:"id"`
+	JSONRPC string      `json:"jsonrpc,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+	ID      interface{} `json:"id"`
 }
 
 type MCPResponse struct {
-	Result interface{} `json:"result,omitempty"`
-	Error  *MCPError   `json:"error,omitempty"`
-	ID     interface{} `json:"id"`
+	JSONRPC string      `json:"jsonrpc"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   *MCPError   `json:"error,omitempty"`
+	ID      interface{} `json:"id"`
+}
+
+// MCPNotification is a JSON-RPC message that expects no response, such as
+// notifications/progress sent while a tool call is in flight.
+type MCPNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
 }
 
 type MCPError struct {
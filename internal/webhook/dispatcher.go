@@ -0,0 +1,250 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// SignatureHeader carries "sha256=<hex>", an HMAC-SHA256 over
+	// "<timestamp>.<body>" keyed with the webhook secret.
+	SignatureHeader = "X-Loopgate-Signature"
+	// TimestampHeader carries the Unix time the signature was made, so
+	// receivers can reject replayed deliveries.
+	TimestampHeader = "X-Loopgate-Timestamp"
+	// DeliveryHeader identifies the attempt; it matches WebhookDelivery.ID.
+	DeliveryHeader = "X-Loopgate-Delivery"
+	// OutboxEntryHeader identifies the notification. It is the same on every
+	// retry, so receivers can use it to drop duplicates.
+	OutboxEntryHeader = "X-Loopgate-Outbox-Entry"
+
+	defaultPollInterval = 2 * time.Second
+	batchSize           = 20
+	maxBackoff          = 5 * time.Minute
+	// claimLease is how long an attempt holds its entry. It outlasts the
+	// client timeout, so an entry is only picked up again if the dispatcher
+	// attempting it died.
+	claimLease = time.Minute
+)
+
+// Dispatcher drains the webhook outbox. Entries are written by the storage
+// adapter in the same transaction that resolves a request; the Dispatcher
+// POSTs each one to its URL, retries failures with exponential backoff and
+// moves an entry to the dead state after maxAttempts failures. Delivery is
+// at-least-once: an entry stays pending until a 2xx response is recorded.
+// Each attempt first claims its entry, so replicas sharing a database can
+// all run a Dispatcher without sending the same entry twice at once.
+type Dispatcher struct {
+	storage      storage.StorageAdapter
+	client       *http.Client
+	secret       []byte
+	maxAttempts  int
+	baseBackoff  time.Duration
+	pollInterval time.Duration
+	now          func() time.Time
+
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewDispatcher creates a Dispatcher. If secret is empty deliveries are sent
+// unsigned.
+func NewDispatcher(adapter storage.StorageAdapter, secret string, maxAttempts int, baseBackoff time.Duration) *Dispatcher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &Dispatcher{
+		storage:      adapter,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		secret:       []byte(secret),
+		maxAttempts:  maxAttempts,
+		baseBackoff:  baseBackoff,
+		pollInterval: defaultPollInterval,
+		now:          time.Now,
+		wake:         make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+	}
+}
+
+// Start delivers due outbox entries until Stop is called. The first pass
+// picks up anything left over from before a restart. It blocks, so callers
+// usually run it in its own goroutine.
+func (d *Dispatcher) Start() {
+	log.Println("Starting webhook dispatcher...")
+
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for d.DeliverDue() == batchSize {
+			// A full batch means more may be waiting.
+		}
+
+		select {
+		case <-ticker.C:
+		case <-d.wake:
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// Stop ends the loop started by Start. Entries that were not delivered stay
+// in the outbox and are retried on the next start.
+func (d *Dispatcher) Stop() {
+	d.stopOnce.Do(func() { close(d.stop) })
+}
+
+// Notify wakes the dispatcher so a freshly resolved request is delivered
+// without waiting for the next poll. It matches session.ResolutionListener.
+func (d *Dispatcher) Notify(request *types.HITLRequest) {
+	if request.CallbackURL == "" {
+		return
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// DeliverDue makes one attempt for each due outbox entry, up to one batch,
+// and returns how many entries it attempted.
+func (d *Dispatcher) DeliverDue() int {
+	entries, err := d.storage.GetDueOutboxEntries(d.now(), batchSize)
+	if err != nil {
+		log.Printf("Webhook: error loading outbox: %v", err)
+		return 0
+	}
+
+	attempted := 0
+	var wg sync.WaitGroup
+	for _, entry := range entries {
+		now := d.now()
+		claimed, err := d.storage.ClaimOutboxEntry(entry.ID, now, now.Add(claimLease))
+		if err != nil {
+			log.Printf("Webhook: error claiming outbox entry %s: %v", entry.ID, err)
+			continue
+		}
+		if !claimed {
+			// Another dispatcher is attempting it.
+			continue
+		}
+		attempted++
+		wg.Add(1)
+		go func(entry *types.WebhookOutboxEntry) {
+			defer wg.Done()
+			d.process(entry)
+		}(entry)
+	}
+	wg.Wait()
+	return attempted
+}
+
+func (d *Dispatcher) process(entry *types.WebhookOutboxEntry) {
+	entry.Attempts++
+	delivery := d.attempt(entry)
+	if err := d.storage.RecordWebhookDelivery(delivery); err != nil {
+		log.Printf("Webhook: failed to record delivery %s: %v", delivery.ID, err)
+	}
+
+	switch {
+	case delivery.Succeeded:
+		entry.Status = types.OutboxStatusDelivered
+		entry.LastError = ""
+		log.Printf("Webhook: delivered request %s to %s (attempt %d)", entry.RequestID, entry.URL, entry.Attempts)
+	case !retryable(delivery.StatusCode) || entry.Attempts >= d.maxAttempts:
+		entry.Status = types.OutboxStatusDead
+		entry.LastError = delivery.Error
+		log.Printf("Webhook: moved outbox entry %s for request %s to dead letter after %d attempts: %s",
+			entry.ID, entry.RequestID, entry.Attempts, delivery.Error)
+	default:
+		entry.LastError = delivery.Error
+		entry.NextAttemptAt = d.now().Add(d.backoff(entry.Attempts))
+	}
+
+	if err := d.storage.UpdateOutboxEntry(entry); err != nil {
+		log.Printf("Webhook: failed to update outbox entry %s: %v", entry.ID, err)
+	}
+}
+
+func (d *Dispatcher) attempt(entry *types.WebhookOutboxEntry) *types.WebhookDelivery {
+	delivery := &types.WebhookDelivery{
+		ID:        uuid.New().String(),
+		RequestID: entry.RequestID,
+		URL:       entry.URL,
+		Attempt:   entry.Attempts,
+		CreatedAt: d.now(),
+	}
+
+	payload := []byte(entry.Payload)
+	req, err := http.NewRequest(http.MethodPost, entry.URL, bytes.NewReader(payload))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	timestamp := strconv.FormatInt(delivery.CreatedAt.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(OutboxEntryHeader, entry.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	if len(d.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(d.secret, timestamp, payload))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	delivery.StatusCode = resp.StatusCode
+	delivery.Succeeded = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !delivery.Succeeded {
+		delivery.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return delivery
+}
+
+// backoff returns the wait after the given failed attempt: base, 2*base,
+// 4*base, ... capped at maxBackoff.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.baseBackoff << (attempt - 1)
+	if wait <= 0 || wait > maxBackoff {
+		return maxBackoff
+	}
+	return wait
+}
+
+// retryable reports whether an attempt that ended with statusCode is worth
+// repeating. Network errors (statusCode 0), throttling and server errors are;
+// other client errors mean the receiver rejected the payload.
+func retryable(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// Sign returns the SignatureHeader value for body sent at timestamp.
+// Receivers verify a delivery by recomputing it with their copy of the secret.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,202 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"loopgate/internal/session"
+	"loopgate/internal/storage"
+	"loopgate/internal/types"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatcher_RetriesAndSigns(t *testing.T) {
+	var calls int32
+	var received types.HITLResponse
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		expected := Sign([]byte("test-secret"), r.Header.Get(TimestampHeader), body)
+		if r.Header.Get(SignatureHeader) != expected {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.Unmarshal(body, &received)
+	}))
+	defer server.Close()
+
+	adapter := storage.NewInMemoryStorageAdapter()
+	manager := session.NewManager(adapter)
+	dispatcher := NewDispatcher(adapter, "test-secret", 3, time.Minute)
+
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{
+		ID: "req-1", Status: types.RequestStatusPending, CallbackURL: server.URL, CreatedAt: time.Now(),
+	}))
+	require.NoError(t, manager.UpdateRequestResponse("req-1", "Yes", true, nil))
+
+	now := time.Now().Add(time.Second)
+	dispatcher.now = func() time.Time { return now }
+
+	// First attempt fails and is scheduled for retry after the backoff
+	assert.Equal(t, 1, dispatcher.DeliverDue())
+	assert.Equal(t, 0, dispatcher.DeliverDue())
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, 1, dispatcher.DeliverDue())
+
+	assert.Equal(t, "req-1", received.RequestID)
+	assert.Equal(t, types.RequestStatusCompleted, received.Status)
+	assert.Equal(t, "Yes", received.Response)
+	assert.True(t, received.Approved)
+
+	entries, err := adapter.ListOutboxEntries(types.OutboxStatusDelivered)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 2, entries[0].Attempts)
+
+	deliveries, err := manager.GetWebhookDeliveries("req-1")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, http.StatusServiceUnavailable, deliveries[0].StatusCode)
+	assert.False(t, deliveries[0].Succeeded)
+	assert.Equal(t, 2, deliveries[1].Attempt)
+	assert.True(t, deliveries[1].Succeeded)
+}
+
+func TestDispatcher_DeadLetterAndRequeue(t *testing.T) {
+	var failing int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	adapter := storage.NewInMemoryStorageAdapter()
+	manager := session.NewManager(adapter)
+	dispatcher := NewDispatcher(adapter, "", 2, time.Millisecond)
+
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{
+		ID: "req-2", Status: types.RequestStatusPending, CallbackURL: server.URL, CreatedAt: time.Now(),
+	}))
+	require.NoError(t, manager.CancelRequest("req-2"))
+
+	assert.Equal(t, 1, dispatcher.DeliverDue())
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, 1, dispatcher.DeliverDue())
+
+	dead, err := adapter.ListOutboxEntries(types.OutboxStatusDead)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 2, dead[0].Attempts)
+	assert.Equal(t, 0, dispatcher.DeliverDue(), "dead entries are not retried")
+
+	atomic.StoreInt32(&failing, 0)
+	require.NoError(t, adapter.RequeueOutboxEntry(dead[0].ID))
+	assert.Equal(t, 1, dispatcher.DeliverDue())
+
+	entry, err := adapter.GetOutboxEntry(dead[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.OutboxStatusDelivered, entry.Status)
+}
+
+func TestDispatcher_DoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	adapter := storage.NewInMemoryStorageAdapter()
+	manager := session.NewManager(adapter)
+	dispatcher := NewDispatcher(adapter, "", 5, time.Millisecond)
+
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{
+		ID: "req-3", Status: types.RequestStatusPending, CallbackURL: server.URL, CreatedAt: time.Now(),
+	}))
+	require.NoError(t, manager.ExpireRequest("req-3"))
+
+	assert.Equal(t, 1, dispatcher.DeliverDue())
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, 0, dispatcher.DeliverDue())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	dead, err := adapter.ListOutboxEntries(types.OutboxStatusDead)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Contains(t, dead[0].LastError, "400")
+}
+
+func TestDispatcher_ReplicasClaimEachEntryOnce(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	adapter := storage.NewInMemoryStorageAdapter()
+	manager := session.NewManager(adapter)
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{
+		ID: "req-4", Status: types.RequestStatusPending, CallbackURL: server.URL, CreatedAt: time.Now(),
+	}))
+	require.NoError(t, manager.UpdateRequestResponse("req-4", "Yes", true, nil))
+
+	// Both replicas may load the entry, but only one claims it
+	var attempted int32
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dispatcher := NewDispatcher(adapter, "", 3, time.Minute)
+			atomic.AddInt32(&attempted, int32(dispatcher.DeliverDue()))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), attempted)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestDispatcher_RetriesAbandonedClaims(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	adapter := storage.NewInMemoryStorageAdapter()
+	manager := session.NewManager(adapter)
+	dispatcher := NewDispatcher(adapter, "", 3, time.Minute)
+	require.NoError(t, manager.StoreRequest(&types.HITLRequest{
+		ID: "req-5", Status: types.RequestStatusPending, CallbackURL: server.URL, CreatedAt: time.Now(),
+	}))
+	require.NoError(t, manager.UpdateRequestResponse("req-5", "Yes", true, nil))
+
+	// A dispatcher that died after claiming the entry
+	now := time.Now().Add(time.Second)
+	dispatcher.now = func() time.Time { return now }
+	due, err := adapter.GetDueOutboxEntries(now, batchSize)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	claimed, err := adapter.ClaimOutboxEntry(due[0].ID, now, now.Add(claimLease))
+	require.NoError(t, err)
+	require.True(t, claimed)
+
+	assert.Equal(t, 0, dispatcher.DeliverDue(), "the entry is leased")
+
+	now = now.Add(claimLease)
+	assert.Equal(t, 1, dispatcher.DeliverDue(), "the lease ran out")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
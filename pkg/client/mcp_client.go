@@ -155,6 +155,7 @@ func (c *MCPClient) CheckRequestStatus(requestID string) (*types.MCPResponse, er
 }
 
 func (c *MCPClient) sendRequest(request types.MCPRequest) (*types.MCPResponse, error) {
+	request.JSONRPC = "2.0"
 	requestBytes, err := json.Marshal(request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -164,17 +165,28 @@ func (c *MCPClient) sendRequest(request types.MCPRequest) (*types.MCPResponse, e
 		return nil, fmt.Errorf("failed to write request: %w", err)
 	}
 
-	responseBytes, err := c.reader.ReadBytes('\n')
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
+	for {
+		responseBytes, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
 
-	var response types.MCPResponse
-	if err := json.Unmarshal(responseBytes, &response); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-	}
+		// Skip server notifications, such as progress updates sent while
+		// a tool waits for a human.
+		var message struct {
+			Method string `json:"method"`
+		}
+		if json.Unmarshal(responseBytes, &message) == nil && message.Method != "" {
+			continue
+		}
 
-	return &response, nil
+		var response types.MCPResponse
+		if err := json.Unmarshal(responseBytes, &response); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+
+		return &response, nil
+	}
 }
 
 func (c *MCPClient) Close() error {